@@ -0,0 +1,332 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/cache/remote"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+)
+
+// The statuses of the (synonym, lookup) records of a dictionary which is compared with its active version.
+const (
+	keptStatus    = "kept"
+	addedStatus   = "added"   // only in the dictionary
+	removedStatus = "removed" // only in the active version
+)
+
+// deltaConfig configures delta imports.
+type deltaConfig struct {
+	// ChunkSize is how many synonyms and lookups are sorted in memory at once while they are compared.
+	ChunkSize int    `mapstructure:"chunk_size"`
+	TempDir   string `mapstructure:"temp_dir"` // where sorted chunks are written, the system's temporary directory if empty
+}
+
+// deltaReport summarises the changes made by a delta import.
+type deltaReport struct {
+	Dictionary      string `json:"dictionary"`
+	Version         string `json:"version"` // the active version, which the changes were applied to
+	EntriesAdded    int    `json:"entriesAdded"`
+	EntriesRemoved  int    `json:"entriesRemoved"`
+	EntriesChanged  int    `json:"entriesChanged"` // entries which have gained or lost synonyms
+	SynonymsAdded   int    `json:"synonymsAdded"`
+	SynonymsRemoved int    `json:"synonymsRemoved"`
+	SynonymsChanged int    `json:"synonymsChanged"` // synonyms which have gained or lost entries
+}
+
+// diffRecords compares the (synonym, lookup) records of the current and next dictionaries, which must be sorted and
+// unique, and calls onRecord with every record of either and its status. It returns a report of the synonyms which
+// have changed. Entries are counted by countEntries.
+func diffRecords(current, next recordIterator, onRecord func(status string, r record) error) (deltaReport, error) {
+	var report deltaReport
+
+	// the number of records of the synonym being compared with each status.
+	synonym := ""
+	counts := make(map[string]int)
+	countSynonym := func() {
+		inCurrent := counts[keptStatus]+counts[removedStatus] > 0
+		inNext := counts[keptStatus]+counts[addedStatus] > 0
+		switch {
+		case !inCurrent && inNext:
+			report.SynonymsAdded++
+		case inCurrent && !inNext:
+			report.SynonymsRemoved++
+		case counts[addedStatus]+counts[removedStatus] > 0:
+			report.SynonymsChanged++
+		}
+		counts = make(map[string]int)
+	}
+
+	c, inCurrent, err := current.next()
+	if err != nil {
+		return report, err
+	}
+	n, inNext, err := next.next()
+	if err != nil {
+		return report, err
+	}
+	for inCurrent || inNext {
+		var r record
+		var status string
+		switch {
+		case inCurrent && (!inNext || c.less(n)):
+			r, status = c, removedStatus
+			c, inCurrent, err = current.next()
+		case inNext && (!inCurrent || n.less(c)):
+			r, status = n, addedStatus
+			n, inNext, err = next.next()
+		default:
+			r, status = c, keptStatus
+			if c, inCurrent, err = current.next(); err == nil {
+				n, inNext, err = next.next()
+			}
+		}
+		if err != nil {
+			return report, err
+		}
+
+		if r.key != synonym {
+			countSynonym()
+			synonym = r.key
+		}
+		counts[status]++
+		if err := onRecord(status, r); err != nil {
+			return report, err
+		}
+	}
+	countSynonym()
+	return report, nil
+}
+
+// countEntries counts the entries which have been added, removed or changed, given the statuses of their records as
+// (lookup, status) records, sorted and unique.
+func countEntries(statuses recordIterator, report *deltaReport) error {
+	lookup := ""
+	has := make(map[string]bool)
+	countEntry := func() {
+		switch {
+		case has[addedStatus] && !has[removedStatus] && !has[keptStatus]:
+			report.EntriesAdded++
+		case has[removedStatus] && !has[addedStatus] && !has[keptStatus]:
+			report.EntriesRemoved++
+		case has[addedStatus] || has[removedStatus]:
+			report.EntriesChanged++
+		}
+		has = make(map[string]bool)
+	}
+
+	err := eachRecord(statuses, func(r record) error {
+		if r.key != lookup {
+			countEntry()
+			lookup = r.key
+		}
+		has[r.value] = true
+		return nil
+	})
+	countEntry()
+	return err
+}
+
+// eachRecord calls onRecord with each of records.
+func eachRecord(records recordIterator, onRecord func(r record) error) error {
+	for {
+		r, ok, err := records.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := onRecord(r); err != nil {
+			return err
+		}
+	}
+}
+
+// sortDictionary adds a (synonym, lookup) record for every synonym of every entry of the dictionary at
+// dictConfig.Path, normalised as an import normalises them, to sorter. It returns the number of entries.
+func sortDictionary(ctx context.Context, dictConfig dict.DictConfig, sorter *recordSorter) (int, error) {
+	entries := 0
+	onEntry := func(entry dict.Entry) error {
+		entries++
+		normaliseSynonyms(entry)
+		lookup, err := newLookup(entry)
+		if err != nil {
+			return err
+		}
+		for _, synonym := range entry.GetSynonyms() {
+			if err := sorter.add(record{key: synonym, value: string(lookup)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := dict.EachInput(ctx, dictConfig, func(input io.Reader) error {
+		return dict.ReadWithCallback(input, dictConfig, onEntry, nil)
+	})
+	return entries, err
+}
+
+// deltaImport compares the dictionary with the active version and applies only the synonyms and lookups which have
+// been added or removed to the active version, along with its new manifest, in a single transaction. Readers see
+// either the whole delta or none of it, and an interrupted delta import leaves the active version as it was. The
+// active version is updated in place, so rolling back goes to the version which was active before it.
+//
+// Neither the dictionary nor the active version is held in memory: both are sorted in chunks of
+// config.Delta.ChunkSize synonyms and lookups, written to temporary files, and merged. The changes themselves are held
+// in memory while they are sent to redis, so a dictionary which has changed a lot is better imported in full.
+func deltaImport(ctx context.Context, redisClient remote.Client) (deltaReport, error) {
+	manifests, active, err := redisClient.Manifests(config.Dictionary.Name)
+	if err != nil {
+		return deltaReport{}, err
+	}
+	var current remote.Manifest
+	for _, m := range manifests {
+		if m.Version == active {
+			current = m
+		}
+	}
+	if current.Version == "" {
+		return deltaReport{}, fmt.Errorf("dictionary %s has no active version to compare with, so it must be imported in full", config.Dictionary.Name)
+	}
+	report := deltaReport{Dictionary: config.Dictionary.Name, Version: current.Version}
+
+	checksum, err := dict.Checksum(ctx, config.Dictionary)
+	if err != nil {
+		return report, err
+	}
+	if checksum == current.Checksum {
+		log.Info().Str("checksum", checksum).Msg("the dictionary hasn't changed since it was imported")
+		return report, nil
+	}
+
+	dir, chunkSize := config.Delta.TempDir, config.Delta.ChunkSize
+	nextSorter := newRecordSorter(dir, chunkSize)
+	defer nextSorter.close()
+	entries, err := sortDictionary(ctx, config.Dictionary, nextSorter)
+	if err != nil {
+		return report, err
+	}
+	next, err := nextSorter.sorted()
+	if err != nil {
+		return report, err
+	}
+
+	namespace := remote.VersionNamespace(config.Dictionary.Name, current.Version)
+	currentSorter := newRecordSorter(dir, chunkSize)
+	defer currentSorter.close()
+	err = redisClient.ReadNamespace(namespace, func(synonym string, lookups []string) error {
+		for _, lookup := range lookups {
+			if err := currentSorter.add(record{key: synonym, value: lookup}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	currentRecords, err := currentSorter.sorted()
+	if err != nil {
+		return report, err
+	}
+
+	additions, err := newRecordFile(dir)
+	if err != nil {
+		return report, err
+	}
+	defer additions.close()
+	removals, err := newRecordFile(dir)
+	if err != nil {
+		return report, err
+	}
+	defer removals.close()
+	statuses := newRecordSorter(dir, chunkSize)
+	defer statuses.close()
+
+	changes := 0
+	diffReport, err := diffRecords(currentRecords, next, func(status string, r record) error {
+		switch status {
+		case addedStatus:
+			changes++
+			if err := additions.write(r); err != nil {
+				return err
+			}
+		case removedStatus:
+			changes++
+			if err := removals.write(r); err != nil {
+				return err
+			}
+		}
+		return statuses.add(record{key: r.value, value: status})
+	})
+	if err != nil {
+		return report, err
+	}
+	sortedStatuses, err := statuses.sorted()
+	if err != nil {
+		return report, err
+	}
+	if err := countEntries(sortedStatuses, &diffReport); err != nil {
+		return report, err
+	}
+	diffReport.Dictionary, diffReport.Version = report.Dictionary, report.Version
+
+	if err := additions.rewind(); err != nil {
+		return report, err
+	}
+	if err := removals.rewind(); err != nil {
+		return report, err
+	}
+	manifest := current
+	manifest.SourcePath = config.Dictionary.Path
+	manifest.Format = string(config.Dictionary.Format)
+	manifest.Entries = entries
+	manifest.Checksum = checksum
+	manifest.ImportedAt = time.Now().UTC()
+	log.Info().Str("dictionary", config.Dictionary.Name).Str("version", current.Version).Int("changes", changes).Msg("applying changes to active version")
+
+	err = redisClient.UpdateActive(manifest, func(pipeline remote.SetPipeline) error {
+		err := eachRecord(removals, func(r record) error {
+			pipeline.Remove(namespace, r.key, []byte(r.value))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return eachRecord(additions, func(r record) error {
+			pipeline.Add(namespace, r.key, []byte(r.value))
+			return nil
+		})
+	})
+	if err != nil {
+		return report, err
+	}
+	log.Info().Interface("manifest", manifest).Msg("updated active version")
+	return diffReport, nil
+}
+
+// writeReport writes report to path as JSON.
+func writeReport(report deltaReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	mocks "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/mocks/lib/cache/remote"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/cache/remote"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+)
+
+// sortRecords returns an iterator of the (synonym, lookup) records of synonymLookups, sorted.
+func sortRecords(t *testing.T, synonymLookups map[string][]string) recordIterator {
+	sorter := newRecordSorter(t.TempDir(), 2)
+	t.Cleanup(sorter.close)
+	for synonym, lookups := range synonymLookups {
+		for _, lookup := range lookups {
+			require.NoError(t, sorter.add(record{key: synonym, value: lookup}))
+		}
+	}
+	records, err := sorter.sorted()
+	require.NoError(t, err)
+	return records
+}
+
+func Test_diffRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     map[string][]string
+		next        map[string][]string
+		wantAdded   []record
+		wantRemoved []record
+		wantReport  deltaReport
+	}{
+		{
+			name:       "unchanged",
+			current:    map[string][]string{"aspirin": {"a"}},
+			next:       map[string][]string{"aspirin": {"a"}},
+			wantReport: deltaReport{},
+		},
+		{
+			name:       "entry added",
+			current:    map[string][]string{"aspirin": {"a"}},
+			next:       map[string][]string{"aspirin": {"a"}, "caffeine": {"c"}},
+			wantAdded:  []record{{"caffeine", "c"}},
+			wantReport: deltaReport{EntriesAdded: 1, SynonymsAdded: 1},
+		},
+		{
+			name:        "entry removed",
+			current:     map[string][]string{"aspirin": {"a"}, "caffeine": {"c"}},
+			next:        map[string][]string{"aspirin": {"a"}},
+			wantRemoved: []record{{"caffeine", "c"}},
+			wantReport:  deltaReport{EntriesRemoved: 1, SynonymsRemoved: 1},
+		},
+		{
+			name:       "entry gains a synonym shared with another entry",
+			current:    map[string][]string{"aspirin": {"a"}, "asa": {"b"}},
+			next:       map[string][]string{"aspirin": {"a"}, "asa": {"a", "b"}},
+			wantAdded:  []record{{"asa", "a"}},
+			wantReport: deltaReport{EntriesChanged: 1, SynonymsChanged: 1},
+		},
+		{
+			name:        "entry loses a synonym",
+			current:     map[string][]string{"aspirin": {"a"}, "asa": {"a"}},
+			next:        map[string][]string{"aspirin": {"a"}},
+			wantRemoved: []record{{"asa", "a"}},
+			wantReport:  deltaReport{EntriesChanged: 1, SynonymsRemoved: 1},
+		},
+		{
+			name:        "entry's lookup changes",
+			current:     map[string][]string{"aspirin": {"a"}, "asa": {"a"}},
+			next:        map[string][]string{"aspirin": {"a2"}, "asa": {"a2"}},
+			wantAdded:   []record{{"asa", "a2"}, {"aspirin", "a2"}},
+			wantRemoved: []record{{"asa", "a"}, {"aspirin", "a"}},
+			wantReport:  deltaReport{EntriesAdded: 1, EntriesRemoved: 1, SynonymsChanged: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added, removed []record
+			statuses := newRecordSorter(t.TempDir(), 2)
+			defer statuses.close()
+			report, err := diffRecords(sortRecords(t, tt.current), sortRecords(t, tt.next), func(status string, r record) error {
+				switch status {
+				case addedStatus:
+					added = append(added, r)
+				case removedStatus:
+					removed = append(removed, r)
+				}
+				return statuses.add(record{key: r.value, value: status})
+			})
+			require.NoError(t, err)
+			sortedStatuses, err := statuses.sorted()
+			require.NoError(t, err)
+			require.NoError(t, countEntries(sortedStatuses, &report))
+
+			// only the changes are returned, in order.
+			assert.Equal(t, tt.wantAdded, added)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, tt.wantReport, report)
+		})
+	}
+}
+
+func Test_deltaImport(t *testing.T) {
+	config.Dictionary.Name = "test"
+	config.Delta.ChunkSize = 1
+	config.Delta.TempDir = t.TempDir()
+	file, err := ioutil.TempFile("", "dictionary-*.jsonl")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`{"Synonyms":["caffeine"],"Identifiers":{"id":"2"}}
+{"Synonyms":["paracetamol"],"Identifiers":{"id":"3"}}
+`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	config.Dictionary.Path = file.Name()
+	config.Dictionary.Format = dict.NativeDictionaryFormat
+
+	aspirin := `{"dictionary":"test","identifiers":{"id":"1"},"metadata":null}`
+	caffeine := `{"dictionary":"test","identifiers":{"id":"2"},"metadata":null}`
+	paracetamol := `{"dictionary":"test","identifiers":{"id":"3"},"metadata":null}`
+
+	// only the changes are applied to the active version: caffeine is neither removed nor added again.
+	pipeline := &mocks.SetPipeline{}
+	pipeline.On("Remove", "test@1", "aspirin", []byte(aspirin)).Return().Once()
+	pipeline.On("Add", "test@1", "paracetamol", []byte(paracetamol)).Return().Once()
+
+	client := &mocks.Client{}
+	client.On("Manifests", "test").Return([]remote.Manifest{{Dictionary: "test", Version: "1", Checksum: "old"}}, "1", nil)
+	client.On("ReadNamespace", "test@1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		onSynonym := args[1].(func(string, []string) error)
+		require.NoError(t, onSynonym("aspirin", []string{aspirin}))
+		require.NoError(t, onSynonym("caffeine", []string{caffeine}))
+	})
+	client.On("UpdateActive", mock.MatchedBy(func(manifest remote.Manifest) bool {
+		return manifest.Version == "1" && manifest.Entries == 2 && manifest.Checksum != "old"
+	}), mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+		update := args[1].(func(remote.SetPipeline) error)
+		require.NoError(t, update(pipeline))
+	})
+
+	report, err := deltaImport(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, deltaReport{Dictionary: "test", Version: "1", EntriesAdded: 1, EntriesRemoved: 1, SynonymsAdded: 1, SynonymsRemoved: 1}, report)
+	client.AssertExpectations(t)
+	pipeline.AssertExpectations(t)
+
+	// the temporary files are deleted.
+	tempFiles, err := ioutil.ReadDir(config.Delta.TempDir)
+	require.NoError(t, err)
+	assert.Empty(t, tempFiles)
+}
+
+func Test_sortDictionary(t *testing.T) {
+	config.Dictionary.Name = "test"
+	file, err := ioutil.TempFile("", "dictionary-*.jsonl")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`{"Synonyms":["Aspirin","ASA"],"Identifiers":{"id":"1"}}
+{"Synonyms":["asa"],"Identifiers":{"id":"2"}}
+`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	sorter := newRecordSorter(t.TempDir(), 2)
+	defer sorter.close()
+	entries, err := sortDictionary(context.Background(), dict.DictConfig{Path: file.Name(), Format: dict.NativeDictionaryFormat}, sorter)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entries)
+
+	records, err := sorter.sorted()
+	require.NoError(t, err)
+	var got []record
+	require.NoError(t, eachRecord(records, func(r record) error {
+		got = append(got, r)
+		return nil
+	}))
+	first := `{"dictionary":"test","identifiers":{"id":"1"},"metadata":null}`
+	second := `{"dictionary":"test","identifiers":{"id":"2"},"metadata":null}`
+	assert.Equal(t, []record{{"asa", first}, {"asa", second}, {"aspirin", first}}, got)
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+)
+
+// lintConfig configures the checks made by the lint action.
+type lintConfig struct {
+	// MinSynonymLength is the number of characters a normalised synonym must have not to be reported as short.
+	MinSynonymLength int `mapstructure:"min_synonym_length"`
+	// Blocklist is the path of a blocklist, e.g. the recognition API's global blocklist. Synonyms on it are reported.
+	Blocklist string
+	// MaxProblems is how many problems of each kind are listed. Every problem is counted.
+	MaxProblems int `mapstructure:"max_problems"`
+}
+
+type lintCheck string
+
+const (
+	malformedRowCheck       lintCheck = "malformed_row"       // a row the reader skipped
+	noIdentifiersCheck      lintCheck = "no_identifiers"      // an entry without identifiers
+	emptySynonymCheck       lintCheck = "empty_synonym"       // a synonym which is empty once normalised
+	shortSynonymCheck       lintCheck = "short_synonym"       // a synonym shorter than lint.min_synonym_length
+	numericSynonymCheck     lintCheck = "numeric_synonym"     // a synonym without letters, e.g. "1.5"
+	blocklistedSynonymCheck lintCheck = "blocklisted_synonym" // a synonym on lint.blocklist
+	synonymCollisionCheck   lintCheck = "synonym_collision"   // a synonym of more than one entry
+)
+
+type lintSeverity string
+
+const (
+	lintError   lintSeverity = "error"   // the dictionary shouldn't be imported
+	lintWarning lintSeverity = "warning" // the dictionary can be imported, but should be looked at
+)
+
+var lintSeverities = map[lintCheck]lintSeverity{
+	malformedRowCheck:       lintError,
+	noIdentifiersCheck:      lintError,
+	emptySynonymCheck:       lintWarning,
+	shortSynonymCheck:       lintWarning,
+	numericSynonymCheck:     lintWarning,
+	blocklistedSynonymCheck: lintWarning,
+	synonymCollisionCheck:   lintWarning,
+}
+
+// lintProblem is a problem with a dictionary. Entries are numbered from 1 in the order they are read.
+type lintProblem struct {
+	Check    lintCheck    `json:"check"`
+	Severity lintSeverity `json:"severity"`
+	Message  string       `json:"message,omitempty"`
+	Row      int          `json:"row,omitempty"`
+	Entry    int          `json:"entry,omitempty"`
+	Synonym  string       `json:"synonym,omitempty"`
+	// OtherEntry is the first entry with a colliding synonym.
+	OtherEntry int `json:"otherEntry,omitempty"`
+}
+
+// lintReport is the machine readable result of the lint action.
+type lintReport struct {
+	Dictionary string            `json:"dictionary"`
+	Path       string            `json:"path"`
+	Format     dict.Format       `json:"format"`
+	Entries    int               `json:"entries"`
+	Synonyms   int               `json:"synonyms"`
+	Errors     int               `json:"errors"`
+	Warnings   int               `json:"warnings"`
+	Counts     map[lintCheck]int `json:"counts"` // the number of problems found by each check
+	Problems   []lintProblem     `json:"problems"`
+	Passed     bool              `json:"passed"` // whether there are no errors
+}
+
+// linter checks each entry of a dictionary as it is read.
+type linter struct {
+	config    lintConfig
+	blocklist *blocklist.Blocklist
+	report    lintReport
+	synonyms  map[string]int // the first entry with each normalised synonym
+}
+
+func newLinter(dictConfig dict.DictConfig, config lintConfig, bl *blocklist.Blocklist) *linter {
+	return &linter{
+		config:    config,
+		blocklist: bl,
+		report: lintReport{
+			Dictionary: dictConfig.Name,
+			Path:       dictConfig.Path,
+			Format:     dictConfig.Format,
+			Counts:     make(map[lintCheck]int),
+			Problems:   []lintProblem{},
+		},
+		synonyms: make(map[string]int),
+	}
+}
+
+func (l *linter) add(problem lintProblem) {
+	problem.Severity = lintSeverities[problem.Check]
+	l.report.Counts[problem.Check]++
+	if problem.Severity == lintError {
+		l.report.Errors++
+	} else {
+		l.report.Warnings++
+	}
+	if l.report.Counts[problem.Check] <= l.config.MaxProblems {
+		l.report.Problems = append(l.report.Problems, problem)
+	}
+}
+
+func (l *linter) onRowError(err dict.RowError) error {
+	l.add(lintProblem{Check: malformedRowCheck, Row: err.Row, Message: err.Err.Error()})
+	return nil
+}
+
+func (l *linter) onEntry(entry dict.Entry) error {
+	l.report.Entries++
+	number := l.report.Entries
+
+	if len(entry.GetIdentifiers()) == 0 {
+		l.add(lintProblem{Check: noIdentifiersCheck, Entry: number})
+	}
+
+	for _, synonym := range entry.GetSynonyms() {
+		l.report.Synonyms++
+		normalised := strings.Join(text.NormalizeAndLowercaseTokens(synonym), " ")
+
+		if normalised == "" {
+			l.add(lintProblem{Check: emptySynonymCheck, Entry: number, Synonym: synonym})
+			continue
+		}
+		if utf8.RuneCountInString(normalised) < l.config.MinSynonymLength {
+			l.add(lintProblem{Check: shortSynonymCheck, Entry: number, Synonym: synonym})
+		}
+		if strings.IndexFunc(normalised, unicode.IsLetter) < 0 {
+			l.add(lintProblem{Check: numericSynonymCheck, Entry: number, Synonym: synonym})
+		}
+		if l.blocklist != nil && (!l.blocklist.Allowed(synonym) || !l.blocklist.Allowed(normalised)) {
+			l.add(lintProblem{Check: blocklistedSynonymCheck, Entry: number, Synonym: synonym})
+		}
+
+		if first, ok := l.synonyms[normalised]; !ok {
+			l.synonyms[normalised] = number
+		} else if first != number {
+			l.add(lintProblem{Check: synonymCollisionCheck, Entry: number, Synonym: synonym, OtherEntry: first})
+		}
+	}
+	return nil
+}
+
+// lintDictionary reads the dictionary described by dictConfig and reports its problems, without touching redis. An
+// error is only returned if the dictionary can't be read at all.
+func lintDictionary(ctx context.Context, dictConfig dict.DictConfig, config lintConfig) (lintReport, error) {
+	var bl *blocklist.Blocklist
+	if config.Blocklist != "" {
+		var err error
+		if bl, err = blocklist.Load(config.Blocklist); err != nil {
+			return lintReport{}, err
+		}
+	}
+
+	l := newLinter(dictConfig, config, bl)
+	_, err := dict.EachInput(ctx, dictConfig, func(input io.Reader) error {
+		return dict.ReadWithRowErrors(input, dictConfig, l.onEntry, l.onRowError)
+	})
+	if err != nil {
+		return l.report, err
+	}
+	l.report.Passed = l.report.Errors == 0
+	return l.report, nil
+}
+
+// saveLintReport writes report as JSON to the file at path, or to stdout if path is empty.
+func saveLintReport(report lintReport, path string) error {
+	if path == "" {
+		return writeLintReport(report, os.Stdout)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeLintReport(report, file)
+}
+
+// writeLintReport writes report as JSON to w.
+func writeLintReport(report lintReport, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
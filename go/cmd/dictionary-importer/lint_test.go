@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+)
+
+// tempFile writes contents to a temporary file, which is removed when the test finishes.
+func tempFile(t *testing.T, pattern, contents string) string {
+	file, err := ioutil.TempFile("", pattern)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	_, err = file.WriteString(contents)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	return file.Name()
+}
+
+func Test_lintDictionary(t *testing.T) {
+	path := tempFile(t, "dictionary-*.jsonl", `{"Synonyms":["Aspirin","(.)","ASA","gene"],"Identifiers":{"id":"1"}}
+{"Synonyms":["aspirin","12.5"],"Identifiers":{"id":"2"}}
+{"Synonyms":["water"]}
+`)
+	blocklistPath := tempFile(t, "blocklist-*.yml", "case_sensitive: []\ncase_insensitive:\n  - gene\n")
+
+	report, err := lintDictionary(
+		context.Background(),
+		dict.DictConfig{Name: "test", Path: path, Format: dict.NativeDictionaryFormat},
+		lintConfig{MinSynonymLength: 4, Blocklist: blocklistPath, MaxProblems: 100},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Entries)
+	assert.Equal(t, 7, report.Synonyms)
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, 5, report.Warnings)
+	assert.False(t, report.Passed)
+	assert.Equal(t, []lintProblem{
+		{Check: emptySynonymCheck, Severity: lintWarning, Entry: 1, Synonym: "(.)"},
+		{Check: shortSynonymCheck, Severity: lintWarning, Entry: 1, Synonym: "ASA"},
+		{Check: blocklistedSynonymCheck, Severity: lintWarning, Entry: 1, Synonym: "gene"},
+		{Check: synonymCollisionCheck, Severity: lintWarning, Entry: 2, Synonym: "aspirin", OtherEntry: 1},
+		{Check: numericSynonymCheck, Severity: lintWarning, Entry: 2, Synonym: "12.5"},
+		{Check: noIdentifiersCheck, Severity: lintError, Entry: 3},
+	}, report.Problems)
+}
+
+func Test_lintDictionary_MalformedRows(t *testing.T) {
+	path := tempFile(t, "dictionary-*.tsv", "1\taspirin\nnot a row\n1\tacetylsalicylic acid\nx\ty\n")
+
+	report, err := lintDictionary(
+		context.Background(),
+		dict.DictConfig{Name: "test", Path: path, Format: dict.PubchemDictionaryFormat},
+		lintConfig{MaxProblems: 1},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Entries)
+	assert.Equal(t, 2, report.Counts[malformedRowCheck])
+	// only the first is listed
+	assert.Equal(t, []lintProblem{
+		{Check: malformedRowCheck, Severity: lintError, Row: 2, Message: "invalid number of columns"},
+	}, report.Problems)
+	assert.False(t, report.Passed)
+}
@@ -14,8 +14,12 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -28,17 +32,49 @@ import (
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
 )
 
+type importerAction string
+
+const (
+	importAction   importerAction = "import"   // import the dictionary as a new version and make it active
+	rollbackAction importerAction = "rollback" // make the version before the active one active again
+	versionsAction importerAction = "versions" // list the dictionary's versions
+	deltaAction    importerAction = "delta"    // apply only the changes since the active version was imported to it
+	lintAction     importerAction = "lint"     // report problems with the dictionary without importing it
+)
+
 // config structure
 type dictionaryImporterConfig struct {
 	lib.BaseConfig
 	Dictionary   dict.DictConfig
 	PipelineSize int `mapstructure:"pipeline_size"`
 	Redis        remote.RedisConfig
+	// KeepVersions is how many versions of the dictionary, besides the active one, are kept to roll back to.
+	KeepVersions int `mapstructure:"keep_versions"`
+	Lint         lintConfig
+	Delta        deltaConfig
+	// Workers is how many goroutines normalise entries, and Executors how many pipelines are executed at once.
+	Workers   int
+	Executors int
+	// CheckpointEvery is how many entries are imported between checkpoints, or 0 to not save checkpoints.
+	CheckpointEvery  int           `mapstructure:"checkpoint_every"`
+	ProgressInterval time.Duration `mapstructure:"progress_interval"` // how often the import's progress is logged
 }
 
 var defaultConfig = map[string]interface{}{
-	"log_level":     "info",
-	"pipeline_size": 10000,
+	"log_level":         "info",
+	"pipeline_size":     10000,
+	"keep_versions":     1,
+	"workers":           4,
+	"executors":         4,
+	"checkpoint_every":  100000,
+	"progress_interval": "10s",
+	"lint": map[string]interface{}{
+		"min_synonym_length": 3,
+		"max_problems":       100,
+	},
+	"delta": map[string]interface{}{
+		"chunk_size": 1000000,
+	},
 	"dictionary": map[string]interface{}{
 		"name":   "pubchem_synonyms",
 		"path":   "./dictionaries/pubchem.tsv",
@@ -59,102 +95,288 @@ func main() {
 		log.Fatal().Err(err).Send()
 	}
 
-	for _, arg := range os.Args {
+	action := importAction
+	reportPath := ""
+	for _, arg := range os.Args[1:] {
+
+		switch arg {
+		case string(rollbackAction), string(versionsAction), string(deltaAction), string(lintAction):
+			action = importerAction(arg)
+		}
 
 		if strings.Contains(arg, "=") {
-			k := strings.Split(arg, "=")[0]
-			v := strings.Split(arg, "=")[1]
+			// values, e.g. URLs, can contain "=" too
+			k := strings.SplitN(arg, "=", 2)[0]
+			v := strings.SplitN(arg, "=", 2)[1]
 			switch k {
 			case "dictionaryPath":
 				config.Dictionary.Path = v
 			case "dictionaryFormat":
 				config.Dictionary.Format = dict.Format(v)
+			case "dictionaryName":
+				config.Dictionary.Name = v
+			case "reportPath":
+				reportPath = v
 			}
 
 		}
 	}
 
+	ctx := context.Background()
+
+	// linting doesn't need redis
+	if action == lintAction {
+		lint(ctx, reportPath)
+		return
+	}
+
 	// Get a redis client
 	var redisClient = remote.NewRedisClient(config.Redis)
-	var err error
+	awaitDB(redisClient)
 
-	dictFile, err := os.Open(config.Dictionary.Path)
+	switch action {
+	case rollbackAction:
+		manifest, err := redisClient.Rollback(config.Dictionary.Name)
+		if err != nil {
+			log.Fatal().Str("dictionary", config.Dictionary.Name).Err(err).Msg("failed to roll back")
+		}
+		log.Info().Interface("manifest", manifest).Msg("rolled back")
+	case versionsAction:
+		manifests, active, err := redisClient.Manifests(config.Dictionary.Name)
+		if err != nil {
+			log.Fatal().Str("dictionary", config.Dictionary.Name).Err(err).Msg("failed to list versions")
+		}
+		for _, manifest := range manifests {
+			log.Info().Bool("active", manifest.Version == active).Interface("manifest", manifest).Send()
+		}
+	case deltaAction:
+		report, err := deltaImport(ctx, redisClient)
+		if err != nil {
+			log.Fatal().Str("dictionary", config.Dictionary.Name).Err(err).Msg("failed to apply changes")
+		}
+		log.Info().Interface("report", report).Msg("applied changes")
+		if reportPath != "" {
+			if err := writeReport(report, reportPath); err != nil {
+				log.Fatal().Str("path", reportPath).Err(err).Msg("failed to write report")
+			}
+		}
+	default:
+		if err := importDictionary(ctx, redisClient); err != nil {
+			log.Fatal().Str("dictionary", config.Dictionary.Name).Err(err).Msg("failed to import")
+		}
+	}
+}
+
+// lint writes the lint report for the dictionary to reportPath, or stdout, and exits with status 1 if it has errors.
+func lint(ctx context.Context, reportPath string) {
+	report, err := lintDictionary(ctx, config.Dictionary, config.Lint)
 	if err != nil {
-		log.Fatal().Str("path", config.Dictionary.Path).Err(err).Send()
+		log.Fatal().Str("dictionary", config.Dictionary.Name).Err(err).Msg("failed to read dictionary")
+	}
+
+	if err := saveLintReport(report, reportPath); err != nil {
+		log.Fatal().Str("path", reportPath).Err(err).Msg("failed to write report")
 	}
 
-	entries := 0
-	pipeline := redisClient.NewSetPipeline(config.PipelineSize)
-	onEntry := func(entry dict.Entry) error {
+	log.Info().Int("errors", report.Errors).Int("warnings", report.Warnings).Interface("counts", report.Counts).Msg("linted dictionary")
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
 
-		entries++
+// importDictionary imports the dictionary into a new version, then makes it the active version once it has been
+// completely imported. Versions older than config.KeepVersions are deleted. An import which is interrupted can be
+// resumed from its last checkpoint, see startImport.
+func importDictionary(ctx context.Context, redisClient remote.Client) error {
+	stat, err := dict.StatInputs(ctx, config.Dictionary)
+	if err != nil {
+		return err
+	}
+
+	checkpoint, resumed, err := startImport(redisClient, stat)
+	if err != nil {
+		return err
+	}
+	version := checkpoint.Version
+	namespace := remote.VersionNamespace(config.Dictionary.Name, version)
+	if resumed {
+		log.Info().Str("dictionary", config.Dictionary.Name).Str("version", version).Int("entries", checkpoint.Entries).Msg("resuming import from checkpoint")
+	} else {
+		log.Info().Str("dictionary", config.Dictionary.Name).Str("version", version).Msg("importing new version")
+	}
 
-		if entries%50000 == 0 {
-			log.Info().Int("entries", entries).Msg("importing")
+	progress := newImportProgress(stat.Size, checkpoint.Entries)
+	stopProgress := make(chan struct{})
+	defer close(stopProgress)
+	go progress.logEvery(config.ProgressInterval, stopProgress)
+
+	imported, saved := checkpoint.Entries, checkpoint.Entries
+	saveCheckpoint := func() error {
+		checkpoint.Entries = imported
+		checkpoint.SavedAt = time.Now().UTC()
+		if err := redisClient.SaveCheckpoint(checkpoint); err != nil {
+			return err
 		}
+		saved = imported
+		return nil
+	}
+
+	importer := &parallelImporter{
+		client:       redisClient,
+		namespace:    namespace,
+		workers:      config.Workers,
+		executors:    config.Executors,
+		pipelineSize: config.PipelineSize,
+		skip:         checkpoint.Entries,
+		onImported: func(entries int) error {
+			imported = entries
+			progress.imported(entries)
+			if config.CheckpointEvery > 0 && imported-saved >= config.CheckpointEvery {
+				return saveCheckpoint()
+			}
+			return nil
+		},
+	}
+
+	checksum := ""
+	entries, err := importer.run(func(onEntry func(entry dict.Entry) error) error {
+		var err error
+		checksum, err = dict.EachInputWithProgress(ctx, config.Dictionary, progress, func(input io.Reader) error {
+			return dict.ReadWithCallback(input, config.Dictionary, onEntry, nil)
+		})
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("Could not read source file into %s. Are you sure this format is correct?", config.Dictionary.Format)
+		log.Error().Err(err).Msg(msg)
 
-		for i, synonym := range entry.GetSynonyms() {
-			tokens := strings.Fields(synonym)
-			normalizedTokens := make([]string, 0, len(tokens))
-			for _, token := range tokens {
-				normalizedToken, _ := text.NormalizeAndLowercaseString(token)
-				if len(normalizedToken) > 0 {
-					normalizedTokens = append(normalizedTokens, normalizedToken)
+		if config.CheckpointEvery > 0 && imported > 0 {
+			if imported > saved {
+				if saveErr := saveCheckpoint(); saveErr != nil {
+					log.Error().Err(saveErr).Str("version", version).Msg("failed to save checkpoint")
 				}
 			}
-			entry.ReplaceSynonymAt(strings.Join(normalizedTokens, " "), i)
+			log.Info().Str("version", version).Int("entries", saved).Msg("run the import again to resume it from its checkpoint")
+			return err
 		}
 
-		if err := addToPipe(entry, pipeline); err != nil {
-			return err
+		// the version was never activated, so nothing is reading it.
+		if deleteErr := redisClient.DeleteVersion(config.Dictionary.Name, version); deleteErr != nil {
+			log.Error().Err(deleteErr).Str("version", version).Msg("failed to delete incomplete version")
 		}
+		if deleteErr := redisClient.DeleteCheckpoint(config.Dictionary.Name); deleteErr != nil {
+			log.Error().Err(deleteErr).Msg("failed to delete checkpoint")
+		}
+		return err
+	}
+	progress.log()
 
-		if pipeline.Size() > config.PipelineSize {
-			awaitDB(redisClient)
-			if err := pipeline.ExecSet(); err != nil {
-				return err
-			}
+	manifest := remote.Manifest{
+		Dictionary: config.Dictionary.Name,
+		Version:    version,
+		SourcePath: config.Dictionary.Path,
+		Format:     string(config.Dictionary.Format),
+		Entries:    entries,
+		Checksum:   checksum,
+		ImportedAt: time.Now().UTC(),
+	}
+	if err := redisClient.Activate(manifest); err != nil {
+		return err
+	}
+	log.Info().Interface("manifest", manifest).Msg("activated new version")
 
-			pipeline = redisClient.NewSetPipeline(config.PipelineSize)
-		}
+	deleted, err := redisClient.PruneVersions(config.Dictionary.Name, config.KeepVersions)
+	if err != nil {
+		return err
+	}
+	if len(deleted) > 0 {
+		log.Info().Strs("versions", deleted).Msg("deleted old versions")
+	}
+	return nil
+}
 
-		return nil
+// startImport returns the checkpoint to import the dictionary from, and whether it is resuming an earlier import. An
+// interrupted import is resumed from its checkpoint if the dictionary's files and config are unchanged, otherwise its
+// version is deleted and the import starts from the beginning of a new version.
+func startImport(redisClient remote.Client, stat dict.InputStat) (remote.Checkpoint, bool, error) {
+	fingerprint, err := importFingerprint(stat)
+	if err != nil {
+		return remote.Checkpoint{}, false, err
 	}
 
-	onEOF := func() error {
-		if pipeline.Size() > 0 {
-			return pipeline.ExecSet()
+	checkpoint, ok, err := redisClient.Checkpoint(config.Dictionary.Name)
+	if err != nil {
+		return remote.Checkpoint{}, false, err
+	}
+	if ok {
+		if config.CheckpointEvery > 0 && checkpoint.Fingerprint == fingerprint {
+			return checkpoint, true, nil
+		}
+		log.Info().Interface("checkpoint", checkpoint).Msg("discarding checkpoint of an import of a different dictionary")
+		if err := redisClient.DeleteVersion(config.Dictionary.Name, checkpoint.Version); err != nil {
+			return remote.Checkpoint{}, false, err
+		}
+		if err := redisClient.DeleteCheckpoint(config.Dictionary.Name); err != nil {
+			return remote.Checkpoint{}, false, err
 		}
+	}
 
-		return nil
+	version, err := redisClient.NewVersion(config.Dictionary.Name)
+	if err != nil {
+		return remote.Checkpoint{}, false, err
 	}
+	return remote.Checkpoint{
+		Dictionary:  config.Dictionary.Name,
+		Version:     version,
+		SourcePath:  config.Dictionary.Path,
+		Format:      string(config.Dictionary.Format),
+		Fingerprint: fingerprint,
+	}, false, nil
+}
 
-	if err := dict.ReadWithCallback(dictFile, config.Dictionary.Format, onEntry, onEOF); err != nil {
-		msg := fmt.Sprintf("Could not read source file into %s. Are you sure this format is correct?", config.Dictionary.Format)
-		log.Fatal().Err(err).Msg(msg)
+// importFingerprint identifies the files of the dictionary, and the config they are read with, so that a checkpoint is
+// only resumed if the same entries will be read again.
+func importFingerprint(stat dict.InputStat) (string, error) {
+	dictConfig, err := json.Marshal(config.Dictionary)
+	if err != nil {
+		return "", err
 	}
+	fingerprint := sha256.Sum256(append([]byte(stat.Fingerprint+"\n"), dictConfig...))
+	return hex.EncodeToString(fingerprint[:]), nil
 }
 
-func addToPipe(entry dict.Entry, pipe remote.SetPipeline) error {
-	// Mid process, some stuff to do
+// addToPipe adds entry's lookup to each of its synonyms in namespace. Synonyms which are already in the namespace, from
+// another entry, keep their other lookups.
+func addToPipe(entry dict.Entry, pipe remote.SetPipeline, namespace string) error {
+	lookup, err := newLookup(entry)
+	if err != nil {
+		return err
+	}
 	for _, synonym := range entry.GetSynonyms() {
+		pipe.Add(namespace, synonym, lookup)
+	}
+	return nil
+}
 
-		metadata, err := json.Marshal(entry.GetMetadata())
-		if err != nil {
-			return err
-		}
+// normaliseSynonyms replaces entry's synonyms with the normalised text that tokens are looked up by.
+func normaliseSynonyms(entry dict.Entry) {
+	for i, synonym := range entry.GetSynonyms() {
+		entry.ReplaceSynonymAt(strings.Join(text.NormalizeAndLowercaseTokens(synonym), " "), i)
+	}
+}
 
-		bytes, err := json.Marshal(cache.Lookup{
-			Dictionary:  config.Dictionary.Name,
-			Identifiers: entry.GetIdentifiers(),
-			Metadata:    metadata,
-		})
-		if err != nil {
-			return err
-		}
-		pipe.Set(synonym, bytes)
+// newLookup returns the JSON encoded lookup which entry's synonyms are stored with.
+func newLookup(entry dict.Entry) ([]byte, error) {
+	metadata, err := json.Marshal(entry.GetMetadata())
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	return json.Marshal(cache.Lookup{
+		Dictionary:  config.Dictionary.Name,
+		Identifiers: entry.GetIdentifiers(),
+		Metadata:    metadata,
+	})
 }
 
 func awaitDB(dbClient remote.Client) {
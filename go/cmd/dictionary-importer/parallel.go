@@ -0,0 +1,211 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/cache/remote"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+)
+
+// errStopped stops the dictionary being read once the import has failed.
+var errStopped = errors.New("import stopped")
+
+// importBatch is a run of consecutive entries of the dictionary, from the start'th up to the end'th, which are
+// imported in one pipeline.
+type importBatch struct {
+	start, end int
+	entries    []dict.Entry
+	pipeline   remote.SetPipeline
+	err        error
+}
+
+// parallelImporter imports a dictionary into a namespace. The dictionary is read in batches of entries, which workers
+// normalise into pipelines while executors execute the pipelines of earlier batches. Batches can finish out of order,
+// so onImported is told how many entries from the start of the dictionary have all been imported, which is what a
+// checkpoint can resume from.
+type parallelImporter struct {
+	client       remote.Client
+	namespace    string
+	workers      int
+	executors    int
+	pipelineSize int // batches are cut once their entries have more synonyms than this
+	// skip is the number of entries at the start of the dictionary which were imported by an earlier attempt. They are
+	// read but not imported again.
+	skip int
+	// onImported is called, from one goroutine at a time, whenever the number of entries which have all been imported
+	// grows.
+	onImported func(imported int) error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+// run imports the entries which read passes to its callback, returning the number of entries read, including those
+// which were skipped.
+func (p *parallelImporter) run(read func(onEntry func(entry dict.Entry) error) error) (int, error) {
+	p.stop = make(chan struct{})
+	batches := make(chan *importBatch, p.workers)
+	prepared := make(chan *importBatch, p.executors)
+	done := make(chan *importBatch, p.executors)
+
+	entries := 0
+	go func() {
+		defer close(batches)
+		entries = p.readBatches(read, batches)
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < atLeastOne(p.workers); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range batches {
+				p.prepare(batch)
+				prepared <- batch
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(prepared)
+	}()
+
+	var executors sync.WaitGroup
+	for i := 0; i < atLeastOne(p.executors); i++ {
+		executors.Add(1)
+		go func() {
+			defer executors.Done()
+			for batch := range prepared {
+				p.execute(batch)
+				done <- batch
+			}
+		}()
+	}
+	go func() {
+		executors.Wait()
+		close(done)
+	}()
+
+	// the stages above always drain their input, even once the import has failed, so this can't deadlock.
+	imported := p.skip
+	finished := make(map[int]int) // the end of each finished batch by its start
+	for batch := range done {
+		if batch.err != nil {
+			p.fail(batch.err)
+			continue
+		}
+		finished[batch.start] = batch.end
+		for end, ok := finished[imported]; ok; end, ok = finished[imported] {
+			delete(finished, imported)
+			imported = end
+			if p.stopped() {
+				continue
+			}
+			if err := p.onImported(imported); err != nil {
+				p.fail(err)
+			}
+		}
+	}
+
+	// done is only closed once batches has been, so entries has been set.
+	return entries, p.err
+}
+
+// readBatches sends batches of the entries which read passes to its callback, skipping the first p.skip.
+func (p *parallelImporter) readBatches(read func(onEntry func(entry dict.Entry) error) error, batches chan *importBatch) int {
+	entries := 0
+	synonyms := 0
+	batch := &importBatch{start: p.skip}
+	err := read(func(entry dict.Entry) error {
+		if p.stopped() {
+			return errStopped
+		}
+		entries++
+		if entries <= p.skip {
+			return nil
+		}
+
+		batch.entries = append(batch.entries, entry)
+		batch.end = entries
+		synonyms += len(entry.GetSynonyms())
+		if synonyms > p.pipelineSize {
+			batches <- batch
+			batch = &importBatch{start: batch.end}
+			synonyms = 0
+		}
+		return nil
+	})
+
+	if err == nil && len(batch.entries) > 0 {
+		batches <- batch
+	}
+	if err != nil && err != errStopped {
+		p.fail(err)
+	}
+	return entries
+}
+
+// prepare normalises the synonyms of batch's entries and adds them to its pipeline.
+func (p *parallelImporter) prepare(batch *importBatch) {
+	if p.stopped() {
+		return
+	}
+	batch.pipeline = p.client.NewSetPipeline(p.pipelineSize)
+	for _, entry := range batch.entries {
+		normaliseSynonyms(entry)
+		if err := addToPipe(entry, batch.pipeline, p.namespace); err != nil {
+			batch.err = err
+			return
+		}
+	}
+}
+
+// execute executes batch's pipeline, once redis is ready.
+func (p *parallelImporter) execute(batch *importBatch) {
+	if p.stopped() || batch.err != nil {
+		return
+	}
+	awaitDB(p.client)
+	batch.err = batch.pipeline.ExecSet()
+	// the entries aren't needed any more, but the batch's range is kept until the ones before it have finished.
+	batch.entries, batch.pipeline = nil, nil
+}
+
+// fail stops the import with err, unless it has already been stopped.
+func (p *parallelImporter) fail(err error) {
+	p.stopOnce.Do(func() {
+		p.err = err
+		close(p.stop)
+	})
+}
+
+func (p *parallelImporter) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	mocks "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/mocks/lib/cache/remote"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+)
+
+// testEntries returns n entries, each with the two synonyms "Synonym <i>" and "Other <i>".
+func testEntries(n int) []dict.Entry {
+	entries := make([]dict.Entry, n)
+	for i := range entries {
+		entries[i] = &dict.NerEntry{
+			Synonyms:    []string{fmt.Sprintf("Synonym %d", i), fmt.Sprintf("Other %d", i)},
+			Identifiers: map[string]string{"id": fmt.Sprint(i)},
+		}
+	}
+	return entries
+}
+
+func readEntries(entries []dict.Entry) func(onEntry func(entry dict.Entry) error) error {
+	return func(onEntry func(entry dict.Entry) error) error {
+		for _, entry := range entries {
+			if err := onEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// newTestImporter returns an importer whose pipelines add synonyms to the returned set, and fail with execErr.
+func newTestImporter(skip int, execErr error) (*parallelImporter, map[string]bool, *[]int) {
+	var mu sync.Mutex
+	added := make(map[string]bool)
+	pipeline := &mocks.SetPipeline{}
+	pipeline.On("Add", "test@1", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		added[args.String(1)] = true
+	})
+	pipeline.On("ExecSet").Return(execErr)
+
+	client := &mocks.Client{}
+	client.On("NewSetPipeline", 3).Return(pipeline)
+	client.On("Ready").Return(true)
+
+	var imported []int
+	return &parallelImporter{
+		client:       client,
+		namespace:    "test@1",
+		workers:      3,
+		executors:    2,
+		pipelineSize: 3,
+		skip:         skip,
+		onImported: func(entries int) error {
+			imported = append(imported, entries)
+			return nil
+		},
+	}, added, &imported
+}
+
+func Test_parallelImporter(t *testing.T) {
+	config.Dictionary.Name = "test"
+	importer, added, imported := newTestImporter(0, nil)
+
+	entries, err := importer.run(readEntries(testEntries(25)))
+	require.NoError(t, err)
+
+	assert.Equal(t, 25, entries)
+	assert.Len(t, added, 50)
+	assert.True(t, added["synonym 0"])
+	assert.True(t, added["other 24"])
+	// batches are cut once they have more than 3 synonyms, i.e. every 2 entries.
+	assert.Equal(t, []int{2, 4, 6, 8, 10, 12, 14, 16, 18, 20, 22, 24, 25}, *imported)
+}
+
+func Test_parallelImporter_Skip(t *testing.T) {
+	config.Dictionary.Name = "test"
+	importer, added, imported := newTestImporter(20, nil)
+
+	entries, err := importer.run(readEntries(testEntries(25)))
+	require.NoError(t, err)
+
+	assert.Equal(t, 25, entries)
+	assert.Len(t, added, 10)
+	assert.False(t, added["synonym 19"])
+	assert.True(t, added["synonym 20"])
+	assert.Equal(t, []int{22, 24, 25}, *imported)
+}
+
+func Test_parallelImporter_Errors(t *testing.T) {
+	config.Dictionary.Name = "test"
+	execErr := errors.New("redis went away")
+	importer, _, imported := newTestImporter(0, execErr)
+
+	_, err := importer.run(readEntries(testEntries(25)))
+	assert.Equal(t, execErr, err)
+	assert.Empty(t, *imported)
+
+	readErr := errors.New("truncated")
+	importer, _, imported = newTestImporter(0, nil)
+	_, err = importer.run(func(onEntry func(entry dict.Entry) error) error {
+		for _, entry := range testEntries(5) {
+			if err := onEntry(entry); err != nil {
+				return err
+			}
+		}
+		return readErr
+	})
+	assert.Equal(t, readErr, err)
+	for _, entries := range *imported {
+		assert.LessOrEqual(t, entries, 5)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// importProgress measures how far an import has got, to report its throughput and when it will finish. The dictionary
+// is counted in bytes, as they are read, since the number of entries isn't known until the end. It is safe for
+// concurrent use.
+type importProgress struct {
+	started time.Time
+	size    int64 // the size of the dictionary as it is stored, or -1 if it isn't known
+	read    int64 // bytes read
+	skipped int64 // entries imported by an earlier attempt
+	entries int64 // entries imported, including those skipped
+}
+
+func newImportProgress(size int64, skipped int) *importProgress {
+	return &importProgress{started: time.Now(), size: size, skipped: int64(skipped), entries: int64(skipped)}
+}
+
+// Write counts bytes of the dictionary which have been read.
+func (p *importProgress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.read, int64(len(b)))
+	return len(b), nil
+}
+
+// imported records that the first entries of the dictionary have been imported.
+func (p *importProgress) imported(entries int) {
+	atomic.StoreInt64(&p.entries, int64(entries))
+}
+
+// progressReport is a snapshot of an importProgress.
+type progressReport struct {
+	Entries          int64
+	EntriesPerSecond float64 // not counting skipped entries
+	Read             int64
+	Size             int64
+	Percent          float64       // of the dictionary which has been read, or -1 if its size isn't known
+	Remaining        time.Duration // estimated from the rate bytes are being read, or -1 if it can't be
+}
+
+func (p *importProgress) report(now time.Time) progressReport {
+	report := progressReport{
+		Entries:   atomic.LoadInt64(&p.entries),
+		Read:      atomic.LoadInt64(&p.read),
+		Size:      p.size,
+		Percent:   -1,
+		Remaining: -1,
+	}
+
+	elapsed := now.Sub(p.started)
+	if elapsed > 0 {
+		report.EntriesPerSecond = float64(report.Entries-p.skipped) / elapsed.Seconds()
+	}
+	if p.size > 0 {
+		report.Percent = 100 * float64(report.Read) / float64(p.size)
+		if report.Read > 0 {
+			remaining := float64(p.size-report.Read) / float64(report.Read) * float64(elapsed)
+			report.Remaining = time.Duration(remaining).Round(time.Second)
+		}
+	}
+	return report
+}
+
+// log logs the progress of the import.
+func (p *importProgress) log() {
+	report := p.report(time.Now())
+	event := log.Info().
+		Int64("entries", report.Entries).
+		Int("entriesPerSecond", int(report.EntriesPerSecond)).
+		Int64("bytesRead", report.Read)
+	if report.Percent >= 0 {
+		event = event.Str("read", fmt.Sprintf("%.1f%%", report.Percent))
+	}
+	if report.Remaining >= 0 {
+		event = event.Str("eta", report.Remaining.String())
+	}
+	event.Msg("importing")
+}
+
+// logEvery logs the progress of the import every interval until stop is closed.
+func (p *importProgress) logEvery(interval time.Duration, stop chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.log()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_importProgress_report(t *testing.T) {
+	started := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		size     int64
+		skipped  int
+		read     int
+		imported int
+		elapsed  time.Duration
+		want     progressReport
+	}{
+		{
+			name:     "quarter read",
+			size:     1000,
+			read:     250,
+			imported: 500,
+			elapsed:  10 * time.Second,
+			want:     progressReport{Entries: 500, EntriesPerSecond: 50, Read: 250, Size: 1000, Percent: 25, Remaining: 30 * time.Second},
+		},
+		{
+			name:     "resumed",
+			size:     1000,
+			skipped:  400,
+			read:     500,
+			imported: 500,
+			elapsed:  10 * time.Second,
+			want:     progressReport{Entries: 500, EntriesPerSecond: 10, Read: 500, Size: 1000, Percent: 50, Remaining: 10 * time.Second},
+		},
+		{
+			name:     "unknown size",
+			size:     -1,
+			read:     250,
+			imported: 500,
+			elapsed:  10 * time.Second,
+			want:     progressReport{Entries: 500, EntriesPerSecond: 50, Read: 250, Size: -1, Percent: -1, Remaining: -1},
+		},
+		{
+			name:    "not started",
+			size:    1000,
+			elapsed: 0,
+			want:    progressReport{Size: 1000, Percent: 0, Remaining: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := newImportProgress(tt.size, tt.skipped)
+			progress.started = started
+			_, _ = progress.Write(make([]byte, tt.read))
+			if tt.imported > 0 {
+				progress.imported(tt.imported)
+			}
+
+			assert.Equal(t, tt.want, progress.report(started.Add(tt.elapsed)))
+		})
+	}
+}
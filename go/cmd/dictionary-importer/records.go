@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// A record is a pair of strings, e.g. a synonym and one of its lookups, which are compared by key and then value.
+type record struct {
+	key, value string
+}
+
+func (r record) less(other record) bool {
+	if r.key != other.key {
+		return r.key < other.key
+	}
+	return r.value < other.value
+}
+
+// recordIterator returns records one at a time. ok is false once there are no more.
+type recordIterator interface {
+	next() (r record, ok bool, err error)
+}
+
+// recordFile is a temporary file of records, which are read back in the order they were written.
+type recordFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	reader *bufio.Reader
+}
+
+func newRecordFile(dir string) (*recordFile, error) {
+	file, err := ioutil.TempFile(dir, "records-*")
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// write writes r, as the lengths of its key and value followed by the key and value themselves.
+func (f *recordFile) write(r record) error {
+	var lengths [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lengths[:], uint64(len(r.key)))
+	n += binary.PutUvarint(lengths[n:], uint64(len(r.value)))
+	if _, err := f.writer.Write(lengths[:n]); err != nil {
+		return err
+	}
+	if _, err := f.writer.WriteString(r.key); err != nil {
+		return err
+	}
+	_, err := f.writer.WriteString(r.value)
+	return err
+}
+
+// rewind finishes writing and starts reading the file from the beginning.
+func (f *recordFile) rewind() error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f.reader = bufio.NewReader(f.file)
+	return nil
+}
+
+func (f *recordFile) next() (record, bool, error) {
+	keyLength, err := binary.ReadUvarint(f.reader)
+	if err == io.EOF {
+		return record{}, false, nil
+	} else if err != nil {
+		return record{}, false, err
+	}
+	valueLength, err := binary.ReadUvarint(f.reader)
+	if err != nil {
+		return record{}, false, err
+	}
+	data := make([]byte, keyLength+valueLength)
+	if _, err := io.ReadFull(f.reader, data); err != nil {
+		return record{}, false, err
+	}
+	return record{key: string(data[:keyLength]), value: string(data[keyLength:])}, true, nil
+}
+
+// close closes and deletes the file.
+func (f *recordFile) close() {
+	_ = f.file.Close()
+	_ = os.Remove(f.file.Name())
+}
+
+// recordSorter sorts more records than can be held in memory. Records are added to a chunk of at most chunkSize, which
+// is sorted and written to a temporary file in dir once it is full. The files are then merged.
+type recordSorter struct {
+	dir       string
+	chunkSize int
+	chunk     []record
+	files     []*recordFile
+}
+
+func newRecordSorter(dir string, chunkSize int) *recordSorter {
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	return &recordSorter{dir: dir, chunkSize: chunkSize}
+}
+
+func (s *recordSorter) add(r record) error {
+	s.chunk = append(s.chunk, r)
+	if len(s.chunk) >= s.chunkSize {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *recordSorter) flush() error {
+	if len(s.chunk) == 0 {
+		return nil
+	}
+	sort.Slice(s.chunk, func(i, j int) bool { return s.chunk[i].less(s.chunk[j]) })
+	file, err := newRecordFile(s.dir)
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, file)
+	for _, r := range s.chunk {
+		if err := file.write(r); err != nil {
+			return err
+		}
+	}
+	s.chunk = s.chunk[:0]
+	return nil
+}
+
+// sorted returns the records which have been added, in order. Records which were added more than once are returned
+// once. No more records can be added.
+func (s *recordSorter) sorted() (recordIterator, error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	s.chunk = nil
+
+	merge := &recordMerge{}
+	for _, file := range s.files {
+		if err := file.rewind(); err != nil {
+			return nil, err
+		}
+		if err := merge.push(file); err != nil {
+			return nil, err
+		}
+	}
+	return merge, nil
+}
+
+// close deletes the sorter's temporary files.
+func (s *recordSorter) close() {
+	for _, file := range s.files {
+		file.close()
+	}
+	s.files = nil
+}
+
+// recordMerge merges sorted files of records, skipping duplicates. It is a heap of the files, ordered by the next
+// record of each.
+type recordMerge struct {
+	heads    []record
+	files    []*recordFile
+	previous *record
+}
+
+func (m *recordMerge) Len() int           { return len(m.files) }
+func (m *recordMerge) Less(i, j int) bool { return m.heads[i].less(m.heads[j]) }
+func (m *recordMerge) Swap(i, j int) {
+	m.heads[i], m.heads[j] = m.heads[j], m.heads[i]
+	m.files[i], m.files[j] = m.files[j], m.files[i]
+}
+func (m *recordMerge) Push(x interface{}) {
+	head := x.(recordHead)
+	m.heads = append(m.heads, head.record)
+	m.files = append(m.files, head.file)
+}
+func (m *recordMerge) Pop() interface{} {
+	last := len(m.files) - 1
+	head := recordHead{record: m.heads[last], file: m.files[last]}
+	m.heads, m.files = m.heads[:last], m.files[:last]
+	return head
+}
+
+type recordHead struct {
+	record record
+	file   *recordFile
+}
+
+// push adds file to the merge, unless it has no records.
+func (m *recordMerge) push(file *recordFile) error {
+	r, ok, err := file.next()
+	if err != nil || !ok {
+		return err
+	}
+	heap.Push(m, recordHead{record: r, file: file})
+	return nil
+}
+
+func (m *recordMerge) next() (record, bool, error) {
+	for m.Len() > 0 {
+		head := heap.Pop(m).(recordHead)
+		if err := m.push(head.file); err != nil {
+			return record{}, false, err
+		}
+		if m.previous != nil && *m.previous == head.record {
+			continue
+		}
+		m.previous = &head.record
+		return head.record, true, nil
+	}
+	return record{}, false, nil
+}
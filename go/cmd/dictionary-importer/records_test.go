@@ -0,0 +1,54 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_recordSorter(t *testing.T) {
+	dir := t.TempDir()
+	sorter := newRecordSorter(dir, 3)
+
+	// records are compared by key then value, may contain any bytes, and duplicates are returned once.
+	for _, r := range []record{
+		{"b", "2"}, {"a", "2"}, {"b", "1"},
+		{"a", "1"}, {"b", "2"}, {"new\nline", "\x00"},
+		{"", ""}, {"a", "1"},
+	} {
+		require.NoError(t, sorter.add(r))
+	}
+	records, err := sorter.sorted()
+	require.NoError(t, err)
+
+	var got []record
+	require.NoError(t, eachRecord(records, func(r record) error {
+		got = append(got, r)
+		return nil
+	}))
+	assert.Equal(t, []record{{"", ""}, {"a", "1"}, {"a", "2"}, {"b", "1"}, {"b", "2"}, {"new\nline", "\x00"}}, got)
+
+	// each chunk of 3 records was written to a file, which is deleted once the sorter is closed.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+	sorter.close()
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
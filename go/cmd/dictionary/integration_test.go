@@ -118,7 +118,7 @@ func addToRedis(client remote.Client, entry dict.NerEntry) error {
 		}
 
 		// add entry to pipe and immediately exec
-		pipe.Set(synonym, bytes)
+		pipe.Add(config.Dictionary.Name, entry.Synonyms[i], bytes)
 		if err := pipe.ExecSet(); err != nil {
 			return err
 		}
@@ -138,7 +138,7 @@ func readFromRedis(recogniser recogniser_client.Client, synonym string) (entitie
 
 	waitGroup := &sync.WaitGroup{}
 	snippetChannel := make(chan snippet_reader.Value)
-	if err := recogniser.Recognise(snippetChannel, waitGroup, lib.HttpOptions{}); err != nil {
+	if err := recogniser.Recognise(context.Background(), snippetChannel, waitGroup, lib.HttpOptions{}); err != nil {
 		return nil, err
 	}
 
@@ -166,6 +166,7 @@ func getReadConnection(client remote.Client) (*grpc.ClientConn, error) {
 	grpcServer := grpc.NewServer()
 	pb.RegisterRecognizerServer(grpcServer, &recogniser{
 		remoteCache: client,
+		namespaces:  []string{config.Dictionary.Name},
 	})
 
 	port := 50053
@@ -14,6 +14,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
@@ -24,9 +25,17 @@ import (
 	"net"
 )
 
+type mode string
+
+const (
+	redisMode  mode = "redis"  // look tokens up in a dictionary which has been imported into redis by the dictionary-importer
+	memoryMode mode = "memory" // load the dictionary from its file into memory at startup
+)
+
 // config structure
 type dictionaryRecogniserConfig struct {
 	lib.BaseConfig
+	Mode       mode
 	Dictionary dict.DictConfig
 	Server     struct {
 		GrpcPort int `mapstructure:"grpc_port"`
@@ -34,15 +43,18 @@ type dictionaryRecogniserConfig struct {
 	PipelineSize        int `mapstructure:"pipeline_size"`
 	Redis               remote.RedisConfig
 	CompoundTokenLength int `mapstructure:"compound_token_length"`
+	// Namespaces are the names of the dictionaries in redis to look tokens up in. Defaults to dictionary.name.
+	Namespaces []string
 }
 
 var config dictionaryRecogniserConfig
 var defaultConfig = map[string]interface{}{
 	"log_level":     "info",
+	"mode":          redisMode,
 	"pipeline_size": 10000,
 	"dictionary": map[string]interface{}{
-		"type": "pubchem",
-		"name": "pubchem_data",
+		"format": dict.PubchemDictionaryFormat,
+		"name":   "pubchem_synonyms",
 	},
 	"server": map[string]interface{}{
 		"grpc_port": 50051,
@@ -59,23 +71,39 @@ func main() {
 		log.Fatal().Err(err).Send()
 	}
 
-	// Get a redis client
-	var redisClient = remote.NewRedisClient(config.Redis)
-	var err error
-
-	// start the grpc server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Server.GrpcPort))
-	if err != nil {
-		log.Fatal().Err(err).Send()
-	}
 	var opts []grpc.ServerOption
 	grpcServer := grpc.NewServer(opts...)
-	if redisClient != nil {
+
+	switch config.Mode {
+	case redisMode:
+		// Get a redis client
+		var redisClient = remote.NewRedisClient(config.Redis)
+		if redisClient == nil {
+			log.Fatal().Msg("no cache configured")
+		}
+		namespaces := config.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{config.Dictionary.Name}
+		}
+		log.Info().Strs("namespaces", namespaces).Msg("looking up tokens in redis")
 		pb.RegisterRecognizerServer(grpcServer, &recogniser{
 			remoteCache: redisClient,
+			namespaces:  namespaces,
 		})
-	} else {
-		log.Fatal().Msg("no cache configured")
+	case memoryMode:
+		memoryRecogniser, err := newMemoryRecogniser(context.Background(), config.Dictionary)
+		if err != nil {
+			log.Fatal().Str("path", config.Dictionary.Path).Err(err).Msg("failed to load dictionary")
+		}
+		pb.RegisterRecognizerServer(grpcServer, memoryRecogniser)
+	default:
+		log.Fatal().Str("mode", string(config.Mode)).Msg("unsupported mode - must be redis or memory")
+	}
+
+	// start the grpc server
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Server.GrpcPort))
+	if err != nil {
+		log.Fatal().Err(err).Send()
 	}
 
 	log.Info().Int("port", config.Server.GrpcPort).Msg("ready to accept requests")
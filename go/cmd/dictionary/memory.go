@@ -0,0 +1,130 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/ahocorasick"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/cache"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+)
+
+// memoryRecogniser serves the same gRPC contract as recogniser, but matches tokens against a dictionary held in memory
+// instead of querying redis. Every synonym is matched in a single pass, however many tokens it has, so
+// compound_token_length does not apply.
+type memoryRecogniser struct {
+	pb.UnimplementedRecognizerServer
+	automaton *ahocorasick.Automaton // values are []*cache.Lookup, one for each entry with the synonym
+}
+
+// newMemoryRecogniser reads the dictionary described by dictConfig into memory.
+func newMemoryRecogniser(ctx context.Context, dictConfig dict.DictConfig) (*memoryRecogniser, error) {
+	// synonyms can belong to more than one entry, so collect every entry's lookup before adding them to the automaton.
+	synonyms := make(map[string][]*cache.Lookup)
+	var synonymTokens [][]string
+	entries := 0
+	onEntry := func(entry dict.Entry) error {
+		entries++
+		if entries%50000 == 0 {
+			log.Info().Int("entries", entries).Msg("loading dictionary")
+		}
+
+		metadata, err := json.Marshal(entry.GetMetadata())
+		if err != nil {
+			return err
+		}
+		lookup := &cache.Lookup{
+			Dictionary:  dictConfig.Name,
+			Identifiers: entry.GetIdentifiers(),
+			Metadata:    metadata,
+		}
+
+		for _, synonym := range entry.GetSynonyms() {
+			tokens := text.NormalizeAndLowercaseTokens(synonym)
+			key := strings.Join(tokens, " ")
+			if _, ok := synonyms[key]; !ok {
+				synonymTokens = append(synonymTokens, tokens)
+			}
+			synonyms[key] = append(synonyms[key], lookup)
+		}
+		return nil
+	}
+
+	_, err := dict.EachInput(ctx, dictConfig, func(input io.Reader) error {
+		return dict.ReadWithCallback(input, dictConfig, onEntry, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	automaton := ahocorasick.New()
+	for _, tokens := range synonymTokens {
+		automaton.Add(tokens, synonyms[strings.Join(tokens, " ")])
+	}
+	automaton.Build()
+
+	log.Info().Int("entries", entries).Int("longestSynonym", automaton.MaxLength()).Msg("loaded dictionary")
+	return &memoryRecogniser{automaton: automaton}, nil
+}
+
+func (recogniser *memoryRecogniser) GetStream(stream pb.Recognizer_GetStreamServer) error {
+	log.Info().Msg("received request")
+
+	state := recogniser.automaton.Start()
+
+	// the most recent tokens, so that matches spanning several tokens can be turned back into text.
+	maxLength := recogniser.automaton.MaxLength()
+	history := make([]*pb.Snippet, 0, maxLength)
+
+	for {
+		snippet, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// compoundTokenEnd is true if the last byte in the token is one of '.', '?', or '!'.
+		compoundTokenEnd := text.NormalizeAndLowercaseSnippet(snippet)
+
+		if len(snippet.NormalisedText) > 0 {
+			if len(history) > 0 && len(history) >= maxLength {
+				history = append(history[:0], history[1:]...)
+			}
+			history = append(history, snippet)
+
+			var matches []ahocorasick.Match
+			state, matches = recogniser.automaton.Next(state, snippet.NormalisedText)
+			for _, match := range matches {
+				compoundSnippet := joinSnippets(history[len(history)-match.Length:])
+				if err := sendEntities(stream, compoundSnippet, match.Value.([]*cache.Lookup)); err != nil {
+					return err
+				}
+			}
+		}
+
+		// synonyms don't span sentences.
+		if compoundTokenEnd {
+			state = recogniser.automaton.Start()
+			history = history[:0]
+		}
+	}
+}
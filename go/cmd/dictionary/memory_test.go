@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/dict"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/testhelpers"
+)
+
+func Test_memoryRecogniser_GetStream(t *testing.T) {
+	dictPath := filepath.Join(t.TempDir(), "dictionary.jsonl")
+	require.Nil(t, ioutil.WriteFile(dictPath, []byte(
+		`{"synonyms": ["Acetyl"], "identifiers": {"id": "1"}}
+{"synonyms": ["acetyl carnitine", "ALCAR"], "identifiers": {"id": "2"}}
+{"synonyms": ["carnitine"], "identifiers": {"id": "3"}}
+{"synonyms": ["alcar"], "identifiers": {"id": "4"}}
+`), 0644))
+
+	memoryRecogniser, err := newMemoryRecogniser(context.Background(), dict.DictConfig{
+		Name:   "test-dictionary",
+		Path:   dictPath,
+		Format: dict.NativeDictionaryFormat,
+	})
+	require.Nil(t, err)
+
+	snippets := []*pb.Snippet{
+		testhelpers.CreateSnippet("Acetyl", "", 1, "/p"),
+		testhelpers.CreateSnippet("carnitine", "", 8, "/p"),
+		testhelpers.CreateSnippet("is", "", 19, "/p"),
+		testhelpers.CreateSnippet("acetyl.", "", 22, "/p"),
+		// the sentence has ended, so this is not "acetyl carnitine"
+		testhelpers.CreateSnippet("Carnitine", "", 30, "/p"),
+		// the brackets are not part of the entity, which is a synonym of two entries
+		testhelpers.CreateSnippet("(ALCAR)", "", 39, "/p"),
+	}
+	stream := testhelpers.NewMockRecognizeServerStream(snippets...)
+
+	newEntity := func(name string, position uint32, id string) *pb.Entity {
+		return &pb.Entity{
+			Name:        name,
+			Position:    position,
+			EndPosition: position + uint32(len(name)),
+			Text:        name,
+			Xpath:       "/p",
+			Recogniser:  "test-dictionary",
+			Identifiers: map[string]string{"id": id},
+			Metadata:    "null",
+		}
+	}
+	expectedEntities := []*pb.Entity{
+		newEntity("Acetyl", 1, "1"),
+		newEntity("Acetyl carnitine", 1, "2"),
+		newEntity("carnitine", 8, "3"),
+		newEntity("acetyl", 22, "1"),
+		newEntity("Carnitine", 30, "3"),
+		newEntity("ALCAR", 40, "2"),
+		newEntity("ALCAR", 40, "4"),
+	}
+	for _, entity := range expectedEntities {
+		stream.On("Send", entity).Return(nil).Once()
+	}
+
+	assert.Nil(t, memoryRecogniser.GetStream(stream))
+	stream.AssertExpectations(t)
+}
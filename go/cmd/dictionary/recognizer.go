@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
@@ -29,23 +30,35 @@ import (
 type recogniser struct {
 	pb.UnimplementedRecognizerServer
 	remoteCache remote.Client
+	namespaces  []string // the dictionaries to look tokens up in, which are resolved to their active versions
 }
 
 type requestVars struct {
-	snippetCache       map[*pb.Snippet]*cache.Lookup
+	// snippetCache holds the lookups of each snippet which has been queried. They are nil if it isn't in any dictionary,
+	// or empty but not nil if the query is still in the pipeline.
+	snippetCache       map[*pb.Snippet][]*cache.Lookup
 	snippetCacheMisses []*pb.Snippet
 	snippetHistory     []*pb.Snippet
 	stream             pb.Recognizer_GetStreamServer
 	pipeline           remote.GetPipeline
+	namespaces         []string
 }
 
+// newEntityWithNormalisedText returns the entity found in snippet, which must be a (possibly compound) token made by
+// joinSnippets. The entity's position and text leave out any enclosing characters which normalising removes.
 func newEntityWithNormalisedText(snippet *pb.Snippet, lookup *cache.Lookup) *pb.Entity {
 
 	normalisedText, _, _ := text.NormalizeString(snippet.GetText())
 
+	start, end, _ := text.TrimEnclosingCharacters(snippet.GetText())
+	surfaceText := snippet.GetText()[start:end]
+	position := snippet.GetOffset() + uint32(utf8.RuneCountInString(snippet.GetText()[:start]))
+
 	return &pb.Entity{
 		Name:        normalisedText,
-		Position:    snippet.GetOffset(),
+		Position:    position,
+		EndPosition: position + uint32(utf8.RuneCountInString(surfaceText)),
+		Text:        surfaceText,
 		Recogniser:  lookup.Dictionary,
 		Identifiers: convertIdentifiers(lookup.Identifiers), // convert identifiers from map[string]interface{} to map[string]string
 		Xpath:       snippet.GetXpath(),
@@ -53,27 +66,52 @@ func newEntityWithNormalisedText(snippet *pb.Snippet, lookup *cache.Lookup) *pb.
 	}
 }
 
-func (recogniser *recogniser) newResultHandler(vars *requestVars) func(snippet *pb.Snippet, lookup *cache.Lookup) error {
-	return func(snippet *pb.Snippet, lookup *cache.Lookup) error {
-		vars.snippetCache[snippet] = lookup
-		if lookup == nil {
-			return nil
-		}
+// sendEntities sends an entity for each of snippet's lookups, so every candidate for an ambiguous synonym is returned.
+func sendEntities(stream pb.Recognizer_GetStreamServer, snippet *pb.Snippet, lookups []*cache.Lookup) error {
+	for _, lookup := range lookups {
 		entity := newEntityWithNormalisedText(snippet, lookup)
-		if err := vars.stream.Send(entity); err != nil {
+		if err := stream.Send(entity); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		return nil
+func (recogniser *recogniser) newResultHandler(vars *requestVars) func(snippet *pb.Snippet, lookups []*cache.Lookup) error {
+	return func(snippet *pb.Snippet, lookups []*cache.Lookup) error {
+		vars.snippetCache[snippet] = lookups
+		return sendEntities(vars.stream, snippet, lookups)
 	}
 }
 
-func joinSnippets(snips []*pb.Snippet) (originalText, normalisedText string) {
-	for _, snip := range snips {
-		originalText += snip.Text + " "
-		normalisedText += snip.NormalisedText + " "
+// joinSnippets joins consecutive normalised tokens into a compound token. Its text is the tokens' text as it appears
+// in the source, with the whitespace between them (which the tokenizer drops) given as spaces, so that offsets within
+// it still line up with the source.
+func joinSnippets(snips []*pb.Snippet) *pb.Snippet {
+	originalText := &strings.Builder{}
+	normalisedText := make([]string, len(snips))
+	var offset, end uint32
+	for i, snip := range snips {
+		// Normalising moves a token's offset past any enclosing character it removes from the start, so move it back.
+		start, _, _ := text.TrimEnclosingCharacters(snip.GetText())
+		snipOffset := snip.GetOffset() - uint32(start)
+
+		if i == 0 {
+			offset = snipOffset
+		} else if snipOffset > end {
+			originalText.WriteString(strings.Repeat(" ", int(snipOffset-end)))
+		}
+		originalText.WriteString(snip.GetText())
+		normalisedText[i] = snip.GetNormalisedText()
+		end = snipOffset + uint32(utf8.RuneCountInString(snip.GetText()))
+	}
+
+	return &pb.Snippet{
+		Text:           originalText.String(),
+		NormalisedText: strings.Join(normalisedText, " "),
+		Offset:         offset,
+		Xpath:          snips[0].GetXpath(),
 	}
-	return strings.TrimRight(originalText, " "), strings.TrimRight(normalisedText, " ")
 }
 
 func getCompoundSnippets(vars *requestVars, snippet *pb.Snippet) (snippets []*pb.Snippet, skipToken bool) {
@@ -93,14 +131,8 @@ func getCompoundSnippets(vars *requestVars, snippet *pb.Snippet) (snippets []*pb
 
 	// construct the compound tokens to query against redis.
 	snippets = make([]*pb.Snippet, len(vars.snippetHistory))
-	for i, historicalSnippet := range vars.snippetHistory {
-		originalText, normalisedText := joinSnippets(vars.snippetHistory[i:])
-		snippets[i] = &pb.Snippet{
-			Text:           originalText,
-			NormalisedText: normalisedText,
-			Offset:         historicalSnippet.GetOffset(),
-			Xpath:          historicalSnippet.GetXpath(),
-		}
+	for i := range vars.snippetHistory {
+		snippets[i] = joinSnippets(vars.snippetHistory[i:])
 	}
 
 	// If compoundTokenEnd is true, we can save some redis queries by resetting the token history.
@@ -112,65 +144,70 @@ func getCompoundSnippets(vars *requestVars, snippet *pb.Snippet) (snippets []*pb
 }
 
 func (recogniser *recogniser) findOrQueueSnippet(vars *requestVars, snippet *pb.Snippet) error {
-	if lookup, ok := vars.snippetCache[snippet]; ok {
+	if lookups, ok := vars.snippetCache[snippet]; ok {
 		// if it's nil, we've already queried redis and it wasn't there
-		if lookup == nil {
+		if lookups == nil {
 			return nil
 		}
 		// If it's empty, it's already queued but we don't know if its there or not.
 		// Append it to the cacheMisses to be found later.
-		if lookup.Dictionary == "" {
+		if len(lookups) == 0 {
 			vars.snippetCacheMisses = append(vars.snippetCacheMisses, snippet)
 			return nil
 		}
-		// Otherwise, construct an entity from the cache value and send it back to the caller.
-		entity := newEntityWithNormalisedText(snippet, lookup)
-		if err := vars.stream.Send(entity); err != nil {
-			return err
-		}
-	} else {
-		// Not in local cache.
-		// Queue the redis "GET" in the pipeline and set the cache value to an empty db.Lookup
-		// (so that future equivalent tokens will be a cache miss).
-		vars.pipeline.Get(snippet)
-		vars.snippetCache[snippet] = &cache.Lookup{}
+		// Otherwise, construct entities from the cache value and send them back to the caller.
+		return sendEntities(vars.stream, snippet, lookups)
 	}
+
+	// Not in local cache.
+	// Queue the redis query in the pipeline and set the cache value to no lookups
+	// (so that future equivalent tokens will be a cache miss).
+	vars.pipeline.Get(snippet)
+	vars.snippetCache[snippet] = []*cache.Lookup{}
 	return nil
 }
 
-func (recogniser *recogniser) initializeRequest(stream pb.Recognizer_GetStreamServer) *requestVars {
+// initializeRequest sets up a request, which reads the versions of the dictionaries which are active when it starts
+// until it ends, even if another version is activated in the meantime.
+func (recogniser *recogniser) initializeRequest(stream pb.Recognizer_GetStreamServer) (*requestVars, error) {
+	namespaces, err := recogniser.remoteCache.ActiveNamespaces(recogniser.namespaces)
+	if err != nil {
+		return nil, err
+	}
+
 	return &requestVars{
-		snippetCache:       make(map[*pb.Snippet]*cache.Lookup, config.PipelineSize),
+		snippetCache:       make(map[*pb.Snippet][]*cache.Lookup, config.PipelineSize),
 		snippetCacheMisses: make([]*pb.Snippet, config.PipelineSize),
 		snippetHistory:     []*pb.Snippet{},
 		stream:             stream,
-		pipeline:           recogniser.remoteCache.NewGetPipeline(config.PipelineSize),
-	}
+		pipeline:           recogniser.remoteCache.NewGetPipeline(config.PipelineSize, namespaces),
+		namespaces:         namespaces,
+	}, nil
 }
 
-func (recogniser *recogniser) runPipeline(vars *requestVars, onResult func(snippet *pb.Snippet, lookup *cache.Lookup) error) error {
+func (recogniser *recogniser) runPipeline(vars *requestVars, onResult func(snippet *pb.Snippet, lookups []*cache.Lookup) error) error {
 	if err := vars.pipeline.ExecGet(onResult); err != nil {
 		return err
 	}
-	vars.pipeline = recogniser.remoteCache.NewGetPipeline(config.PipelineSize)
+	vars.pipeline = recogniser.remoteCache.NewGetPipeline(config.PipelineSize, vars.namespaces)
 	return nil
 }
 
 func (recogniser *recogniser) retryCacheMisses(vars *requestVars) error {
 	for _, snippet := range vars.snippetCacheMisses {
-		if lookup := vars.snippetCache[snippet]; lookup != nil {
-			entity := newEntityWithNormalisedText(snippet, lookup)
-			if err := vars.stream.Send(entity); err != nil {
-				return err
-			}
+		if err := sendEntities(vars.stream, snippet, vars.snippetCache[snippet]); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 func (recogniser *recogniser) GetStream(stream pb.Recognizer_GetStreamServer) error {
-	vars := recogniser.initializeRequest(stream)
-	log.Info().Msg("received request")
+	vars, err := recogniser.initializeRequest(stream)
+	if err != nil {
+		return err
+	}
+	log.Info().Strs("namespaces", vars.namespaces).Msg("received request")
 	onResult := recogniser.newResultHandler(vars)
 
 	for {
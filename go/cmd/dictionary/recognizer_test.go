@@ -14,6 +14,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/mock"
@@ -24,6 +26,8 @@ import (
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/testhelpers"
 )
 
+var testNamespaces = []string{"fake dictionary", "other dictionary"}
+
 var testConfig = dictionaryRecogniserConfig{
 	PipelineSize:        100,
 	CompoundTokenLength: 5,
@@ -40,13 +44,17 @@ func TestRecognizerSuite(t *testing.T) {
 
 func (s *RecognizerSuite) SetupSuite() {
 	config = testConfig
+	s.namespaces = testNamespaces
 }
 
 func (s *RecognizerSuite) Test_recognizer_Recognize() {
 	mockDBClient := &mocks.Client{}
 	s.remoteCache = mockDBClient
 	mockGetPipeline := &mocks.GetPipeline{}
-	mockDBClient.On("NewGetPipeline", testConfig.PipelineSize).Return(mockGetPipeline).Times(2)
+	// the request reads the active version of each dictionary.
+	activeNamespaces := []string{"fake dictionary@2", "other dictionary"}
+	mockDBClient.On("ActiveNamespaces", testNamespaces).Return(activeNamespaces, nil).Once()
+	mockDBClient.On("NewGetPipeline", testConfig.PipelineSize, activeNamespaces).Return(mockGetPipeline).Times(2)
 	snippets := testhelpers.CreateSnippets("hello", "my", "name", "is", "jeff")
 	mockStream := testhelpers.NewMockRecognizeServerStream(snippets...)
 	v := &requestVars{}
@@ -67,12 +75,22 @@ func (s *RecognizerSuite) Test_recognizer_Recognize() {
 	mockStream.AssertExpectations(s.T())
 }
 
+func (s *RecognizerSuite) Test_recognizer_Recognize_ActiveNamespacesError() {
+	mockDBClient := &mocks.Client{}
+	s.remoteCache = mockDBClient
+	mockDBClient.On("ActiveNamespaces", testNamespaces).Return(nil, errors.New("connection refused")).Once()
+
+	err := s.GetStream(testhelpers.NewMockRecognizeServerStream())
+	s.EqualError(err, "connection refused")
+	mockDBClient.AssertExpectations(s.T())
+}
+
 func (s *RecognizerSuite) Test_recogniser_queryToken() {
 
 	mockDBClient := &mocks.Client{}
 	s.remoteCache = mockDBClient
 	mockGetPipeline := &mocks.GetPipeline{}
-	mockDBClient.On("NewGetPipeline", testConfig.PipelineSize).Return(mockGetPipeline).Once()
+	mockDBClient.On("NewGetPipeline", testConfig.PipelineSize, testNamespaces).Return(mockGetPipeline).Once()
 	mockStream := testhelpers.NewMockRecognizeServerStream(testhelpers.CreateSnippets("hello", "my", "name", "is", "jeff")...)
 	notInDB := &pb.Snippet{
 		Text: "not in db",
@@ -87,24 +105,30 @@ func (s *RecognizerSuite) Test_recogniser_queryToken() {
 	notInCache := &pb.Snippet{
 		Text: "not in cache",
 	}
-	tokenCache := map[*pb.Snippet]*cache.Lookup{
+	tokenCache := map[*pb.Snippet][]*cache.Lookup{
 		notInDB:   nil,
 		cacheMiss: {},
 		inDB: {
-			Dictionary: "fake dictionary",
+			{Dictionary: "fake dictionary", Identifiers: map[string]interface{}{"id": "1"}},
+			{Dictionary: "other dictionary", Identifiers: map[string]interface{}{"id": "2"}},
 		},
 	}
-	tokenCacheWithMissingToken := make(map[*pb.Snippet]*cache.Lookup)
+	tokenCacheWithMissingToken := make(map[*pb.Snippet][]*cache.Lookup)
 	for k, v := range tokenCache {
 		tokenCacheWithMissingToken[k] = v
 	}
-	tokenCacheWithMissingToken[notInCache] = &cache.Lookup{}
-	foundEntity := &pb.Entity{
-		Recogniser:  "fake dictionary",
-		Name:        "in db",
-		Identifiers: make(map[string]string),
+	tokenCacheWithMissingToken[notInCache] = []*cache.Lookup{}
+	// "in db" is a homonym, so there is an entity for each dictionary entry.
+	for i, dictionary := range testNamespaces {
+		foundEntity := &pb.Entity{
+			Recogniser:  dictionary,
+			Name:        "in db",
+			EndPosition: 5,
+			Text:        "in db",
+			Identifiers: map[string]string{"id": fmt.Sprint(i + 1)},
+		}
+		mockStream.On("Send", foundEntity).Return(nil).Once()
 	}
-	mockStream.On("Send", foundEntity).Return(nil).Once()
 	mockGetPipeline.On("Get", notInCache).Once()
 	type args struct {
 		vars  *requestVars
@@ -180,6 +204,7 @@ func (s *RecognizerSuite) Test_recogniser_queryToken() {
 		s.Equal(tt.wantErr, gotErr)
 		s.Equal(tt.wantVars, tt.args.vars)
 	}
+	mockStream.AssertNumberOfCalls(s.T(), "Send", len(testNamespaces))
 }
 
 func (s *RecognizerSuite) Test_recogniser_getCompoundTokens() {
@@ -221,9 +246,9 @@ func (s *RecognizerSuite) Test_recogniser_getCompoundTokens() {
 			name: "detect end of sentence (for current token)",
 			args: args{
 				vars: &requestVars{
-					snippetHistory: testhelpers.CreateSnippets("got"),
+					snippetHistory: []*pb.Snippet{testhelpers.CreateSnippet("got", "got", 0, "")},
 				},
-				token: testhelpers.CreateSnippet("Hello.", "hello", 0, ""),
+				token: testhelpers.CreateSnippet("Hello.", "hello", 4, ""),
 			},
 			want: []*pb.Snippet{
 				{
@@ -233,6 +258,7 @@ func (s *RecognizerSuite) Test_recogniser_getCompoundTokens() {
 				{
 					Text:           "Hello.",
 					NormalisedText: "hello",
+					Offset:         4,
 				},
 			},
 			wantVars: &requestVars{
@@ -243,32 +269,94 @@ func (s *RecognizerSuite) Test_recogniser_getCompoundTokens() {
 			name: "less than compound token length",
 			args: args{
 				vars: &requestVars{
-					snippetHistory: testhelpers.CreateSnippets("old"),
+					snippetHistory: []*pb.Snippet{testhelpers.CreateSnippet("old", "old", 0, "")},
 				},
-				token: testhelpers.CreateSnippet("new", "new", 0, ""),
+				token: testhelpers.CreateSnippet("new", "new", 4, ""),
+			},
+			want: []*pb.Snippet{
+				testhelpers.CreateSnippet("old new", "old new", 0, ""),
+				testhelpers.CreateSnippet("new", "new", 4, ""),
 			},
-			want: testhelpers.CreateSnippets("old new", "new"),
 			wantVars: &requestVars{
-				snippetHistory: testhelpers.CreateSnippets("old", "new"),
+				snippetHistory: []*pb.Snippet{
+					testhelpers.CreateSnippet("old", "old", 0, ""),
+					testhelpers.CreateSnippet("new", "new", 4, ""),
+				},
 			},
 		},
 		{
 			name: "at compound token length",
 			args: args{
 				vars: &requestVars{
-					snippetHistory: testhelpers.CreateSnippets("old", "new", "black", "white", "quavers"),
+					snippetHistory: []*pb.Snippet{
+						testhelpers.CreateSnippet("old", "old", 0, ""),
+						testhelpers.CreateSnippet("new", "new", 4, ""),
+						testhelpers.CreateSnippet("black", "black", 8, ""),
+						testhelpers.CreateSnippet("white", "white", 14, ""),
+						testhelpers.CreateSnippet("quavers", "quavers", 20, ""),
+					},
+				},
+				token: testhelpers.CreateSnippet("latest", "latest", 28, ""),
+			},
+			want: []*pb.Snippet{
+				testhelpers.CreateSnippet("new black white quavers latest", "new black white quavers latest", 4, ""),
+				testhelpers.CreateSnippet("black white quavers latest", "black white quavers latest", 8, ""),
+				testhelpers.CreateSnippet("white quavers latest", "white quavers latest", 14, ""),
+				testhelpers.CreateSnippet("quavers latest", "quavers latest", 20, ""),
+				testhelpers.CreateSnippet("latest", "latest", 28, ""),
+			},
+			wantVars: &requestVars{
+				snippetHistory: []*pb.Snippet{
+					testhelpers.CreateSnippet("new", "new", 4, ""),
+					testhelpers.CreateSnippet("black", "black", 8, ""),
+					testhelpers.CreateSnippet("white", "white", 14, ""),
+					testhelpers.CreateSnippet("quavers", "quavers", 20, ""),
+					testhelpers.CreateSnippet("latest", "latest", 28, ""),
+				},
+			},
+		},
+		{
+			name: "tokens separated by more than one space, with an enclosing character removed",
+			args: args{
+				vars: &requestVars{
+					// normalising moved the offset of "(sodium" past the bracket
+					snippetHistory: []*pb.Snippet{testhelpers.CreateSnippet("(sodium", "sodium", 1, "")},
 				},
-				token: testhelpers.CreateSnippet("latest", "latest", 0, ""),
+				token: testhelpers.CreateSnippet("chloride", "", 9, ""),
+			},
+			want: []*pb.Snippet{
+				testhelpers.CreateSnippet("(sodium  chloride", "sodium chloride", 0, ""),
+				testhelpers.CreateSnippet("chloride", "chloride", 9, ""),
 			},
-			want: testhelpers.CreateSnippets(
-				"new black white quavers latest",
-				"black white quavers latest",
-				"white quavers latest",
-				"quavers latest",
-				"latest",
-			),
 			wantVars: &requestVars{
-				snippetHistory: testhelpers.CreateSnippets("new", "black", "white", "quavers", "latest"),
+				snippetHistory: []*pb.Snippet{
+					testhelpers.CreateSnippet("(sodium", "sodium", 1, ""),
+					testhelpers.CreateSnippet("chloride", "chloride", 9, ""),
+				},
+			},
+		},
+		{
+			name: "tokens not separated by whitespace",
+			args: args{
+				vars: &requestVars{
+					snippetHistory: []*pb.Snippet{
+						testhelpers.CreateSnippet("sodium", "sodium", 0, ""),
+						testhelpers.CreateSnippet("-", "-", 6, ""),
+					},
+				},
+				token: testhelpers.CreateSnippet("chloride", "", 7, ""),
+			},
+			want: []*pb.Snippet{
+				testhelpers.CreateSnippet("sodium-chloride", "sodium - chloride", 0, ""),
+				testhelpers.CreateSnippet("-chloride", "- chloride", 6, ""),
+				testhelpers.CreateSnippet("chloride", "chloride", 7, ""),
+			},
+			wantVars: &requestVars{
+				snippetHistory: []*pb.Snippet{
+					testhelpers.CreateSnippet("sodium", "sodium", 0, ""),
+					testhelpers.CreateSnippet("-", "-", 6, ""),
+					testhelpers.CreateSnippet("chloride", "chloride", 7, ""),
+				},
 			},
 		},
 	}
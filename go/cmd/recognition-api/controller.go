@@ -14,16 +14,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	http_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/http-recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
 	snippetReader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type AllowedContentType int
@@ -38,12 +46,25 @@ var allowedContentTypeEnumMap = map[string]AllowedContentType{
 	"text/plain": contentTypeRawtext,
 }
 
+// controller performs recognition. It is copied for each request (see server.requestController), so exactMatch only
+// applies to the request it was set for.
 type controller struct {
-	recognisers map[string]recogniser.Client
+	recognisers map[string]recogniser.Factory // creates a client for each request, keyed by recogniser name
 	htmlReader  snippetReader.Client
 	textReader  snippetReader.Client
 	blocklist   blocklist.Blocklist // a global blocklist to apply against all recognisers
 	exactMatch  bool
+	overlap     lib.OverlapStrategy      // how to resolve overlapping entities found by any of the recognisers
+	timeouts    map[string]time.Duration // the deadline for each recogniser to finish a request, keyed by recogniser name
+	refs        *controllerRefs          // counts the requests and jobs using the controller, see liveController.Acquire
+}
+
+// session holds the recogniser clients created for a single request, the errors of any which failed, and the document
+// which was read.
+type session struct {
+	clients  map[string]recogniser.Client // keyed by recogniser name
+	errs     map[string]error             // keyed by recogniser name
+	document *snippetReader.Document
 }
 
 func (controller controller) HTMLToText(reader io.Reader) ([]byte, error) {
@@ -98,30 +119,288 @@ func (controller controller) ListRecognisers() []string {
 	return recognisers
 }
 
+// RecogniserStatus describes how a recogniser got on with a recognition request.
+type RecogniserStatus string
+
+const (
+	RecogniserOK       RecogniserStatus = "ok"
+	RecogniserTimedOut RecogniserStatus = "timeout"
+	RecogniserFailed   RecogniserStatus = "failed" // only reported by RecognizePartial
+)
+
+// RecogniserTimeoutError is reported for a recogniser which did not finish before its deadline.
+type RecogniserTimeoutError struct {
+	Recogniser string
+	Timeout    time.Duration
+}
+
+func (e RecogniserTimeoutError) Error() string {
+	return fmt.Sprintf("recogniser '%s' timed out after %s", e.Recogniser, e.Timeout)
+}
+
+func (e RecogniserTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// RecogniserErrorType classifies why a recogniser failed.
+type RecogniserErrorType string
+
+const (
+	ErrorConnectionRefused RecogniserErrorType = "connection_refused" // the recogniser could not be reached
+	ErrorBadStatus         RecogniserErrorType = "bad_status"         // an HTTP recogniser responded with a status other than 200
+	ErrorStreamReset       RecogniserErrorType = "stream_reset"       // a gRPC recogniser's stream ended with an error
+	ErrorBlocklist         RecogniserErrorType = "blocklist"          // the recogniser's blocklist could not be loaded
+	ErrorTimeout           RecogniserErrorType = "timeout"            // the recogniser did not finish before its deadline
+	ErrorUnknown           RecogniserErrorType = "unknown"
+)
+
+// RecogniserError describes why a recogniser failed.
+//
+// swagger:model RecogniserError
+type RecogniserError struct {
+	Type       RecogniserErrorType `json:"type"`
+	Message    string              `json:"message"`
+	StatusCode int                 `json:"statusCode,omitempty"` // the status returned by an HTTP recogniser, for bad_status errors
+}
+
+// RecogniserReport is how a single recogniser got on with a request made with partial results enabled.
+//
+// swagger:model RecogniserReport
+type RecogniserReport struct {
+	Status RecogniserStatus `json:"status"`
+	Error  *RecogniserError `json:"error,omitempty"`
+}
+
+// PartialResult holds the entities found by every recogniser which did not fail, and a report for each requested recogniser.
+//
+// swagger:model PartialResult
+type PartialResult struct {
+	Entities    []lib.APIEntity             `json:"entities"`
+	Recognisers map[string]RecogniserReport `json:"recognisers"`
+}
+
 // Recognize performs entity recognition by calling recognise() on each recogniser in recogniserToOpts.
-func (controller controller) Recognize(reader io.Reader, contentType AllowedContentType, requestedRecognisers []lib.RecogniserOptions) ([]lib.APIEntity, error) {
+// Recognisers which do not finish before their deadline are reported as timed out in the returned statuses, and
+// any entities they found before then are still returned.
+func (controller controller) Recognize(ctx context.Context, reader io.Reader, contentType AllowedContentType, requestedRecognisers []lib.RecogniserOptions) ([]lib.APIEntity, map[string]RecogniserStatus, error) {
 
-	waitGroup := &sync.WaitGroup{}
-	channels := make(map[string]chan snippetReader.Value)
+	session, err := controller.recognise(ctx, reader, contentType, requestedRecognisers, snippetReader.NewDocument(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	statuses, err := recogniserStatuses(requestedRecognisers, session.errs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return controller.results(session, requestedRecognisers), statuses, nil
+}
+
+// RecognizePartial performs entity recognition in the same way as Recognize, except that a recogniser which fails does
+// not fail the whole request. The entities found by the other recognisers are returned, and the failure is described in
+// the recogniser's report.
+func (controller controller) RecognizePartial(ctx context.Context, reader io.Reader, contentType AllowedContentType, requestedRecognisers []lib.RecogniserOptions) (PartialResult, error) {
 
+	session, err := controller.recognise(ctx, reader, contentType, requestedRecognisers, snippetReader.NewDocument(), nil)
+	if err != nil {
+		return PartialResult{}, err
+	}
+
+	reports := make(map[string]RecogniserReport, len(requestedRecognisers))
+	healthyRecognisers := make([]lib.RecogniserOptions, 0, len(requestedRecognisers))
 	for _, recogniser := range requestedRecognisers {
+		report := newRecogniserReport(session.errs[recogniser.Name])
+		reports[recogniser.Name] = report
+
+		// Whatever a failed recogniser found can't be trusted, but a timed out recogniser keeps its entities.
+		if report.Status != RecogniserFailed {
+			healthyRecognisers = append(healthyRecognisers, recogniser)
+		}
+	}
+
+	return PartialResult{
+		Entities:    controller.results(session, healthyRecognisers),
+		Recognisers: reports,
+	}, nil
+}
 
-		// check that requested recogniser has been configured on controller
-		validRecogniser, ok := controller.recognisers[recogniser.Name]
+// newRecogniserReport returns the report for a recogniser which finished with err.
+func newRecogniserReport(err error) RecogniserReport {
+	switch {
+	case err == nil:
+		return RecogniserReport{Status: RecogniserOK}
+	case errors.As(err, &RecogniserTimeoutError{}):
+		return RecogniserReport{Status: RecogniserTimedOut, Error: newRecogniserError(err)}
+	default:
+		return RecogniserReport{Status: RecogniserFailed, Error: newRecogniserError(err)}
+	}
+}
+
+// newRecogniserError works out what kind of failure err is.
+func newRecogniserError(err error) *RecogniserError {
+	recogniserErr := &RecogniserError{
+		Type:    ErrorUnknown,
+		Message: err.Error(),
+	}
+
+	var statusErr http_recogniser.StatusError
+	switch {
+	case errors.As(err, &RecogniserTimeoutError{}):
+		recogniserErr.Type = ErrorTimeout
+	case errors.As(err, &BlocklistLoadError{}):
+		recogniserErr.Type = ErrorBlocklist
+	case errors.As(err, &statusErr):
+		recogniserErr.Type = ErrorBadStatus
+		recogniserErr.StatusCode = statusErr.StatusCode
+	case errors.Is(err, syscall.ECONNREFUSED):
+		recogniserErr.Type = ErrorConnectionRefused
+	default:
+		// gRPC errors don't wrap the underlying network error, so all we have to go on is the status.
+		if grpcStatus, ok := status.FromError(err); ok {
+			if grpcStatus.Code() == codes.Unavailable && strings.Contains(grpcStatus.Message(), "connection refused") {
+				recogniserErr.Type = ErrorConnectionRefused
+			} else {
+				recogniserErr.Type = ErrorStreamReset
+			}
+		}
+	}
+
+	return recogniserErr
+}
+
+// results collects the entities found by each of the requested recognisers in session once recognise() has returned.
+// Overlapping entities are resolved across all the recognisers, with the recognisers' priority given by the order they
+// were requested in.
+func (controller controller) results(session session, requestedRecognisers []lib.RecogniserOptions) []lib.APIEntity {
+	var allowedEntities []*pb.Entity
+	sources := make(map[*pb.Entity]string) // the recogniser which found each entity
+	priority := make([]string, 0, len(requestedRecognisers))
+	for _, recogniser := range requestedRecognisers {
+		client, ok := session.clients[recogniser.Name]
 		if !ok {
-			return nil, HttpError{
+			continue
+		}
+		priority = append(priority, recogniser.Name)
+
+		// apply global blocklist
+		for _, entity := range controller.blocklist.FilterEntities(client.Result()) {
+			allowedEntities = append(allowedEntities, entity)
+			sources[entity] = recogniser.Name
+		}
+	}
+
+	resolvedEntities := lib.ResolveOverlaps(allowedEntities, controller.overlap, priority)
+
+	entitiesByRecogniser := make(map[string][]*pb.Entity, len(priority))
+	for _, entity := range resolvedEntities {
+		entitiesByRecogniser[sources[entity]] = append(entitiesByRecogniser[sources[entity]], entity)
+	}
+
+	APIEntities := make([]lib.APIEntity, 0)
+	for _, name := range priority {
+		APIEntities = append(APIEntities, filterUniqueEntities(entitiesByRecogniser[name], session.document)...)
+	}
+
+	return APIEntities
+}
+
+// RecognizeStream performs entity recognition in the same way as Recognize, but rather than waiting for every
+// recogniser to finish it executes onEntity as soon as any recogniser finds an entity. Each entity carries a single
+// position - entities are not merged by name because later positions may not have been found yet.
+// onEntity is never executed concurrently.
+func (controller controller) RecognizeStream(ctx context.Context, reader io.Reader, contentType AllowedContentType, requestedRecognisers []lib.RecogniserOptions, onEntity func(entity lib.APIEntity) error) (map[string]RecogniserStatus, error) {
+	mut := &sync.Mutex{}
+	document := snippetReader.NewDocument()
+	session, err := controller.recognise(ctx, reader, contentType, requestedRecognisers, document, func(entity *pb.Entity) error {
+		// apply global blocklist
+		if !controller.blocklist.Allowed(entity.Name) {
+			return nil
+		}
+
+		mut.Lock()
+		defer mut.Unlock()
+		return onEntity(newAPIEntity(entity, document))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recogniserStatuses(requestedRecognisers, session.errs)
+}
+
+// recogniserStatuses returns the status of each requested recogniser, or the first error which was not a timeout.
+func recogniserStatuses(requestedRecognisers []lib.RecogniserOptions, recogniserErrs map[string]error) (map[string]RecogniserStatus, error) {
+	statuses := make(map[string]RecogniserStatus, len(requestedRecognisers))
+	for _, recogniser := range requestedRecognisers {
+		err := recogniserErrs[recogniser.Name]
+		switch {
+		case err == nil:
+			statuses[recogniser.Name] = RecogniserOK
+		case errors.As(err, &RecogniserTimeoutError{}):
+			statuses[recogniser.Name] = RecogniserTimedOut
+		default:
+			return nil, err
+		}
+	}
+	return statuses, nil
+}
+
+// CheckRecognisers returns an HttpError if any of the requested recognisers have not been configured.
+func (controller controller) CheckRecognisers(requestedRecognisers []lib.RecogniserOptions) error {
+	for _, recogniser := range requestedRecognisers {
+		if _, ok := controller.recognisers[recogniser.Name]; !ok {
+			return HttpError{
 				code:  400,
 				error: fmt.Errorf("no such recogniser '%s'", recogniser.Name),
 			}
 		}
+	}
+	return nil
+}
 
-		validRecogniser.SetExactMatch(controller.exactMatch)
+// recognise creates a client for every requested recogniser, sends each of them the snippets read from reader, and waits
+// for them all to finish. onEntity, if not nil, is registered as the entity callback on each client.
+//
+// Each recogniser gets its own context derived from ctx, with the recogniser's timeout applied. If a recogniser's
+// context is done it is sent no more snippets, and its error is replaced with a RecogniserTimeoutError if it ran out
+// of time.
+//
+// Every snippet is added to document before it is sent to the recognisers, so that onEntity can locate the entities it
+// is given in document.
+//
+// The returned session holds the client of each recogniser which started, the error of each recogniser which failed,
+// and document. The returned error is only non-nil if recognition could not be performed at all, or if ctx is done.
+func (controller controller) recognise(ctx context.Context, reader io.Reader, contentType AllowedContentType, requestedRecognisers []lib.RecogniserOptions, document *snippetReader.Document, onEntity func(entity *pb.Entity) error) (session, error) {
+
+	// check that requested recognisers have been configured on controller
+	if err := controller.CheckRecognisers(requestedRecognisers); err != nil {
+		return session{}, err
+	}
 
-		channels[recogniser.Name] = make(chan snippetReader.Value)
-		err := validRecogniser.Recognise(channels[recogniser.Name], waitGroup, recogniser.HttpOptions)
-		if err != nil {
-			return nil, err
+	waitGroup := &sync.WaitGroup{}
+	channels := make(map[string]chan snippetReader.Value)
+	contexts := make(map[string]context.Context)
+	clients := make(map[string]recogniser.Client)
+	recogniserErrs := make(map[string]error)
+
+	for _, recogniser := range requestedRecognisers {
+		client := controller.recognisers[recogniser.Name].NewClient()
+
+		client.SetExactMatch(controller.exactMatch)
+		client.SetEntityCallback(onEntity)
+
+		recogniserCtx, cancel := controller.recogniserContext(ctx, recogniser.Name)
+		defer cancel()
+		contexts[recogniser.Name] = recogniserCtx
+
+		channel := make(chan snippetReader.Value)
+		if err := client.Recognise(recogniserCtx, channel, waitGroup, recogniser.HttpOptions); err != nil {
+			recogniserErrs[recogniser.Name] = err
+			continue
 		}
+		channels[recogniser.Name] = channel
+		clients[recogniser.Name] = client
 	}
 
 	var snippetReaderValues <-chan snippetReader.Value
@@ -134,35 +413,61 @@ func (controller controller) Recognize(reader io.Reader, contentType AllowedCont
 
 	// all the bits of text as snippets (with an error)
 	for snippetReaderValue := range snippetReaderValues {
+		// If the caller has gone away there is no point continuing. Let the reader finish in the background.
+		if ctx.Err() != nil {
+			go snippetReader.Drain(snippetReaderValues)
+			break
+		}
+
+		document.Add(snippetReaderValue)
+
 		// TODO could the snippetReaderValue.Err value be an actual error here?
-		SendToAll(snippetReaderValue, channels) // every value goes to every channel (recogniser) which is defined above
+		SendToAll(snippetReaderValue, channels, contexts) // every value goes to every channel (recogniser) which is defined above
 		if snippetReaderValue.Err != nil {
 			break
 		}
 	}
 
+	// Closing the channels lets any recogniser which was skipped by SendToAll know there is nothing more to come.
+	for _, channel := range channels {
+		close(channel)
+	}
 	waitGroup.Wait()
-	for _, recogniser := range requestedRecognisers {
-		if err := controller.recognisers[recogniser.Name].Err(); err != nil {
-			return nil, err
-		}
+
+	if err := ctx.Err(); err != nil {
+		return session{}, err
 	}
 
-	APIEntities := make([]lib.APIEntity, 0)
+	for name, client := range clients {
+		if err := client.Err(); err != nil {
+			recogniserErrs[name] = err
+		}
+	}
 
-	for _, recogniser := range requestedRecognisers {
-		recognisedEntities := controller.recognisers[recogniser.Name].Result()
+	for name := range recogniserErrs {
+		if errors.Is(contexts[name].Err(), context.DeadlineExceeded) {
+			recogniserErrs[name] = RecogniserTimeoutError{
+				Recogniser: name,
+				Timeout:    controller.timeouts[name],
+			}
+		}
+	}
 
-		// apply global blocklist
-		allowedEntities := controller.blocklist.FilterEntities(recognisedEntities)
+	return session{clients: clients, errs: recogniserErrs, document: document}, nil
+}
 
-		APIEntities = append(APIEntities, filterUniqueEntities(allowedEntities)...)
+// recogniserContext derives the context for a single recogniser from ctx, applying the recogniser's timeout if it
+// has one.
+func (controller controller) recogniserContext(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if timeout := controller.timeouts[name]; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
 	}
-
-	return APIEntities, nil
+	return context.WithCancel(ctx)
 }
 
-func filterUniqueEntities(entities []*pb.Entity) []lib.APIEntity {
+// filterUniqueEntities merges entities with the same name into a single lib.APIEntity with several positions, which are
+// located in document.
+func filterUniqueEntities(entities []*pb.Entity, document *snippetReader.Document) []lib.APIEntity {
 	uniqueEntities := make([]lib.APIEntity, 0)
 
 	for _, entity := range entities {
@@ -172,38 +477,57 @@ func filterUniqueEntities(entities []*pb.Entity) []lib.APIEntity {
 
 			if entity.Name == uniqueEntity.Name {
 				isUniqueEntity = false
-				newPosition := lib.Position{
-					Xpath:    entity.Xpath,
-					Position: entity.Position,
-				}
+				newPosition := newPosition(entity, document)
 				uniqueEntities[i].Positions = append(uniqueEntity.Positions, newPosition)
 				break
 			}
 		}
 
 		if isUniqueEntity {
-			APIEntity := lib.APIEntity{
-				Name:        entity.Name,
-				Recogniser:  entity.Recogniser,
-				Identifiers: entity.Identifiers,
-				Metadata:    entity.Metadata,
-				Positions: []lib.Position{
-					{
-						Xpath:    entity.Xpath,
-						Position: entity.Position,
-					},
-				},
-			}
-
-			uniqueEntities = append(uniqueEntities, APIEntity)
+			uniqueEntities = append(uniqueEntities, newAPIEntity(entity, document))
 		}
 	}
 
 	return uniqueEntities
 }
 
-func SendToAll(snipReaderValue snippetReader.Value, channels map[string]chan snippetReader.Value) {
-	for _, channel := range channels {
-		channel <- snipReaderValue
+// newAPIEntity converts entity into a lib.APIEntity with a single position, which is located in document.
+func newAPIEntity(entity *pb.Entity, document *snippetReader.Document) lib.APIEntity {
+	return lib.APIEntity{
+		Name:        entity.Name,
+		Recogniser:  entity.Recogniser,
+		Identifiers: entity.Identifiers,
+		Metadata:    entity.Metadata,
+		Positions:   []lib.Position{newPosition(entity, document)},
+	}
+}
+
+// newPosition returns where entity was found, in its element and in document.
+func newPosition(entity *pb.Entity, document *snippetReader.Document) lib.Position {
+	position := lib.Position{
+		Xpath:       entity.Xpath,
+		Position:    entity.Position,
+		EndPosition: entity.EndPosition,
+		Text:        entity.Text,
+	}
+
+	start, end := lib.EntitySpan(entity)
+	if location, ok := document.Locate(entity.Xpath, start, end); ok {
+		position.DocumentPosition = location.DocumentStart
+		position.DocumentEndPosition = location.DocumentEnd
+		position.SourcePosition = location.SourceStart
+		position.SourceEndPosition = location.SourceEnd
+	}
+	return position
+}
+
+// SendToAll sends snipReaderValue to every channel, skipping any channel whose recogniser's context is done
+// so that a recogniser which has stopped listening cannot block the others.
+func SendToAll(snipReaderValue snippetReader.Value, channels map[string]chan snippetReader.Value, contexts map[string]context.Context) {
+	for name, channel := range channels {
+		select {
+		case channel <- snipReaderValue:
+		case <-contexts[name].Done():
+		}
 	}
 }
@@ -14,27 +14,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/testhelpers"
+	htmlPackage "html"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
 	"gopkg.in/go-playground/assert.v1"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	http_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/http-recogniser"
 	mock_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/mocks/lib/recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
 	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ControllerSuite struct {
@@ -140,9 +154,8 @@ func (s *ControllerSuite) Test_controller_RecognizeInHTML() {
 	foundEntities := []*pb.Entity{entity, blocklistedEntity}
 
 	sentSnippet := &pb.Snippet{
-		Text:   "found entity\n",
-		Offset: 3,
-		Xpath:  "/p",
+		Text:  "found entity\n",
+		Xpath: "/p",
 	}
 
 	reader := strings.NewReader("<p>found entity</p>")
@@ -158,10 +171,12 @@ func (s *ControllerSuite) Test_controller_RecognizeInHTML() {
 	// The mock recogniser is a little complicated so read carefully!
 	mockRecogniser := &mock_recogniser.Client{}
 	mockRecogniser.On("SetExactMatch", true).Return()
+	mockRecogniser.On("SetEntityCallback", mock.Anything).Return()
 	s.controller.exactMatch = true
 
 	mockRecogniser.On("Recognise",
 		// Expected arguments
+		mock.Anything,
 		mock.AnythingOfType("<-chan snippet_reader.Value"),
 		mock.AnythingOfType("*sync.WaitGroup"),
 		lib.HttpOptions{},
@@ -175,9 +190,9 @@ func (s *ControllerSuite) Test_controller_RecognizeInHTML() {
 		// goroutine so that our replacement function doesn't block before read the html! While reading, use this
 		// opportunity to make assertions about the snippets that are being sent.
 		go func() {
-			waitGroup := args[1].(*sync.WaitGroup)
+			waitGroup := args[2].(*sync.WaitGroup)
 			waitGroup.Add(1)
-			err := snippet_reader.ReadChannelWithCallback(args[0].(<-chan snippet_reader.Value), func(snip *pb.Snippet) error {
+			err := snippet_reader.ReadChannelWithCallback(args[1].(<-chan snippet_reader.Value), func(snip *pb.Snippet) error {
 				s.Equal(sentSnippet, snip)
 				return nil
 			})
@@ -187,10 +202,10 @@ func (s *ControllerSuite) Test_controller_RecognizeInHTML() {
 	})
 	mockRecogniser.On("Err").Return(nil)
 	mockRecogniser.On("Result").Return(foundEntities)
-	s.controller.recognisers = map[string]recogniser.Client{"mock": mockRecogniser}
+	s.controller.recognisers = map[string]recogniser.Factory{"mock": clientFactory(mockRecogniser)}
 
 	opts := []lib.RecogniserOptions{{Name: "mock"}}
-	entities, err := s.controller.Recognize(reader, contentTypeHTML, opts)
+	entities, statuses, err := s.controller.Recognize(context.Background(), reader, contentTypeHTML, opts)
 
 	// entity should have been found
 	s.Equal(testhelpers.APIEntityFromEntity(foundEntities[0]), entities[0])
@@ -198,6 +213,407 @@ func (s *ControllerSuite) Test_controller_RecognizeInHTML() {
 	// entities should only contain the found entity, not the blocklisted entity
 	s.Len(entities, 1)
 	s.Nil(err)
+	s.Equal(map[string]RecogniserStatus{"mock": RecogniserOK}, statuses)
+}
+
+func (s *ControllerSuite) Test_controller_RecognizeStream() {
+	entity := &pb.Entity{
+		Name:       "found entity",
+		Position:   0,
+		Xpath:      "/p",
+		Recogniser: "mock",
+	}
+	blocklistedEntity := &pb.Entity{
+		Name:       "blocklisted entity",
+		Position:   20,
+		Xpath:      "/p",
+		Recogniser: "mock",
+	}
+
+	s.controller.blocklist = blocklist.Blocklist{
+		CaseSensitive:   map[string]bool{},
+		CaseInsensitive: map[string]bool{"blocklisted entity": true},
+	}
+	s.controller.exactMatch = false
+
+	// The mock recogniser calls the registered entity callback for each entity it "finds" while it is still reading
+	// snippets, which is how the real recognisers behave when streaming.
+	var onEntity func(*pb.Entity) error
+	mockRecogniser := &mock_recogniser.Client{}
+	mockRecogniser.On("SetExactMatch", false).Return()
+	mockRecogniser.On("SetEntityCallback", mock.Anything).Return().Run(func(args mock.Arguments) {
+		onEntity = args[0].(func(*pb.Entity) error)
+	})
+	mockRecogniser.On("Recognise",
+		mock.Anything,
+		mock.AnythingOfType("<-chan snippet_reader.Value"),
+		mock.AnythingOfType("*sync.WaitGroup"),
+		lib.HttpOptions{},
+	).Return(nil).Run(func(args mock.Arguments) {
+		waitGroup := args[2].(*sync.WaitGroup)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			err := snippet_reader.ReadChannelWithCallback(args[1].(<-chan snippet_reader.Value), func(snip *pb.Snippet) error {
+				if err := onEntity(entity); err != nil {
+					return err
+				}
+				return onEntity(blocklistedEntity)
+			})
+			s.Nil(err)
+		}()
+	})
+	mockRecogniser.On("Err").Return(nil)
+	s.controller.recognisers = map[string]recogniser.Factory{"mock": clientFactory(mockRecogniser)}
+
+	var streamed []lib.APIEntity
+	_, err := s.controller.RecognizeStream(context.Background(), strings.NewReader("<p>found entity</p>"), contentTypeHTML, []lib.RecogniserOptions{{Name: "mock"}}, func(entity lib.APIEntity) error {
+		streamed = append(streamed, entity)
+		return nil
+	})
+
+	s.Nil(err)
+	s.Equal([]lib.APIEntity{paragraphAPIEntity(entity)}, streamed)
+	mockRecogniser.AssertNotCalled(s.T(), "Result")
+}
+
+func (s *ControllerSuite) Test_controller_Recognize_Timeout() {
+	fastEntity := &pb.Entity{Name: "fast", Position: 3, Xpath: "/p", Recogniser: "fast"}
+	slowEntity := &pb.Entity{Name: "slow", Position: 3, Xpath: "/p", Recogniser: "slow"}
+	s.controller.blocklist = blocklist.Blocklist{}
+	s.controller.timeouts = map[string]time.Duration{"slow": 50 * time.Millisecond}
+
+	fastRecogniser := &mock_recogniser.Client{}
+	fastRecogniser.On("SetExactMatch", mock.Anything).Return()
+	fastRecogniser.On("SetEntityCallback", mock.Anything).Return()
+	fastRecogniser.On("Recognise", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		waitGroup := args[2].(*sync.WaitGroup)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			s.Nil(snippet_reader.ReadChannelWithCallback(args[1].(<-chan snippet_reader.Value), func(*pb.Snippet) error { return nil }))
+		}()
+	})
+	fastRecogniser.On("Err").Return(nil)
+	fastRecogniser.On("Result").Return([]*pb.Entity{fastEntity})
+
+	// The slow recogniser finds one entity, then stops listening until its context is cancelled. Without a deadline
+	// this would block the controller forever.
+	var slowErr error
+	slowRecogniser := &mock_recogniser.Client{}
+	slowRecogniser.On("SetExactMatch", mock.Anything).Return()
+	slowRecogniser.On("SetEntityCallback", mock.Anything).Return()
+	slowRecogniser.On("Recognise", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		waitGroup := args[2].(*sync.WaitGroup)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			<-args[1].(<-chan snippet_reader.Value)
+			<-ctx.Done()
+			slowErr = ctx.Err()
+		}()
+	})
+	slowRecogniser.On("Err").Return(func() error { return slowErr })
+	slowRecogniser.On("Result").Return([]*pb.Entity{slowEntity})
+
+	s.controller.recognisers = map[string]recogniser.Factory{"fast": clientFactory(fastRecogniser), "slow": clientFactory(slowRecogniser)}
+
+	reader := strings.NewReader("<div><p>one</p><p>two</p><p>three</p></div>")
+	opts := []lib.RecogniserOptions{{Name: "fast"}, {Name: "slow"}}
+	entities, statuses, err := s.controller.Recognize(context.Background(), reader, contentTypeHTML, opts)
+
+	s.Nil(err)
+	s.Equal(map[string]RecogniserStatus{"fast": RecogniserOK, "slow": RecogniserTimedOut}, statuses)
+	s.Equal([]lib.APIEntity{testhelpers.APIEntityFromEntity(fastEntity), testhelpers.APIEntityFromEntity(slowEntity)}, entities)
+	s.controller.timeouts = nil
+}
+
+func (s *ControllerSuite) Test_controller_RecognizePartial() {
+	entity := &pb.Entity{Name: "found entity", Position: 0, Xpath: "/p", Recogniser: "healthy"}
+	brokenEntity := &pb.Entity{Name: "broken entity", Position: 0, Xpath: "/p", Recogniser: "broken"}
+	statusErr := http_recogniser.StatusError{Url: "http://leadmine", StatusCode: 502}
+	blocklistErr := BlocklistLoadError{Path: "missing.yml", Err: os.ErrNotExist}
+
+	s.controller.blocklist = blocklist.Blocklist{}
+	s.controller.recognisers = map[string]recogniser.Factory{
+		"healthy":     clientFactory(newJobTestRecogniser([]*pb.Entity{entity}, nil)),
+		"broken":      clientFactory(newJobTestRecogniser([]*pb.Entity{brokenEntity}, statusErr)),
+		"unavailable": unavailableRecogniser{err: blocklistErr},
+	}
+
+	opts := []lib.RecogniserOptions{{Name: "healthy"}, {Name: "broken"}, {Name: "unavailable"}}
+	result, err := s.controller.RecognizePartial(context.Background(), strings.NewReader("<p>found entity</p>"), contentTypeHTML, opts)
+
+	s.Nil(err)
+	s.Equal(PartialResult{
+		Entities: []lib.APIEntity{paragraphAPIEntity(entity)},
+		Recognisers: map[string]RecogniserReport{
+			"healthy": {Status: RecogniserOK},
+			"broken": {
+				Status: RecogniserFailed,
+				Error:  &RecogniserError{Type: ErrorBadStatus, Message: statusErr.Error(), StatusCode: 502},
+			},
+			"unavailable": {
+				Status: RecogniserFailed,
+				Error:  &RecogniserError{Type: ErrorBlocklist, Message: blocklistErr.Error()},
+			},
+		},
+	}, result)
+
+	// Without partial results, the first failure fails the whole request.
+	s.controller.recognisers["broken"] = clientFactory(newJobTestRecogniser(nil, statusErr))
+	_, _, err = s.controller.Recognize(context.Background(), strings.NewReader("<p>found entity</p>"), contentTypeHTML, opts[:2])
+	s.Equal(statusErr, err)
+}
+
+func (s *ControllerSuite) Test_controller_Recognize_Overlap() {
+	sodium := &pb.Entity{Name: "sodium", Position: 0, Xpath: "/p", Recogniser: "dictionary"}
+	sodiumChloride := &pb.Entity{Name: "sodium chloride", Position: 0, Xpath: "/p", Recogniser: "dictionary"}
+	chloride := &pb.Entity{Name: "chloride", Position: 7, Xpath: "/p", Recogniser: "dictionary"}
+	leadmineChloride := &pb.Entity{Name: "chloride", Position: 7, Xpath: "/p", Recogniser: "leadmine"}
+
+	tests := []struct {
+		name        string
+		overlap     lib.OverlapStrategy
+		recognisers []lib.RecogniserOptions
+		want        []*pb.Entity
+	}{
+		{
+			name:        "keep all",
+			overlap:     lib.KeepAll,
+			recognisers: []lib.RecogniserOptions{{Name: "dictionary"}, {Name: "leadmine"}},
+			want:        []*pb.Entity{sodium, sodiumChloride, chloride, leadmineChloride},
+		},
+		{
+			name:        "longest wins across recognisers",
+			overlap:     lib.LongestWins,
+			recognisers: []lib.RecogniserOptions{{Name: "dictionary"}, {Name: "leadmine"}},
+			want:        []*pb.Entity{sodiumChloride},
+		},
+		{
+			name:        "priority follows request order",
+			overlap:     lib.RecogniserPriority,
+			recognisers: []lib.RecogniserOptions{{Name: "leadmine"}, {Name: "dictionary"}},
+			want:        []*pb.Entity{leadmineChloride, sodium},
+		},
+	}
+	for _, tt := range tests {
+		s.T().Log(tt.name)
+		ctrl := controller{
+			recognisers: map[string]recogniser.Factory{
+				"dictionary": clientFactory(newJobTestRecogniser([]*pb.Entity{sodium, sodiumChloride, chloride}, nil)),
+				"leadmine":   clientFactory(newJobTestRecogniser([]*pb.Entity{leadmineChloride}, nil)),
+			},
+			htmlReader: html.SnippetReader{},
+			overlap:    tt.overlap,
+		}
+
+		entities, _, err := ctrl.Recognize(context.Background(), strings.NewReader("<p>sodium chloride</p>"), contentTypeHTML, tt.recognisers)
+		s.Nil(err)
+
+		want := make([]lib.APIEntity, len(tt.want))
+		for i, entity := range tt.want {
+			want[i] = paragraphAPIEntity(entity)
+		}
+		s.Equal(want, entities)
+	}
+}
+
+// Every entity's document offsets must find its text in the /text output, and its source offsets must find it in the
+// HTML once tags and character references are dealt with.
+func (s *ControllerSuite) Test_controller_Recognize_Offsets() {
+	source, err := ioutil.ReadFile("../../resources/acetylcarnitine.html")
+	s.Require().Nil(err)
+	documentText, err := ioutil.ReadFile("../../resources/acetylcarnitine.txt")
+	s.Require().Nil(err)
+	documentRunes := []rune(string(documentText))
+
+	ctrl := controller{
+		recognisers: map[string]recogniser.Factory{"echo": newEchoFactory()},
+		htmlReader:  html.SnippetReader{},
+	}
+	entities, _, err := ctrl.Recognize(context.Background(), bytes.NewReader(source), contentTypeHTML, []lib.RecogniserOptions{{Name: "echo"}})
+	s.Require().Nil(err)
+	s.Require().NotEmpty(entities)
+
+	// A few entities, including ones after and made of multibyte characters, are checked against known offsets.
+	b, err := ioutil.ReadFile("../../resources/acetylcarnitine-entities.json")
+	s.Require().Nil(err)
+	var expectedEntities []lib.APIEntity
+	s.Require().Nil(json.Unmarshal(b, &expectedEntities))
+	golden := make(map[string]bool, len(expectedEntities))
+	for _, entity := range expectedEntities {
+		golden[entity.Name] = true
+	}
+	var goldenEntities []lib.APIEntity
+	for _, entity := range entities {
+		if golden[entity.Name] {
+			goldenEntities = append(goldenEntities, entity)
+		}
+	}
+	s.Equal(expectedEntities, goldenEntities)
+
+	tags := regexp.MustCompile("<[^>]*>")
+	for _, entity := range entities {
+		for _, position := range entity.Positions {
+			s.Require().LessOrEqual(int(position.DocumentEndPosition), len(documentRunes))
+			s.Equal(position.Text, string(documentRunes[position.DocumentPosition:position.DocumentEndPosition]), "document offsets of %+v", position)
+
+			sourceText := source[position.SourcePosition:position.SourceEndPosition]
+			s.Equal(position.Text, htmlPackage.UnescapeString(tags.ReplaceAllString(string(sourceText), "")), "source offsets of %+v", position)
+		}
+	}
+}
+
+// echoRecogniser reports every token it is sent as an entity. Unlike a mock, it holds per-request state the way
+// the real recognisers do, so it shows up any sharing of clients between requests.
+type echoRecogniser struct {
+	exactMatch bool
+	onEntity   func(entity *pb.Entity) error
+	entities   []*pb.Entity
+	err        error
+}
+
+func (e *echoRecogniser) Recognise(_ context.Context, snipReaderValues <-chan snippet_reader.Value, waitGroup *sync.WaitGroup, _ lib.HttpOptions) error {
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+		e.err = snippet_reader.ReadChannelWithCallback(snipReaderValues, func(snippet *pb.Snippet) error {
+			return text.Tokenize(snippet, func(token *pb.Snippet) error {
+				entity := &pb.Entity{
+					Name:        token.Text,
+					Position:    token.Offset,
+					EndPosition: token.Offset + uint32(utf8.RuneCountInString(token.Text)),
+					Text:        token.Text,
+					Xpath:       token.Xpath,
+					Recogniser:  "echo",
+				}
+				e.entities = append(e.entities, entity)
+				if e.onEntity != nil {
+					return e.onEntity(entity)
+				}
+				return nil
+			}, e.exactMatch)
+		})
+	}()
+	return nil
+}
+
+func (e *echoRecogniser) Err() error {
+	return e.err
+}
+
+func (e *echoRecogniser) Result() []*pb.Entity {
+	return e.entities
+}
+
+func (e *echoRecogniser) SetExactMatch(exactMatch bool) {
+	e.exactMatch = exactMatch
+}
+
+func (e *echoRecogniser) SetEntityCallback(onEntity func(entity *pb.Entity) error) {
+	e.onEntity = onEntity
+}
+
+func newEchoFactory() recogniser.Factory {
+	return recogniser.FactoryFunc(func() recogniser.Client {
+		return &echoRecogniser{}
+	})
+}
+
+// paragraphAPIEntity returns the lib.APIEntity for entity, which was found in a document made up of a single <p>
+// element containing ASCII text.
+func paragraphAPIEntity(entity *pb.Entity) lib.APIEntity {
+	apiEntity := testhelpers.APIEntityFromEntity(entity)
+	start, end := lib.EntitySpan(entity)
+	position := &apiEntity.Positions[0]
+	position.DocumentPosition, position.DocumentEndPosition = start, end
+	position.SourcePosition, position.SourceEndPosition = start+uint32(len("<p>")), end+uint32(len("<p>"))
+	return apiEntity
+}
+
+// entityNames returns the set of entity names in entities.
+func entityNames(entities []lib.APIEntity) map[string]bool {
+	names := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		names[entity.Name] = true
+	}
+	return names
+}
+
+// Run with -race: concurrent requests must not share recogniser state or exact-match settings.
+func (s *ControllerSuite) Test_controller_Recognize_Concurrent() {
+	ctrl := controller{
+		recognisers: map[string]recogniser.Factory{"echo": newEchoFactory()},
+		htmlReader:  html.SnippetReader{},
+	}
+
+	const requests = 50
+	results := make([]map[string]bool, requests)
+	errs := make([]error, requests)
+	waitGroup := &sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			requestController := ctrl
+			requestController.exactMatch = i%2 == 0
+			document := fmt.Sprintf("<p>doc%d some-text</p>", i)
+			entities, _, err := requestController.Recognize(context.Background(), strings.NewReader(document), contentTypeHTML, []lib.RecogniserOptions{{Name: "echo"}})
+			results[i], errs[i] = entityNames(entities), err
+		}(i)
+	}
+	waitGroup.Wait()
+
+	for i := 0; i < requests; i++ {
+		s.Nil(errs[i])
+		names := results[i]
+		s.True(names[fmt.Sprintf("doc%d", i)], "request %d is missing its own entity", i)
+		// "some-text" is only a single token with exact matching.
+		s.Equal(i%2 == 0, names["some-text"], "request %d has the wrong exact-match setting", i)
+		expected := 2
+		if i%2 != 0 {
+			expected = 4 // "some", "-", "text"
+		}
+		s.Len(names, expected, "request %d has entities from another request: %v", i, names)
+	}
+}
+
+// clientFactory returns a factory which always returns client, for tests which only make one request.
+func clientFactory(client recogniser.Client) recogniser.Factory {
+	return recogniser.FactoryFunc(func() recogniser.Client {
+		return client
+	})
+}
+
+func TestNewRecogniserError(t *testing.T) {
+	connRefused := &url.Error{Op: "Post", URL: "http://leadmine", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}}
+
+	tests := []struct {
+		name string
+		err  error
+		want RecogniserErrorType
+	}{
+		{"timeout", RecogniserTimeoutError{Recogniser: "slow", Timeout: time.Second}, ErrorTimeout},
+		{"blocklist", BlocklistLoadError{Path: "missing.yml", Err: os.ErrNotExist}, ErrorBlocklist},
+		{"bad status", http_recogniser.StatusError{Url: "http://leadmine", StatusCode: 500}, ErrorBadStatus},
+		{"http connection refused", connRefused, ErrorConnectionRefused},
+		{"grpc connection refused", status.Error(codes.Unavailable, "connection error: desc = \"transport: Error while dialing dial tcp [::1]:50051: connect: connection refused\""), ErrorConnectionRefused},
+		{"grpc stream reset", status.Error(codes.Internal, "stream terminated by RST_STREAM with error code: PROTOCOL_ERROR"), ErrorStreamReset},
+		{"unknown", errors.New("something else"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newRecogniserError(tt.err)
+			assert.Equal(t, tt.want, got.Type)
+			assert.Equal(t, tt.err.Error(), got.Message)
+		})
+	}
 }
 
 func TestFilterUniqueEntities(t *testing.T) {
@@ -244,7 +660,7 @@ func TestFilterUniqueEntities(t *testing.T) {
 		},
 	}
 
-	actual := filterUniqueEntities(input)
+	actual := filterUniqueEntities(input, snippet_reader.NewDocument())
 
 	assert.Equal(t, expected, actual)
 
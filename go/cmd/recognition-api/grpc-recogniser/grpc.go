@@ -26,6 +26,21 @@ import (
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
 )
 
+// NewFactory returns a recogniser.Factory which creates a grpcRecogniser for each request. The gRPC client
+// (and so the connection) is shared between them. If wholeSnippets is true, snippets are sent to the recogniser as
+// they are instead of being tokenised first, for recognisers which can match text spanning several tokens. The
+// recogniser is told which it is sent in the metadata of each stream, see recogniser.WithWholeSnippets.
+func NewFactory(name string, client pb.RecognizerClient, blocklist blocklist.Blocklist, wholeSnippets bool) recogniser.Factory {
+	return recogniser.FactoryFunc(func() recogniser.Client {
+		return &grpcRecogniser{
+			Name:          name,
+			client:        client,
+			blocklist:     blocklist,
+			wholeSnippets: wholeSnippets,
+		}
+	})
+}
+
 func New(name string, client pb.RecognizerClient, blocklist blocklist.Blocklist) recogniser.Client {
 	return &grpcRecogniser{
 		Name:      name,
@@ -40,53 +55,76 @@ func New(name string, client pb.RecognizerClient, blocklist blocklist.Blocklist)
 type grpcRecogniser struct {
 	Name       string
 	client     pb.RecognizerClient
+	errMu      sync.Mutex // guards err, which is set by both the sending and the receiving goroutines
 	err        error
 	entities   []*pb.Entity
 	stream     pb.Recognizer_GetStreamClient
 	blocklist  blocklist.Blocklist
 	exactMatch bool
+	onEntity   func(entity *pb.Entity) error
+	// wholeSnippets sends snippets without tokenising them.
+	wholeSnippets bool
 }
 
 func (g *grpcRecogniser) SetExactMatch(exact bool) {
 	g.exactMatch = exact
 }
 
-func (g *grpcRecogniser) Recognise(snipReaderValues <-chan snippet_reader.Value, wg *sync.WaitGroup, _ lib.HttpOptions) error {
+func (g *grpcRecogniser) SetEntityCallback(onEntity func(entity *pb.Entity) error) {
+	g.onEntity = onEntity
+}
+
+// Recognise opens a stream to the gRPC recogniser and starts sending it tokens. The stream is cancelled when ctx is done.
+func (g *grpcRecogniser) Recognise(ctx context.Context, snipReaderValues <-chan snippet_reader.Value, wg *sync.WaitGroup, _ lib.HttpOptions) error {
 	g.reset()
 
+	ctx, cancel := context.WithCancel(ctx)
+	if g.wholeSnippets {
+		ctx = recogniser.WithWholeSnippets(ctx)
+	}
 	var err error
-	g.stream, err = g.client.GetStream(context.Background())
+	g.stream, err = g.client.GetStream(ctx)
 	if err != nil {
+		cancel()
 		return err
 	}
 
-	go g.recognise(snipReaderValues, wg)
+	// Add to the wait group before starting the goroutine, otherwise the caller might finish waiting before we've begun.
+	wg.Add(1)
+	go g.recognise(snipReaderValues, wg, cancel)
 
 	return nil
 }
 
 func (g *grpcRecogniser) reset() {
-	g.err = nil
+	g.setErr(nil)
 	g.entities = nil
 	g.stream = nil
 }
 
-// This function doesn't return anything. Instead we expect the caller to check `recogniser.Err()` when the
-// wait group completes.
-func (g *grpcRecogniser) recognise(snipReaderValues <-chan snippet_reader.Value, wg *sync.WaitGroup) {
-	// Add to the work group - makes the caller wait.
-	wg.Add(1)
+// setErr records err as the recogniser's error, unless there already is one. A nil err clears it.
+func (g *grpcRecogniser) setErr(err error) {
+	g.errMu.Lock()
+	defer g.errMu.Unlock()
+	if err == nil || g.err == nil {
+		g.err = err
+	}
+}
 
+// This function doesn't return anything. Instead we expect the caller to check `recogniser.Err()` when the
+// wait group completes. The caller must have added one to wg, and cancel cancels the stream.
+func (g *grpcRecogniser) recognise(snipReaderValues <-chan snippet_reader.Value, wg *sync.WaitGroup, cancel context.CancelFunc) {
 	// In a separate goroutine, listen on the stream for entities and append to the entities field of the receiver.
 	// The stream will exit successfully with an io.EOF. Only call wg.Done() when we've finished listening to the response.
 	go func() {
 		defer wg.Done()
+		defer cancel()
 		for {
 			entity, err := g.stream.Recv()
 			if err == io.EOF {
 				return
 			} else if err != nil {
-				g.err = err
+				g.setErr(err)
 				return
 			}
 
@@ -94,19 +132,37 @@ func (g *grpcRecogniser) recognise(snipReaderValues <-chan snippet_reader.Value,
 				continue
 			}
 
-			g.entities = append(g.entities, &pb.Entity{
+			recognisedEntity := &pb.Entity{
 				Name:        entity.Name,
 				Position:    entity.Position,
 				Xpath:       entity.Xpath,
 				Recogniser:  g.Name,
 				Identifiers: entity.Identifiers,
 				Metadata:    entity.Metadata,
-			})
+				EndPosition: entity.EndPosition,
+				Text:        entity.Text,
+			}
+			g.entities = append(g.entities, recognisedEntity)
+
+			// Hand the entity straight to the caller if they want to stream results.
+			if g.onEntity != nil {
+				if err := g.onEntity(recognisedEntity); err != nil {
+					// e.g. the client streaming the results has gone away. Cancel the stream, otherwise the recogniser
+					// would be left blocked sending us entities which nobody will read.
+					g.setErr(err)
+					cancel()
+					return
+				}
+			}
 		}
 	}()
 
-	// Read from the input channel, tokenise the snippets we read and send them on the stream.
+	// Read from the input channel, tokenise the snippets we read (unless the recogniser wants whole snippets) and send
+	// them on the stream.
 	err := snippet_reader.ReadChannelWithCallback(snipReaderValues, func(snippet *pb.Snippet) error {
+		if g.wholeSnippets {
+			return g.stream.Send(snippet)
+		}
 		return text.Tokenize(snippet, func(snippet *pb.Snippet) error {
 			if err := g.stream.Send(snippet); err != nil {
 				return err
@@ -115,18 +171,23 @@ func (g *grpcRecogniser) recognise(snipReaderValues <-chan snippet_reader.Value,
 		}, g.exactMatch)
 	})
 	if err != nil {
-		g.err = err
+		g.setErr(err)
+
+		// We've stopped reading, but the caller may still be sending. Discard the rest so they don't block.
+		snippet_reader.Drain(snipReaderValues)
 	}
 
 	// Close the stream. This lets the server know we've stopped sending, then it will know to send an io.EOF
 	// back to us.
 	if err := g.stream.CloseSend(); err != nil {
-		g.err = err
+		g.setErr(err)
 		return
 	}
 }
 
 func (g *grpcRecogniser) Err() error {
+	g.errMu.Lock()
+	defer g.errMu.Unlock()
 	return g.err
 }
 
@@ -14,16 +14,23 @@
 package grpc_recogniser
 
 import (
+	"context"
+	"errors"
 	"io"
 	"strings"
 	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mocks "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/mocks/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/testhelpers"
+	"google.golang.org/grpc/metadata"
 )
 
 func Test_grpcRecogniser_recognise(t *testing.T) {
@@ -51,11 +58,11 @@ func Test_grpcRecogniser_recognise(t *testing.T) {
 	// This mock stream must match the text that has been supplied to the recogniser
 	// in the snipChan
 	mockRecognizer_RecognizeClient := testhelpers.NewMockRecognizeClientStream(
-		testhelpers.CreateSnippet("found", "", 3, "/p"),
-		testhelpers.CreateSnippet("entity", "", 9, "/p"),
+		testhelpers.CreateSnippet("found", "", 0, "/p"),
+		testhelpers.CreateSnippet("entity", "", 6, "/p"),
 
 		// this should be blocklisted and therefore does not feature in expectedRecognisedEntities
-		testhelpers.CreateSnippet("protein", "", 23, "/p"),
+		testhelpers.CreateSnippet("protein", "", 0, "/p"),
 	)
 
 	// mock the grpc server's response
@@ -77,7 +84,8 @@ func Test_grpcRecogniser_recognise(t *testing.T) {
 	}
 
 	waitGroup := &sync.WaitGroup{}
-	testRecogniser.recognise(snipChan, waitGroup)
+	waitGroup.Add(1)
+	testRecogniser.recognise(snipChan, waitGroup, func() {})
 
 	waitGroup.Wait()
 
@@ -85,3 +93,132 @@ func Test_grpcRecogniser_recognise(t *testing.T) {
 	assert.Nil(t, testRecogniser.err)
 	assert.EqualValues(t, expectedRecognisedEntities, testRecogniser.entities)
 }
+
+func Test_grpcRecogniser_recognise_entityCallback(t *testing.T) {
+	foundEntity := &pb.Entity{
+		Name:        "found entity",
+		Position:    3,
+		Recogniser:  "test",
+		Xpath:       "/p",
+		Identifiers: map[string]string{"many": "", "things": ""},
+	}
+
+	snipChan := html.SnippetReader{}.ReadSnippets(strings.NewReader("<p>found entity</p>"))
+
+	mockRecognizer_RecognizeClient := testhelpers.NewMockRecognizeClientStream(
+		testhelpers.CreateSnippet("found", "", 0, "/p"),
+		testhelpers.CreateSnippet("entity", "", 6, "/p"),
+	)
+	mockRecognizer_RecognizeClient.On("Recv").Return(foundEntity, nil).Once()
+	mockRecognizer_RecognizeClient.On("Recv").Return(nil, io.EOF).Once()
+
+	var streamedEntities []*pb.Entity
+	testRecogniser := grpcRecogniser{
+		Name:   "test",
+		stream: mockRecognizer_RecognizeClient,
+		onEntity: func(entity *pb.Entity) error {
+			streamedEntities = append(streamedEntities, entity)
+			return nil
+		},
+	}
+
+	waitGroup := &sync.WaitGroup{}
+	waitGroup.Add(1)
+	testRecogniser.recognise(snipChan, waitGroup, func() {})
+
+	waitGroup.Wait()
+
+	mockRecognizer_RecognizeClient.AssertExpectations(t)
+	assert.Nil(t, testRecogniser.err)
+	assert.EqualValues(t, []*pb.Entity{foundEntity}, streamedEntities)
+	assert.EqualValues(t, streamedEntities, testRecogniser.entities)
+}
+
+func Test_grpcRecogniser_recognise_wholeSnippets(t *testing.T) {
+	foundEntity := &pb.Entity{
+		Name:        "EC 1.1.1.1",
+		Position:    4,
+		EndPosition: 14,
+		Text:        "EC 1.1.1.1",
+		Recogniser:  "test",
+		Xpath:       "/p",
+		Identifiers: map[string]string{"ec": "EC 1.1.1.1"},
+	}
+
+	snipChan := html.SnippetReader{}.ReadSnippets(strings.NewReader("<p>the EC 1.1.1.1 enzyme</p>"))
+
+	// the snippet is sent as it is, not as tokens
+	mockRecognizer_RecognizeClient := testhelpers.NewMockRecognizeClientStream(
+		testhelpers.CreateSnippet("the EC 1.1.1.1 enzyme\n", "", 0, "/p"),
+	)
+	mockRecognizer_RecognizeClient.On("Recv").Return(foundEntity, nil).Once()
+	mockRecognizer_RecognizeClient.On("Recv").Return(nil, io.EOF).Once()
+
+	testRecogniser := grpcRecogniser{
+		Name:          "test",
+		stream:        mockRecognizer_RecognizeClient,
+		wholeSnippets: true,
+	}
+
+	waitGroup := &sync.WaitGroup{}
+	waitGroup.Add(1)
+	testRecogniser.recognise(snipChan, waitGroup, func() {})
+
+	waitGroup.Wait()
+
+	mockRecognizer_RecognizeClient.AssertExpectations(t)
+	assert.Nil(t, testRecogniser.err)
+	assert.EqualValues(t, []*pb.Entity{foundEntity}, testRecogniser.entities)
+}
+
+func Test_grpcRecogniser_Recognise_entityCallbackError(t *testing.T) {
+	foundEntity := &pb.Entity{Name: "found entity", Xpath: "/p"}
+
+	snipChan := html.SnippetReader{}.ReadSnippets(strings.NewReader("<p>found entity</p>"))
+
+	mockRecognizer_RecognizeClient := testhelpers.NewMockRecognizeClientStream(
+		testhelpers.CreateSnippet("found", "", 0, "/p"),
+		testhelpers.CreateSnippet("entity", "", 6, "/p"),
+	)
+	mockRecognizer_RecognizeClient.On("Recv").Return(foundEntity, nil).Once()
+
+	var streamCtx context.Context
+	mockClient := &mocks.RecognizerClient{}
+	mockClient.On("GetStream", mock.Anything).Return(mockRecognizer_RecognizeClient, nil).Run(func(args mock.Arguments) {
+		streamCtx = args[0].(context.Context)
+	})
+
+	// e.g. the client streaming the results has disconnected.
+	disconnected := errors.New("client disconnected")
+	testRecogniser := NewFactory("test", mockClient, blocklist.Blocklist{}, false).NewClient()
+	testRecogniser.SetEntityCallback(func(*pb.Entity) error {
+		return disconnected
+	})
+
+	waitGroup := &sync.WaitGroup{}
+	err := testRecogniser.Recognise(context.Background(), snipChan, waitGroup, lib.HttpOptions{})
+	assert.NoError(t, err)
+
+	// Recognise has counted the work before returning, so waiting waits for the entity to be received.
+	waitGroup.Wait()
+	assert.Equal(t, disconnected, testRecogniser.Err())
+	// the stream is cancelled, so the recogniser isn't left blocked sending entities.
+	assert.Equal(t, context.Canceled, streamCtx.Err())
+}
+
+func Test_grpcRecogniser_Recognise_wholeSnippetsMetadata(t *testing.T) {
+	for _, wholeSnippets := range []bool{false, true} {
+		var streamCtx context.Context
+		mockClient := &mocks.RecognizerClient{}
+		mockClient.On("GetStream", mock.Anything).Return(nil, errors.New("unavailable")).Run(func(args mock.Arguments) {
+			streamCtx = args[0].(context.Context)
+		})
+
+		testRecogniser := NewFactory("test", mockClient, blocklist.Blocklist{}, wholeSnippets).NewClient()
+		_ = testRecogniser.Recognise(context.Background(), nil, &sync.WaitGroup{}, lib.HttpOptions{})
+
+		// the recogniser receives the stream's outgoing metadata as incoming metadata.
+		md, _ := metadata.FromOutgoingContext(streamCtx)
+		assert.Equal(t, wholeSnippets, recogniser.WholeSnippets(metadata.NewIncomingContext(context.Background(), md)))
+	}
+}
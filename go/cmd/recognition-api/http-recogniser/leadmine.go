@@ -18,6 +18,7 @@
 package http_recogniser
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,6 +28,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
@@ -35,6 +37,13 @@ import (
 	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
 )
 
+// NewLeadmineFactory returns a recogniser.Factory which creates a leadmine client for each request.
+func NewLeadmineFactory(name, url string, blocklist blocklist.Blocklist) recogniser.Factory {
+	return recogniser.FactoryFunc(func() recogniser.Client {
+		return NewLeadmineClient(name, url, blocklist)
+	})
+}
+
 func NewLeadmineClient(name, url string, blocklist blocklist.Blocklist) recogniser.Client {
 	return &leadmine{
 		Name:       name,
@@ -52,12 +61,17 @@ type leadmine struct {
 	entities   []*pb.Entity
 	blocklist  blocklist.Blocklist
 	exactMatch bool
+	onEntity   func(entity *pb.Entity) error
 }
 
 func (l *leadmine) SetExactMatch(exact bool) {
 	l.exactMatch = exact
 }
 
+func (l *leadmine) SetEntityCallback(onEntity func(entity *pb.Entity) error) {
+	l.onEntity = onEntity
+}
+
 func (l *leadmine) reset() {
 	l.err = nil
 	l.entities = nil
@@ -93,15 +107,17 @@ func (l *leadmine) handleError(err error) {
 }
 
 // Recognise calls the helper method l.recognise to call Leadmine Web Service to perform entity recognition.
-// Found entities are put into l.entities, and errors into l.err.
-func (l *leadmine) Recognise(snipReaderValues <-chan snippet_reader.Value, waitGroup *sync.WaitGroup, httpOptions lib.HttpOptions) error {
+// Found entities are put into l.entities, and errors into l.err. The HTTP request is cancelled when ctx is done.
+func (l *leadmine) Recognise(ctx context.Context, snipReaderValues <-chan snippet_reader.Value, waitGroup *sync.WaitGroup, httpOptions lib.HttpOptions) error {
 	l.reset()
-	go l.recognise(snipReaderValues, waitGroup, httpOptions)
+
+	// Add to the wait group before starting the goroutine, otherwise the caller might finish waiting before we've begun.
+	waitGroup.Add(1)
+	go l.recognise(ctx, snipReaderValues, waitGroup, httpOptions)
 	return nil
 }
 
-func (l *leadmine) recognise(snipReaderValues <-chan snippet_reader.Value, waitGroup *sync.WaitGroup, httpOptions lib.HttpOptions) {
-	waitGroup.Add(1)
+func (l *leadmine) recognise(ctx context.Context, snipReaderValues <-chan snippet_reader.Value, waitGroup *sync.WaitGroup, httpOptions lib.HttpOptions) {
 	defer waitGroup.Done()
 
 	snips := make(map[int]*pb.Snippet)
@@ -115,10 +131,13 @@ func (l *leadmine) recognise(snipReaderValues <-chan snippet_reader.Value, waitG
 
 	if err != nil {
 		l.handleError(err)
+
+		// We've stopped reading, but the caller may still be sending. Discard the rest so they don't block.
+		snippet_reader.Drain(snipReaderValues)
 		return
 	}
 
-	leadmineResponse, err := l.callLeadmineWebService(httpOptions.QueryParameters, text)
+	leadmineResponse, err := l.callLeadmineWebService(ctx, httpOptions.QueryParameters, text)
 	if err != nil {
 		l.handleError(err)
 		return
@@ -141,6 +160,16 @@ func (l *leadmine) recognise(snipReaderValues <-chan snippet_reader.Value, waitG
 	filteredEntities := lib.FilterSubmatches(recognisedEntities)
 
 	l.entities = filteredEntities
+
+	// Leadmine returns everything in one response, so streaming callers receive all the entities at once.
+	if l.onEntity != nil {
+		for _, entity := range filteredEntities {
+			if err := l.onEntity(entity); err != nil {
+				l.handleError(err)
+				return
+			}
+		}
+	}
 }
 
 func (l *leadmine) blocklistEntities(entities []*LeadmineEntity) []*LeadmineEntity {
@@ -157,7 +186,6 @@ func (l *leadmine) convertLeadmineEntities(correctedLeadmineEntities []LeadmineE
 	var recognisedEntities []*pb.Entity
 	for _, entity := range correctedLeadmineEntities {
 		dec := entity.Beg
-		position := 0
 		var snip *pb.Snippet
 		var ok bool
 		for {
@@ -170,9 +198,11 @@ func (l *leadmine) convertLeadmineEntities(correctedLeadmineEntities []LeadmineE
 				}
 			}
 			dec--
-			position++
 		}
 
+		// Leadmine's offsets are in bytes, but positions are in characters from the snippet's offset.
+		position := snip.GetOffset() + uint32(utf8.RuneCountInString(snip.GetText()[:entity.Beg-dec]))
+
 		metadata, err := json.Marshal(LeadmineMetadata{
 			EntityGroup:     entity.EntityGroup,
 			RecognisingDict: entity.RecognisingDict,
@@ -182,10 +212,12 @@ func (l *leadmine) convertLeadmineEntities(correctedLeadmineEntities []LeadmineE
 		}
 
 		recognisedEntities = append(recognisedEntities, &pb.Entity{
-			Name:       entity.EntityText,
-			Position:   uint32(position),
-			Xpath:      snip.Xpath,
-			Recogniser: l.Name,
+			Name:        entity.EntityText,
+			Position:    position,
+			EndPosition: position + uint32(utf8.RuneCountInString(entity.EntityText)),
+			Text:        entity.EntityText,
+			Xpath:       snip.Xpath,
+			Recogniser:  l.Name,
 			Identifiers: map[string]string{
 				"resolvedEntity": entity.ResolvedEntity,
 			},
@@ -225,8 +257,8 @@ func correctLeadmineEntityOffsets(leadmineResponse *LeadmineResponse, text strin
 	return correctedLeadmineEntities, nil
 }
 
-func (l *leadmine) callLeadmineWebService(httpParams url.Values, text string) (*LeadmineResponse, error) {
-	req, err := http.NewRequest(http.MethodPost, l.urlWithParams(httpParams), strings.NewReader(text))
+func (l *leadmine) callLeadmineWebService(ctx context.Context, httpParams url.Values, text string) (*LeadmineResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.urlWithParams(httpParams), strings.NewReader(text))
 	if err != nil {
 		return nil, err
 	}
@@ -235,9 +267,10 @@ func (l *leadmine) callLeadmineWebService(httpParams url.Values, text string) (*
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, err
+		return nil, StatusError{Url: l.Url, StatusCode: resp.StatusCode}
 	}
 
 	b, err := ioutil.ReadAll(resp.Body)
@@ -253,6 +286,16 @@ func (l *leadmine) callLeadmineWebService(httpParams url.Values, text string) (*
 	return leadmineResponse, nil
 }
 
+// StatusError is returned when Leadmine Web Service responds with a status other than 200.
+type StatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("leadmine at %s responded with status %d", e.Url, e.StatusCode)
+}
+
 type LeadmineResponse struct {
 	Created  string            `json:"created"`
 	Entities []*LeadmineEntity `json:"entities"`
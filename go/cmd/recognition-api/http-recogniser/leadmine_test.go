@@ -14,14 +14,19 @@
 package http_recogniser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	netUrl "net/url"
 	"os"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -72,7 +77,7 @@ func (s *leadmineSuite) TestRecognise() {
 	waitGroup := &sync.WaitGroup{}
 
 	// Call the function we're testing!
-	err = testLeadmine.Recognise(snipChan, waitGroup, testOptions.HttpOptions)
+	err = testLeadmine.Recognise(context.Background(), snipChan, waitGroup, testOptions.HttpOptions)
 	s.Nil(err)
 
 	// Get the expected response from resources.
@@ -87,6 +92,61 @@ func (s *leadmineSuite) TestRecognise() {
 	s.EqualValues(expectedEntities, testLeadmine.entities)
 }
 
+func (s *leadmineSuite) TestRecogniseBadStatus() {
+	mockHttpClient := &mocks.HttpClient{}
+	mockHttpClient.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       ioutil.NopCloser(strings.NewReader("bad gateway")),
+	}, nil)
+
+	testLeadmine := leadmine{
+		Name:       "test-leadmine",
+		Url:        "https://leadmine.wopr.inf.mdc/chemical-entities/entities",
+		httpClient: mockHttpClient,
+	}
+
+	snipChan := html.SnippetReader{}.ReadSnippets(strings.NewReader("<p>acetylcarnitine</p>"))
+	waitGroup := &sync.WaitGroup{}
+
+	err := testLeadmine.Recognise(context.Background(), snipChan, waitGroup, lib.HttpOptions{})
+	s.Nil(err)
+
+	waitGroup.Wait()
+	s.Equal(StatusError{Url: testLeadmine.Url, StatusCode: http.StatusBadGateway}, testLeadmine.err)
+	s.Nil(testLeadmine.entities)
+}
+
+func (s *leadmineSuite) TestRecogniseTimeout() {
+	// A leadmine which never responds.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	testLeadmine := leadmine{
+		Name:       "test-leadmine",
+		Url:        server.URL,
+		httpClient: http.DefaultClient,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	snipChan := html.SnippetReader{}.ReadSnippets(strings.NewReader("<p>acetylcarnitine</p>"))
+	waitGroup := &sync.WaitGroup{}
+
+	err := testLeadmine.Recognise(ctx, snipChan, waitGroup, lib.HttpOptions{})
+	s.Nil(err)
+
+	waitGroup.Wait()
+	s.True(errors.Is(testLeadmine.err, context.DeadlineExceeded))
+	s.Nil(testLeadmine.entities)
+}
+
 func (s *leadmineSuite) TestUrlWithParams() {
 	tests := []struct {
 		name           string
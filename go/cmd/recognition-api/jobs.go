@@ -0,0 +1,306 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+	snippetReader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobTimedOut  JobStatus = "timeout" // only applies to recognisers: the job still completes
+)
+
+// RecogniserProgress reports how far a single recogniser has got with a job.
+//
+// swagger:model RecogniserProgress
+type RecogniserProgress struct {
+	Status   JobStatus `json:"status"`
+	Entities int       `json:"entities"` // the number of entities found so far, before deduplication and the global blocklist
+	Error    string    `json:"error,omitempty"`
+}
+
+// JobReport is a snapshot of the state of a job, returned by GET /jobs/{id}.
+//
+// swagger:model Job
+type JobReport struct {
+	ID            string                        `json:"id"`
+	Status        JobStatus                     `json:"status"`
+	Created       time.Time                     `json:"created"`
+	Started       *time.Time                    `json:"started,omitempty"`
+	Finished      *time.Time                    `json:"finished,omitempty"`
+	DocumentBytes int64                         `json:"documentBytes"`
+	BytesRead     int64                         `json:"bytesRead"`
+	Recognisers   map[string]RecogniserProgress `json:"recognisers"`
+	Error         string                        `json:"error,omitempty"`
+}
+
+// job is a document which has been submitted for recognition in the background.
+type job struct {
+	mut         sync.RWMutex
+	report      JobReport
+	err         error
+	entities    []lib.APIEntity
+	document    []byte
+	bytesRead   int64 // accessed atomically
+	contentType AllowedContentType
+	recognisers []lib.RecogniserOptions
+	controller  controller
+}
+
+// Report returns a copy of the job's current state.
+func (j *job) Report() JobReport {
+	j.mut.RLock()
+	defer j.mut.RUnlock()
+
+	report := j.report
+	report.BytesRead = atomic.LoadInt64(&j.bytesRead)
+	report.Recognisers = make(map[string]RecogniserProgress, len(j.report.Recognisers))
+	for name, progress := range j.report.Recognisers {
+		report.Recognisers[name] = progress
+	}
+	return report
+}
+
+// Result returns the entities found by the job and the error which caused it to fail, if any.
+// Both are nil until the job has finished.
+func (j *job) Result() ([]lib.APIEntity, error) {
+	j.mut.RLock()
+	defer j.mut.RUnlock()
+	return j.entities, j.err
+}
+
+// Read implements io.Reader over the submitted document, keeping track of how much has been read.
+func (j *job) Read(p []byte) (int, error) {
+	offset := atomic.LoadInt64(&j.bytesRead)
+	if offset >= int64(len(j.document)) {
+		return 0, io.EOF
+	}
+	n := copy(p, j.document[offset:])
+	atomic.AddInt64(&j.bytesRead, int64(n))
+	return n, nil
+}
+
+func (j *job) run() {
+	j.setStatus(JobRunning)
+
+	onEntity := func(entity *pb.Entity) error {
+		j.mut.Lock()
+		defer j.mut.Unlock()
+		progress := j.report.Recognisers[entity.Recogniser]
+		progress.Entities++
+		j.report.Recognisers[entity.Recogniser] = progress
+		return nil
+	}
+
+	// Jobs outlive the request which created them, so only the recognisers' own deadlines apply.
+	session, err := j.controller.recognise(context.Background(), j, j.contentType, j.recognisers, snippetReader.NewDocument(), onEntity)
+
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	finished := time.Now()
+	j.report.Finished = &finished
+	j.document = nil
+
+	if err != nil {
+		j.fail(err)
+		return
+	}
+
+	for _, recogniser := range j.recognisers {
+		progress := j.report.Recognisers[recogniser.Name]
+		err := session.errs[recogniser.Name]
+		switch {
+		case err == nil:
+			progress.Status = JobCompleted
+		case errors.As(err, &RecogniserTimeoutError{}):
+			// Keep whatever the recogniser found before it timed out.
+			progress.Status = JobTimedOut
+			progress.Error = err.Error()
+		default:
+			progress.Status = JobFailed
+			progress.Error = err.Error()
+			if j.err == nil {
+				j.err = err
+			}
+		}
+		j.report.Recognisers[recogniser.Name] = progress
+	}
+
+	if j.err != nil {
+		j.fail(j.err)
+		return
+	}
+
+	j.entities = j.controller.results(session, j.recognisers)
+	j.report.Status = JobCompleted
+}
+
+// fail marks the job as failed. The caller must hold the write lock.
+func (j *job) fail(err error) {
+	j.err = err
+	j.report.Status = JobFailed
+	j.report.Error = err.Error()
+	for name, progress := range j.report.Recognisers {
+		if progress.Status == JobRunning {
+			progress.Status = JobFailed
+			j.report.Recognisers[name] = progress
+		}
+	}
+}
+
+func (j *job) setStatus(status JobStatus) {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+
+	if status == JobRunning {
+		started := time.Now()
+		j.report.Started = &started
+	}
+	j.report.Status = status
+	for name, progress := range j.report.Recognisers {
+		progress.Status = status
+		j.report.Recognisers[name] = progress
+	}
+}
+
+// jobQueueSize is how many jobs may wait for a worker. Jobs submitted while the queue is full are rejected.
+const jobQueueSize = 1024
+
+// jobStore holds submitted jobs in memory and runs them on a fixed number of workers.
+// Finished jobs are forgotten once they are older than retention.
+type jobStore struct {
+	mut       sync.RWMutex
+	jobs      map[string]*job
+	queue     chan *job
+	retention time.Duration
+}
+
+func newJobStore(workers int, retention time.Duration) *jobStore {
+	store := &jobStore{
+		jobs:      make(map[string]*job),
+		queue:     make(chan *job, jobQueueSize),
+		retention: retention,
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go store.work()
+	}
+	return store
+}
+
+func (store *jobStore) work() {
+	for j := range store.queue {
+		j.run()
+		j.controller.release()
+		report := j.Report()
+		log.Info().Str("job", report.ID).Str("status", string(report.Status)).Msg("job finished")
+	}
+}
+
+// Submit queues document for recognition by the given recognisers and returns the new job. If the queue is full the
+// job is rejected with a 503 HttpError, rather than waiting for a worker.
+// The controller is copied so that the job is unaffected by later changes to it, and is in use until the job has
+// finished. The caller must be using it too.
+func (store *jobStore) Submit(controller controller, document []byte, contentType AllowedContentType, recognisers []lib.RecogniserOptions) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	controller.acquire()
+
+	progress := make(map[string]RecogniserProgress, len(recognisers))
+	for _, recogniser := range recognisers {
+		progress[recogniser.Name] = RecogniserProgress{Status: JobQueued}
+	}
+
+	j := &job{
+		report: JobReport{
+			ID:            id,
+			Status:        JobQueued,
+			Created:       time.Now(),
+			DocumentBytes: int64(len(document)),
+			Recognisers:   progress,
+		},
+		document:    document,
+		contentType: contentType,
+		recognisers: recognisers,
+		controller:  controller,
+	}
+
+	store.mut.Lock()
+	store.removeExpired()
+	store.jobs[id] = j
+	store.mut.Unlock()
+
+	select {
+	case store.queue <- j:
+		return j, nil
+	default:
+		store.mut.Lock()
+		delete(store.jobs, id)
+		store.mut.Unlock()
+		controller.release()
+		return nil, NewHttpError(503, errors.New("too many jobs are queued, try again later"))
+	}
+}
+
+// Get returns the job with the given id, if it exists.
+func (store *jobStore) Get(id string) (*job, bool) {
+	store.mut.RLock()
+	defer store.mut.RUnlock()
+	j, ok := store.jobs[id]
+	return j, ok
+}
+
+// removeExpired deletes finished jobs older than the retention period. The caller must hold the write lock.
+func (store *jobStore) removeExpired() {
+	if store.retention <= 0 {
+		return
+	}
+	for id, j := range store.jobs {
+		report := j.Report()
+		if report.Finished != nil && time.Since(*report.Finished) > store.retention {
+			delete(store.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
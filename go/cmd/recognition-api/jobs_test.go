@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	mock_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/mocks/lib/recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
+	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
+)
+
+// newJobTestRecogniser returns a mock recogniser which reads every snippet it is sent, reports entities to the
+// registered entity callback, if any, and then finishes with err.
+func newJobTestRecogniser(entities []*pb.Entity, err error) *mock_recogniser.Client {
+	var onEntity func(*pb.Entity) error
+	mockRecogniser := &mock_recogniser.Client{}
+	mockRecogniser.On("SetExactMatch", mock.Anything).Return()
+	mockRecogniser.On("SetEntityCallback", mock.Anything).Return().Run(func(args mock.Arguments) {
+		onEntity = args[0].(func(*pb.Entity) error)
+	})
+	mockRecogniser.On("Recognise",
+		mock.Anything,
+		mock.AnythingOfType("<-chan snippet_reader.Value"),
+		mock.AnythingOfType("*sync.WaitGroup"),
+		lib.HttpOptions{},
+	).Return(nil).Run(func(args mock.Arguments) {
+		waitGroup := args[2].(*sync.WaitGroup)
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			_ = snippet_reader.ReadChannelWithCallback(args[1].(<-chan snippet_reader.Value), func(*pb.Snippet) error {
+				return nil
+			})
+			if onEntity == nil {
+				return
+			}
+			for _, entity := range entities {
+				_ = onEntity(entity)
+			}
+		}()
+	})
+	mockRecogniser.On("Err").Return(err)
+	mockRecogniser.On("Result").Return(entities)
+	return mockRecogniser
+}
+
+func awaitJob(t *testing.T, j *job) JobReport {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		report := j.Report()
+		if report.Status == JobCompleted || report.Status == JobFailed {
+			return report
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not finish")
+	return JobReport{}
+}
+
+func TestJobStore_Submit(t *testing.T) {
+	entity := &pb.Entity{
+		Name:       "found entity",
+		Position:   0,
+		Xpath:      "/p",
+		Recogniser: "mock",
+	}
+	ctrl := controller{
+		recognisers: map[string]recogniser.Factory{"mock": clientFactory(newJobTestRecogniser([]*pb.Entity{entity}, nil))},
+		htmlReader:  html.SnippetReader{},
+	}
+	document := []byte("<p>found entity</p>")
+
+	store := newJobStore(1, time.Hour)
+	j, err := store.Submit(ctrl, document, contentTypeHTML, []lib.RecogniserOptions{{Name: "mock"}})
+	assert.Nil(t, err)
+
+	stored, ok := store.Get(j.Report().ID)
+	assert.True(t, ok)
+	assert.Equal(t, j, stored)
+
+	report := awaitJob(t, j)
+	assert.Equal(t, JobCompleted, report.Status)
+	assert.NotNil(t, report.Started)
+	assert.NotNil(t, report.Finished)
+	assert.Equal(t, int64(len(document)), report.DocumentBytes)
+	assert.Equal(t, int64(len(document)), report.BytesRead)
+	assert.Equal(t, map[string]RecogniserProgress{"mock": {Status: JobCompleted, Entities: 1}}, report.Recognisers)
+
+	entities, err := j.Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []lib.APIEntity{paragraphAPIEntity(entity)}, entities)
+}
+
+func TestJobStore_Submit_RecogniserFails(t *testing.T) {
+	recogniserErr := errors.New("connection refused")
+	ctrl := controller{
+		recognisers: map[string]recogniser.Factory{
+			"healthy": clientFactory(newJobTestRecogniser(nil, nil)),
+			"broken":  clientFactory(newJobTestRecogniser(nil, recogniserErr)),
+		},
+		htmlReader: html.SnippetReader{},
+	}
+
+	store := newJobStore(1, time.Hour)
+	j, err := store.Submit(ctrl, []byte("<p>some text</p>"), contentTypeHTML, []lib.RecogniserOptions{{Name: "healthy"}, {Name: "broken"}})
+	assert.Nil(t, err)
+
+	report := awaitJob(t, j)
+	assert.Equal(t, JobFailed, report.Status)
+	assert.Equal(t, recogniserErr.Error(), report.Error)
+	assert.Equal(t, RecogniserProgress{Status: JobCompleted}, report.Recognisers["healthy"])
+	assert.Equal(t, RecogniserProgress{Status: JobFailed, Error: recogniserErr.Error()}, report.Recognisers["broken"])
+
+	_, err = j.Result()
+	assert.Equal(t, recogniserErr, err)
+}
+
+func TestJobStore_Submit_QueueFull(t *testing.T) {
+	// without workers, the first job fills the queue.
+	store := &jobStore{
+		jobs:  make(map[string]*job),
+		queue: make(chan *job, 1),
+	}
+	queued, err := store.Submit(controller{}, []byte("<p>first</p>"), contentTypeHTML, nil)
+	require.NoError(t, err)
+
+	// the second is rejected at once, so the client can retry, and isn't kept.
+	_, err = store.Submit(controller{}, []byte("<p>second</p>"), contentTypeHTML, nil)
+	var httpErr HttpError
+	require.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, 503, httpErr.code)
+	assert.Len(t, store.jobs, 1)
+	_, ok := store.Get(queued.Report().ID)
+	assert.True(t, ok)
+}
+
+func TestJobStore_removeExpired(t *testing.T) {
+	finished := time.Now().Add(-2 * time.Hour)
+	store := &jobStore{
+		jobs: map[string]*job{
+			"old":     {report: JobReport{Status: JobCompleted, Finished: &finished}},
+			"running": {report: JobReport{Status: JobRunning}},
+		},
+		retention: time.Hour,
+	}
+
+	store.removeExpired()
+
+	_, ok := store.Get("old")
+	assert.False(t, ok)
+	_, ok = store.Get("running")
+	assert.True(t, ok)
+}
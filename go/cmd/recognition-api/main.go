@@ -17,19 +17,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-contrib/cors"
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/grpc-recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/http-recogniser"
 	"google.golang.org/grpc/credentials/insecure"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/text"
 	"google.golang.org/grpc"
 )
 
@@ -39,25 +34,46 @@ type recognitionAPIConfig struct {
 	Server   struct {
 		HttpPort int `mapstructure:"http_port"`
 	}
-	Blocklist       string `mapstructure:"blocklist"` // global blocklist
-	GrpcRecognizers map[string]struct {
+	Blocklist         string              `mapstructure:"blocklist"`          // global blocklist
+	Overlap           lib.OverlapStrategy `mapstructure:"overlap"`            // the default strategy for resolving overlapping entities
+	RecogniserTimeout time.Duration       `mapstructure:"recogniser_timeout"` // default deadline for each recogniser, 0 for none
+	GrpcRecognizers   map[string]struct {
 		Host      string
 		Port      int
 		Blocklist string
+		Timeout   time.Duration // overrides recogniser_timeout
+		// WholeSnippets sends the recogniser untokenised snippets, e.g. for a regexer which matches across tokens. The
+		// recogniser is told so in each stream's metadata.
+		WholeSnippets bool `mapstructure:"whole_snippets"`
 	} `mapstructure:"grpc_recognisers"`
 	HttpRecognisers map[string]struct {
 		Type      http_recogniser.Type
 		Url       string
 		Blocklist string
+		Timeout   time.Duration // overrides recogniser_timeout
 	} `mapstructure:"http_recognisers"`
+	Jobs struct {
+		Workers   int           // the number of jobs which may run at once
+		Retention time.Duration // how long to keep finished jobs for
+	}
+	Admin struct {
+		// ReloadToken enables POST /admin/reload for requests which send it as a bearer token. It is off if empty.
+		ReloadToken string `mapstructure:"reload_token"`
+	}
 }
 
 var config recognitionAPIConfig
 var defaultConfig = map[string]interface{}{
-	"log_level": "info",
+	"log_level":          "info",
+	"recogniser_timeout": "10m",
+	"overlap":            lib.KeepAll,
 	"server": map[string]interface{}{
 		"http_port": 8080,
 	},
+	"jobs": map[string]interface{}{
+		"workers":   1,
+		"retention": "1h",
+	},
 }
 
 func main() {
@@ -69,28 +85,23 @@ func main() {
 	var opts []grpc.DialOption
 	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	opts = append(opts, grpc.WithBlock())
-
-	// for each recogniser in the config, instantiate a client and save the connection
-	// so that we can close it later.
-	recogniserClients := make(map[string]recogniser.Client)
-	for name, conf := range config.GrpcRecognizers {
-		log.Info().Str("recognizer", name).Msg("connecting...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		conn, err := grpc.DialContext(ctx, fmt.Sprintf("%s:%d", conf.Host, conf.Port), opts...)
-		if err != nil {
-			log.Fatal().Err(err).Send()
-		}
-		cancel()
-
-		recogniserClients[name] = grpc_recogniser.New(name, pb.NewRecognizerClient(conn), loadBlocklist(conf.Blocklist))
+	dial := func(ctx context.Context, address string) (*grpc.ClientConn, error) {
+		return grpc.DialContext(ctx, address, opts...)
 	}
 
-	for name, conf := range config.HttpRecognisers {
-		switch conf.Type {
-		case http_recogniser.LeadmineType:
-			recogniserClients[name] = http_recogniser.NewLeadmineClient(name, conf.Url, loadBlocklist(conf.Blocklist))
-		}
+	// for each recogniser in the config, instantiate a client. The reloader keeps the connections so that the
+	// controllers created when the config is reloaded can reuse them.
+	reloader := newReloader(lib.ReloadConfig, dial)
+	c, recogniserErrs, err := reloader.newController(config)
+	if err != nil {
+		log.Fatal().Err(err).Send()
 	}
+	for name, err := range recogniserErrs {
+		log.Error().Err(err).Str("recognizer", name).Msg("recogniser unavailable")
+	}
+	reloader.controller = newLiveController(c)
+	// reload the config and blocklists on SIGHUP, as well as on POST /admin/reload if admin.reload_token is set.
+	lib.ReloadOnSignal(reloader.Reload)
 
 	r := gin.Default()
 	r.Use(
@@ -104,28 +115,26 @@ func main() {
 		}),
 	)
 
-	c := controller{
-		recognisers: recogniserClients,
-		htmlReader:  html.SnippetReader{},
-		textReader:  text.SnippetReader{},
-		blocklist:   loadBlocklist(config.Blocklist),
+	s := server{
+		controller:  reloader.controller,
+		jobs:        newJobStore(config.Jobs.Workers, config.Jobs.Retention),
+		reload:      reloader.Reload,
+		reloadToken: config.Admin.ReloadToken,
 	}
-
-	s := server{controller: &c}
 	s.RegisterRoutes(r)
 	if err := r.Run(fmt.Sprintf(":%d", config.Server.HttpPort)); err != nil {
 		log.Fatal().Err(err).Send()
 	}
 }
 
-func loadBlocklist(path string) blocklist.Blocklist {
+func loadBlocklist(path string) (blocklist.Blocklist, error) {
 	var bl = blocklist.Blocklist{}
 	if path != "" {
 		loadedBlocklist, err := blocklist.Load(path)
 		if err != nil {
-			log.Fatal().Err(err).Send()
+			return bl, BlocklistLoadError{Path: path, Err: err}
 		}
 		bl = *loadedBlocklist
 	}
-	return bl
+	return bl, nil
 }
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/grpc-recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/http-recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/text"
+	"google.golang.org/grpc"
+)
+
+// liveController holds the controller which new requests use. Reloading the config replaces it, while requests and
+// jobs which have already started carry on with the controller they started with.
+type liveController struct {
+	value atomic.Value // *controller
+}
+
+func newLiveController(c *controller) *liveController {
+	live := &liveController{}
+	live.Store(c)
+	return live
+}
+
+func (l *liveController) Load() *controller {
+	return l.value.Load().(*controller)
+}
+
+func (l *liveController) Store(c *controller) {
+	l.value.Store(c)
+}
+
+// Acquire returns the controller which new requests use, which is counted as in use until it is released.
+func (l *liveController) Acquire() *controller {
+	for {
+		// a controller which has just been replaced may already be finished with, in which case the one which
+		// replaced it is loaded.
+		if c := l.Load(); c.acquire() {
+			return c
+		}
+	}
+}
+
+// controllerRefs counts the requests and jobs using a controller, so that once it has been replaced and they have all
+// finished, the connections which only it used can be closed.
+type controllerRefs struct {
+	mu      sync.Mutex
+	users   int
+	retired bool
+	onIdle  func() // called once, when the controller is retired and no longer in use
+}
+
+// acquire counts another user of c. It returns false if c has been retired and is no longer in use, so must not be
+// used. Controllers without refs are never retired.
+func (c *controller) acquire() bool {
+	if c.refs == nil {
+		return true
+	}
+	c.refs.mu.Lock()
+	defer c.refs.mu.Unlock()
+	if c.refs.retired && c.refs.users == 0 {
+		return false
+	}
+	c.refs.users++
+	return true
+}
+
+// release stops counting a user of c, which acquired it.
+func (c *controller) release() {
+	if c.refs == nil {
+		return
+	}
+	c.refs.mu.Lock()
+	c.refs.users--
+	idle := c.refs.retired && c.refs.users == 0
+	c.refs.mu.Unlock()
+	if idle {
+		c.refs.onIdle()
+	}
+}
+
+// retire marks c as replaced, so that it is finished with once its current users release it.
+func (c *controller) retire() {
+	if c.refs == nil {
+		return
+	}
+	c.refs.mu.Lock()
+	c.refs.retired = true
+	idle := c.refs.users == 0
+	c.refs.mu.Unlock()
+	if idle {
+		c.refs.onIdle()
+	}
+}
+
+// dialFunc connects to the gRPC recogniser at address.
+type dialFunc func(ctx context.Context, address string) (*grpc.ClientConn, error)
+
+// reloader builds controllers from the config, and swaps in a new controller when the config is reloaded.
+type reloader struct {
+	mu         sync.Mutex // reloads happen one at a time
+	controller *liveController
+	readConfig func(targetStruct interface{}) error
+	dial       dialFunc
+	// conns are the connections to gRPC recognisers, keyed by address, so that recognisers which are still configured
+	// after a reload keep their connection. Each controller holds the connections it uses until it has been replaced
+	// and the requests using it have finished, and a connection is closed once no controller holds it.
+	connMu sync.Mutex
+	conns  map[string]*sharedConn
+}
+
+// sharedConn is a connection to a gRPC recogniser and the number of times controllers hold it.
+type sharedConn struct {
+	conn  *grpc.ClientConn
+	holds int
+}
+
+func newReloader(readConfig func(targetStruct interface{}) error, dial dialFunc) *reloader {
+	return &reloader{
+		readConfig: readConfig,
+		dial:       dial,
+		conns:      make(map[string]*sharedConn),
+	}
+}
+
+// Reload re-reads the config, including the global and recognisers' blocklists, and replaces the controller which new
+// requests use. If anything can't be loaded the controller in use is kept, so a mistake in the config doesn't take
+// the API down.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var conf recognitionAPIConfig
+	if err := r.readConfig(&conf); err != nil {
+		return err
+	}
+
+	c, recogniserErrs, err := r.newController(conf)
+	if err != nil {
+		return err
+	}
+	// At start-up a recogniser whose blocklist can't be loaded is unavailable, but here it would replace a recogniser
+	// which works.
+	if len(recogniserErrs) > 0 {
+		names := make([]string, 0, len(recogniserErrs))
+		for name := range recogniserErrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("recogniser %s: %w", names[0], recogniserErrs[names[0]])
+	}
+
+	previous := r.controller.Load()
+	r.controller.Store(c)
+	previous.retire()
+	return nil
+}
+
+// newController creates a controller for conf, connecting to any gRPC recognisers which aren't already connected.
+// A recogniser whose blocklist can't be loaded is unavailable, and its error is returned in recogniserErrs, keyed by the
+// recogniser's name.
+func (r *reloader) newController(conf recognitionAPIConfig) (c *controller, recogniserErrs map[string]error, err error) {
+	overlap, err := lib.ParseOverlapStrategy(string(conf.Overlap))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unlike a recogniser's blocklist, the global blocklist applies to every request, so there is no point going on without it.
+	globalBlocklist, err := loadBlocklist(conf.Blocklist)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recogniserFactories := make(map[string]recogniser.Factory)
+	recogniserTimeouts := make(map[string]time.Duration)
+	recogniserErrs = make(map[string]error)
+	// the addresses of the connections held for this controller, which are released if it isn't created.
+	var addresses []string
+	defer func() {
+		if err != nil {
+			r.releaseConns(addresses)
+		}
+	}()
+
+	for name, recogniserConf := range conf.GrpcRecognizers {
+		recogniserTimeouts[name] = timeoutOrDefault(recogniserConf.Timeout, conf.RecogniserTimeout)
+
+		bl, err := loadBlocklist(recogniserConf.Blocklist)
+		if err != nil {
+			recogniserErrs[name] = err
+			recogniserFactories[name] = unavailableRecogniser{err: err}
+			continue
+		}
+
+		address := fmt.Sprintf("%s:%d", recogniserConf.Host, recogniserConf.Port)
+		conn, err := r.holdConn(name, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		addresses = append(addresses, address)
+
+		recogniserFactories[name] = grpc_recogniser.NewFactory(name, pb.NewRecognizerClient(conn), bl, recogniserConf.WholeSnippets)
+	}
+
+	for name, recogniserConf := range conf.HttpRecognisers {
+		recogniserTimeouts[name] = timeoutOrDefault(recogniserConf.Timeout, conf.RecogniserTimeout)
+
+		bl, err := loadBlocklist(recogniserConf.Blocklist)
+		if err != nil {
+			recogniserErrs[name] = err
+			recogniserFactories[name] = unavailableRecogniser{err: err}
+			continue
+		}
+
+		switch recogniserConf.Type {
+		case http_recogniser.LeadmineType:
+			recogniserFactories[name] = http_recogniser.NewLeadmineFactory(name, recogniserConf.Url, bl)
+		}
+	}
+
+	return &controller{
+		recognisers: recogniserFactories,
+		htmlReader:  html.SnippetReader{},
+		textReader:  text.SnippetReader{},
+		blocklist:   globalBlocklist,
+		overlap:     overlap,
+		timeouts:    recogniserTimeouts,
+		refs: &controllerRefs{onIdle: func() {
+			r.releaseConns(addresses)
+		}},
+	}, recogniserErrs, nil
+}
+
+// holdConn returns the connection to the gRPC recogniser at address, connecting to it if there isn't one, and counts
+// another hold on it. Connections are only made by newController, one reload at a time.
+func (r *reloader) holdConn(name, address string) (*grpc.ClientConn, error) {
+	r.connMu.Lock()
+	shared, ok := r.conns[address]
+	if ok {
+		shared.holds++
+	}
+	r.connMu.Unlock()
+	if ok {
+		return shared.conn, nil
+	}
+
+	conn, err := r.connect(name, address)
+	if err != nil {
+		return nil, err
+	}
+	r.connMu.Lock()
+	r.conns[address] = &sharedConn{conn: conn, holds: 1}
+	r.connMu.Unlock()
+	return conn, nil
+}
+
+// releaseConns releases a hold on the connection to each of addresses, closing those which are no longer held.
+func (r *reloader) releaseConns(addresses []string) {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+	for _, address := range addresses {
+		shared := r.conns[address]
+		if shared.holds--; shared.holds == 0 {
+			log.Info().Str("address", address).Msg("closing connection to removed recogniser")
+			_ = shared.conn.Close()
+			delete(r.conns, address)
+		}
+	}
+}
+
+func (r *reloader) connect(name, address string) (*grpc.ClientConn, error) {
+	log.Info().Str("recognizer", name).Msg("connecting...")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := r.dial(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("recogniser %s: %w", name, err)
+	}
+	return conn, nil
+}
+
+func timeoutOrDefault(timeout, defaultTimeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
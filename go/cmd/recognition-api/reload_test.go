@@ -0,0 +1,286 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// testReloader returns a reloader which reads the config, with the default config, from *configYAML, and connects to gRPC recognisers lazily,
+// counting the connections it makes.
+func testReloader(t *testing.T, configYAML *string, dials *int) *reloader {
+	readConfig := func(targetStruct interface{}) error {
+		v := viper.New()
+		for k, value := range defaultConfig {
+			v.SetDefault(k, value)
+		}
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(strings.NewReader(*configYAML)); err != nil {
+			return err
+		}
+		return v.Unmarshal(targetStruct)
+	}
+	dial := func(ctx context.Context, address string) (*grpc.ClientConn, error) {
+		*dials++
+		return grpc.DialContext(ctx, address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	r := newReloader(readConfig, dial)
+
+	var conf recognitionAPIConfig
+	require.NoError(t, readConfig(&conf))
+	c, recogniserErrs, err := r.newController(conf)
+	require.NoError(t, err)
+	require.Empty(t, recogniserErrs)
+	r.controller = newLiveController(c)
+	t.Cleanup(func() {
+		for _, shared := range r.conns {
+			_ = shared.conn.Close()
+		}
+	})
+	return r
+}
+
+func sortedRecognisers(c *controller) []string {
+	recognisers := c.ListRecognisers()
+	sort.Strings(recognisers)
+	return recognisers
+}
+
+func Test_reloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	blocklistPath := filepath.Join(dir, "blocklist.yml")
+	require.NoError(t, ioutil.WriteFile(blocklistPath, []byte("case_sensitive: [before]\n"), 0644))
+
+	configYAML := fmt.Sprintf(`
+blocklist: %s
+overlap: keep-all
+recogniser_timeout: 1m
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50051}
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080, timeout: 5s}
+`, blocklistPath)
+	var dials int
+	r := testReloader(t, &configYAML, &dials)
+	before := r.controller.Load()
+	assert.Equal(t, []string{"dictionary", "leadmine"}, sortedRecognisers(before))
+	assert.False(t, before.blocklist.Allowed("before"))
+	assert.Equal(t, 5*time.Second, before.timeouts["leadmine"])
+	assert.Equal(t, 1, dials)
+
+	// recognisers are added and removed, and the global blocklist is re-read.
+	require.NoError(t, ioutil.WriteFile(blocklistPath, []byte("case_sensitive: [after]\n"), 0644))
+	configYAML = fmt.Sprintf(`
+blocklist: %s
+overlap: keep-all
+recogniser_timeout: 1m
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50051}
+  regexer: {host: localhost, port: 50052}
+  dictionary-copy: {host: localhost, port: 50051}
+`, blocklistPath)
+	require.NoError(t, r.Reload())
+	after := r.controller.Load()
+	assert.Equal(t, []string{"dictionary", "dictionary-copy", "regexer"}, sortedRecognisers(after))
+	assert.True(t, after.blocklist.Allowed("before"))
+	assert.False(t, after.blocklist.Allowed("after"))
+	assert.Equal(t, time.Minute, after.timeouts["regexer"])
+	// only the new address is connected to.
+	assert.Equal(t, 2, dials)
+
+	// requests which started before the reload still have the previous controller.
+	assert.Equal(t, []string{"dictionary", "leadmine"}, sortedRecognisers(before))
+	assert.False(t, before.blocklist.Allowed("before"))
+}
+
+func Test_reloader_Reload_ClosesRemovedConnections(t *testing.T) {
+	configYAML := `
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50051}
+  regexer: {host: localhost, port: 50052}
+`
+	var dials int
+	r := testReloader(t, &configYAML, &dials)
+	dictionaryConn := r.conns["localhost:50051"].conn
+	regexerConn := r.conns["localhost:50052"].conn
+
+	// a request is using the controller when the regexer is removed.
+	inFlight := r.controller.Acquire()
+	configYAML = `
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50051}
+`
+	require.NoError(t, r.Reload())
+	assert.NotEqual(t, connectivity.Shutdown, regexerConn.GetState())
+
+	// once the request has finished, the regexer's connection is closed, but the dictionary's is kept.
+	inFlight.release()
+	assert.Equal(t, connectivity.Shutdown, regexerConn.GetState())
+	assert.NotEqual(t, connectivity.Shutdown, dictionaryConn.GetState())
+	assert.Equal(t, []string{"localhost:50051"}, connAddresses(r))
+
+	// a recogniser whose address changes is connected to again, and its old connection closed at once, as nothing is
+	// using the previous controller.
+	configYAML = `
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50053}
+`
+	require.NoError(t, r.Reload())
+	assert.Equal(t, connectivity.Shutdown, dictionaryConn.GetState())
+	assert.Equal(t, []string{"localhost:50053"}, connAddresses(r))
+	assert.Equal(t, 3, dials)
+
+	// new requests use the new controller, which is still connected.
+	current := r.controller.Acquire()
+	defer current.release()
+	assert.Same(t, r.controller.Load(), current)
+	assert.NotEqual(t, connectivity.Shutdown, r.conns["localhost:50053"].conn.GetState())
+}
+
+func connAddresses(r *reloader) []string {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+	addresses := make([]string, 0, len(r.conns))
+	for address := range r.conns {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func Test_reloader_Reload_Failure(t *testing.T) {
+	configYAML := `
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080}
+`
+	var dials int
+	r := testReloader(t, &configYAML, &dials)
+	before := r.controller.Load()
+
+	missing := filepath.Join(t.TempDir(), "missing.yml")
+	tests := []struct {
+		name       string
+		configYAML string
+	}{
+		{name: "invalid config", configYAML: "http_recognisers: [unclosed"},
+		{name: "invalid overlap strategy", configYAML: "overlap: sometimes"},
+		{name: "missing global blocklist", configYAML: "blocklist: " + missing},
+		{name: "missing recogniser blocklist", configYAML: fmt.Sprintf(`
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080, blocklist: %s}
+`, missing)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configYAML = tt.configYAML
+			assert.Error(t, r.Reload())
+			assert.Same(t, before, r.controller.Load())
+		})
+	}
+
+	// a recogniser which can't be connected to fails the reload, and its connection isn't kept.
+	r.dial = func(context.Context, string) (*grpc.ClientConn, error) {
+		return nil, errors.New("connection refused")
+	}
+	configYAML = `
+grpc_recognisers:
+  dictionary: {host: localhost, port: 50051}
+`
+	assert.Error(t, r.Reload())
+	assert.Same(t, before, r.controller.Load())
+	assert.Empty(t, r.conns)
+}
+
+func Test_server_Reload(t *testing.T) {
+	configYAML := `
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080}
+`
+	var dials int
+	r := testReloader(t, &configYAML, &dials)
+	engine := gin.New()
+	server{controller: r.controller, reload: r.Reload, reloadToken: "secret"}.RegisterRoutes(engine)
+
+	reloadWithToken := func(engine *gin.Engine, token string) (int, []string) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/admin/reload", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		engine.ServeHTTP(res, req)
+		var recognisers []string
+		_ = json.Unmarshal(res.Body.Bytes(), &recognisers)
+		sort.Strings(recognisers)
+		return res.Code, recognisers
+	}
+	reload := func() (int, []string) {
+		return reloadWithToken(engine, "secret")
+	}
+
+	configYAML = `
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080}
+  leadmine-proteins: {type: leadmine, url: http://localhost:8081}
+`
+	// the config isn't reloaded without the token.
+	code, _ := reloadWithToken(engine, "")
+	assert.Equal(t, 401, code)
+	code, _ = reloadWithToken(engine, "wrong")
+	assert.Equal(t, 401, code)
+	assert.Equal(t, []string{"leadmine"}, sortedRecognisers(r.controller.Load()))
+
+	code, recognisers := reload()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, []string{"leadmine", "leadmine-proteins"}, recognisers)
+
+	configYAML = "blocklist: " + filepath.Join(os.TempDir(), "missing-blocklist.yml")
+	code, _ = reload()
+	assert.Equal(t, 500, code)
+	assert.Equal(t, []string{"leadmine", "leadmine-proteins"}, sortedRecognisers(r.controller.Load()))
+}
+
+func Test_server_Reload_Disabled(t *testing.T) {
+	configYAML := `
+http_recognisers:
+  leadmine: {type: leadmine, url: http://localhost:8080}
+`
+	var dials int
+	r := testReloader(t, &configYAML, &dials)
+	engine := gin.New()
+	// without a reload token the route isn't registered.
+	server{controller: r.controller, reload: r.Reload}.RegisterRoutes(engine)
+
+	res := httptest.NewRecorder()
+	engine.ServeHTTP(res, httptest.NewRequest("POST", "/admin/reload", nil))
+	assert.Equal(t, 404, res.Code)
+}
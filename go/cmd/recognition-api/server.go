@@ -20,17 +20,29 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 )
 
 const recognisersKey = "recognisers"
+const exactMatchKey = "exactMatch"
+const overlapKey = "overlap"
+const controllerKey = "controller"
+
+// ndjsonContentType is the media type for newline-delimited JSON, used when streaming entities.
+const ndjsonContentType = "application/x-ndjson"
+
+// recogniserStatusHeader reports the RecogniserStatus of each requested recogniser, e.g. "dictionary=ok, leadmine=timeout".
+const recogniserStatusHeader = "X-Recogniser-Status"
 
 type HttpError struct {
 	code int
@@ -49,14 +61,25 @@ func NewHttpError(code int, err error) HttpError {
 }
 
 type server struct {
-	controller *controller
+	controller *liveController // replaced when the config is reloaded
+	jobs       *jobStore
+	reload     func() error // reloads the config, or nil if it can't be reloaded
+	// reloadToken is the bearer token which POST /admin/reload requires. The route isn't registered if it is empty.
+	reloadToken string
 }
 
 func (s server) RegisterRoutes(engine *gin.Engine) {
+	engine.Use(s.loadController)
 	engine.POST("/text", validateBody, s.HTMLToText)
 	engine.POST("/tokens", validateBody, s.getParams, s.Tokenise)
 	engine.POST("/entities", validateBody, s.getParams, s.GetRecognisers, s.Recognize)
 	engine.GET("/recognisers", s.ListRecognisers)
+	engine.POST("/jobs", validateBody, s.getParams, s.GetRecognisers, s.CreateJob)
+	engine.GET("/jobs/:id", s.GetJob)
+	engine.GET("/jobs/:id/entities", s.GetJobEntities)
+	if s.reload != nil && s.reloadToken != "" {
+		engine.POST("/admin/reload", s.authoriseReload, s.Reload)
+	}
 }
 
 // swagger:route GET /recognisers Endpoints recognisers
@@ -68,7 +91,36 @@ func (s server) RegisterRoutes(engine *gin.Engine) {
 //	responses:
 //      200: description: A list of the names of all configured recognisers
 func (s server) ListRecognisers(c *gin.Context) {
-	c.JSON(200, s.controller.ListRecognisers())
+	c.JSON(200, s.currentController(c).ListRecognisers())
+}
+
+// swagger:route POST /admin/reload Endpoints reload
+// Reload re-reads the config, the global blocklist and the recognisers' blocklists, adding and removing recognisers as
+// configured. Requests and jobs which have already started finish with the previous config. If the config can't be
+// loaded the previous config is kept. The route is only registered if admin.reload_token is set, and requires it.
+//
+//	Produces:
+//		- application/json
+//
+//	responses:
+//      200: description: A list of the names of all configured recognisers
+//      401: description: The request didn't send the reload token
+//      500: description: The config could not be loaded, so the previous config is still in use
+func (s server) Reload(c *gin.Context) {
+	if err := s.reload(); err != nil {
+		handleError(c, err)
+		return
+	}
+	c.JSON(200, s.controller.Load().ListRecognisers())
+}
+
+// authoriseReload is a gin middleware func which rejects requests without the "Authorization: Bearer <reload_token>"
+// header.
+func (s server) authoriseReload(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.reloadToken)) != 1 {
+		handleError(c, NewHttpError(401, errors.New("a valid reload token is required")))
+	}
 }
 
 // GetRecognisers is a gin middleware func which uses the "recogniser" query param to populate recognisers. (may be specified multiple times).
@@ -78,7 +130,7 @@ func (s server) GetRecognisers(c *gin.Context) {
 	var requestedRecognisers []string
 	allRecognisersFlag, ok := c.GetQuery("allRecognisers")
 	if ok && allRecognisersFlag == "true" {
-		requestedRecognisers = s.controller.ListRecognisers()
+		requestedRecognisers = s.currentController(c).ListRecognisers()
 	} else {
 		requestedRecognisers, ok = c.GetQueryArray("recogniser")
 		if !ok {
@@ -130,6 +182,25 @@ func (s server) GetRecognisers(c *gin.Context) {
 //  6)  The previous 3 steps are done in parallel, so wait for them all to complete.
 //  7)  Collect all the entities returned from all the recognisers and return them in the HTTP response.
 //
+//	Each recogniser has a deadline, set in config. A recogniser which misses its deadline is cancelled and the entities
+//	it found before then are returned. The X-Recogniser-Status response header reports each recogniser as either "ok"
+//	or "timeout", e.g. "dictionary=ok, leadmine-proteins=timeout".
+//
+//	By default, if any recogniser fails the whole request fails. With partial-results=true the response is instead a
+//	PartialResult: the entities from every recogniser which did not fail, and a report for each recogniser with its
+//	status ("ok", "timeout" or "failed") and, if it did not succeed, a structured error.
+//
+//	Recognisers often find entities which overlap, e.g. "sodium", "sodium chloride" and "chloride". The overlap param
+//	chooses which to keep, comparing the character offsets of entities in the same element:
+//	keep-all keeps every entity; longest drops any entity which overlaps a longer one; leftmost-longest keeps the entity
+//	which starts first (the longest if several start at once) and drops everything overlapping it; priority prefers
+//	entities from the recogniser requested first, then the longest. The default is set in config.
+//
+//	If the Accept header is application/x-ndjson, step 7 is skipped: each entity is written to the response as a line of
+//	JSON as soon as a recogniser returns it. Each line is an Entity with a single position, so the same entity name may
+//	appear on several lines. If recognition fails after streaming has begun, the final line is an error object with
+//	"status" and "message" fields. X-Recogniser-Status is sent as a trailer.
+//
 //	Parameters:
 //    + name: recogniser
 //      description: a recogniser to use for entity recognition. May be specified more than once with different values. Hit /recognisers for a list of all configured recognisers.
@@ -143,6 +214,18 @@ func (s server) GetRecognisers(c *gin.Context) {
 //      type: boolean
 //      required: false
 //
+//    + name: overlap
+//      description: How to resolve overlapping entities - keep-all, longest, leftmost-longest or priority. For priority, recognisers earlier in the query string take precedence. Ignored when streaming.
+//      in: query
+//      type: string
+//      required: false
+//
+//    + name: partial-results
+//      description: Boolean value of whether to return the entities from healthy recognisers when others fail. If true, the response is a PartialResult rather than []Entity. Ignored when streaming.
+//      in: query
+//      type: boolean
+//      required: false
+//
 //	 + name: Body
 //  	description: The HTML document to scan for entities
 //  	in: body
@@ -154,6 +237,7 @@ func (s server) GetRecognisers(c *gin.Context) {
 //
 //	Produces:
 //		- application/json
+//		- application/x-ndjson
 //
 //	responses:
 //      200: []Entity
@@ -171,16 +255,211 @@ func (s server) Recognize(c *gin.Context) {
 
 	recognisers := requestedRecognisers.([]lib.RecogniserOptions)
 
-	// TODO: next line blocks until all of the recognisers return. If a recogniser dies then this will get stuck.
-	entities, err := s.controller.Recognize(c.Request.Body, contentType, recognisers)
+	if c.NegotiateFormat(gin.MIMEJSON, ndjsonContentType) == ndjsonContentType {
+		s.recognizeStream(c, contentType, recognisers)
+		return
+	}
+
+	if c.Query("partial-results") == "true" {
+		s.recognizePartial(c, contentType, recognisers)
+		return
+	}
+
+	// The request context is cancelled if the client disconnects, and each recogniser has its own deadline on top.
+	entities, statuses, err := s.requestController(c).Recognize(c.Request.Context(), c.Request.Body, contentType, recognisers)
 	if err != nil {
 		handleError(c, err)
 		return
 	}
 
+	c.Header(recogniserStatusHeader, formatRecogniserStatuses(recognisers, statuses))
 	c.JSON(200, entities)
 }
 
+// recognizePartial responds with a PartialResult, so that one failed recogniser doesn't lose the entities found by the rest.
+func (s server) recognizePartial(c *gin.Context, contentType AllowedContentType, recognisers []lib.RecogniserOptions) {
+	result, err := s.requestController(c).RecognizePartial(c.Request.Context(), c.Request.Body, contentType, recognisers)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	statuses := make(map[string]RecogniserStatus, len(result.Recognisers))
+	for name, report := range result.Recognisers {
+		statuses[name] = report.Status
+	}
+	c.Header(recogniserStatusHeader, formatRecogniserStatuses(recognisers, statuses))
+	c.JSON(200, result)
+}
+
+// recognizeStream writes entities to the response as newline-delimited JSON as they are recognised.
+func (s server) recognizeStream(c *gin.Context, contentType AllowedContentType, recognisers []lib.RecogniserOptions) {
+	encoder := json.NewEncoder(c.Writer)
+	onEntity := func(entity lib.APIEntity) error {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", ndjsonContentType)
+			// The recogniser statuses aren't known until the end, so they are sent as a trailer.
+			c.Header("Trailer", recogniserStatusHeader)
+		}
+		if err := encoder.Encode(entity); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	statuses, err := s.requestController(c).RecognizeStream(c.Request.Context(), c.Request.Body, contentType, recognisers, onEntity)
+	if err == nil {
+		c.Writer.Header().Set(recogniserStatusHeader, formatRecogniserStatuses(recognisers, statuses))
+	}
+
+	switch {
+	case err != nil && !c.Writer.Written():
+		// Nothing has been sent yet so we can still respond with an error status.
+		handleError(c, err)
+	case err != nil:
+		// The status has already been sent, so the best we can do is report the error on the last line.
+		_ = encoder.Encode(map[string]interface{}{
+			"status":  500,
+			"message": err.Error(),
+		})
+		c.Abort()
+	case !c.Writer.Written():
+		// No entities were found.
+		c.Data(200, ndjsonContentType, nil)
+	}
+}
+
+// formatRecogniserStatuses formats statuses for the recogniser status header, in the order the recognisers were requested.
+func formatRecogniserStatuses(recognisers []lib.RecogniserOptions, statuses map[string]RecogniserStatus) string {
+	formatted := make([]string, len(recognisers))
+	for i, recogniser := range recognisers {
+		formatted[i] = fmt.Sprintf("%s=%s", recogniser.Name, statuses[recogniser.Name])
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// swagger:route POST /jobs Endpoints createJob
+//
+//	/jobs takes an HTML or text document and starts recognising entities in it in the background, returning a job
+//	straight away. Poll GET /jobs/{id} for the job's status, and fetch the entities from GET /jobs/{id}/entities once
+//	it has completed. This is intended for documents which are too large to recognise within an HTTP timeout.
+//
+//	Parameters:
+//    + name: recogniser
+//      description: a recogniser to use for entity recognition. May be specified more than once with different values. Hit /recognisers for a list of all configured recognisers.
+//      in: query
+//      type: string
+//      required: true
+//
+//    + name: exact-match
+//      description:  Boolean value of whether to perform exact matching during tokenising. See /entities.
+//      in: query
+//      type: boolean
+//      required: false
+//
+//	 + name: Body
+//  	description: The HTML document to scan for entities
+//  	in: body
+//		required: true
+//
+// 	Consumes:
+//		- text/html
+//		- text/plain
+//
+//	Produces:
+//		- application/json
+//
+//	responses:
+//      202: Job
+//  	400: description: Bad request - invalid content type or missing / invalid recogniser
+//  	503: description: Too many jobs are queued, try again later
+func (s server) CreateJob(c *gin.Context) {
+	requestedRecognisers, ok := c.Get(recognisersKey)
+	if !ok {
+		handleError(c, errors.New("recognisers are unset"))
+		return
+	}
+
+	contentType, ok := allowedContentTypeEnumMap[c.ContentType()]
+	if !ok {
+		handleError(c, NewHttpError(400, errors.New("invalid content type - must be text/html or text/plain")))
+		return
+	}
+
+	recognisers := requestedRecognisers.([]lib.RecogniserOptions)
+	if err := s.currentController(c).CheckRecognisers(recognisers); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// The request will have finished before the job runs, so read the whole document now.
+	document, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	j, err := s.jobs.Submit(s.requestController(c), document, contentType, recognisers)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	report := j.Report()
+	c.Header("Location", fmt.Sprintf("/jobs/%s", report.ID))
+	c.JSON(202, report)
+}
+
+// swagger:route GET /jobs/{id} Endpoints getJob
+// GetJob reports the status of a job, how much of the document has been read, and the progress and errors of each recogniser.
+//
+//	Produces:
+//		- application/json
+//
+//	responses:
+//      200: Job
+//  	404: description: No such job
+func (s server) GetJob(c *gin.Context) {
+	j, ok := s.jobs.Get(c.Param("id"))
+	if !ok {
+		handleError(c, NewHttpError(404, fmt.Errorf("no such job '%s'", c.Param("id"))))
+		return
+	}
+
+	c.JSON(200, j.Report())
+}
+
+// swagger:route GET /jobs/{id}/entities Endpoints getJobEntities
+// GetJobEntities returns the entities found by a job. If the job has not finished yet, the job's status is returned instead.
+//
+//	Produces:
+//		- application/json
+//
+//	responses:
+//      200: []Entity
+//      202: Job
+//  	404: description: No such job
+func (s server) GetJobEntities(c *gin.Context) {
+	j, ok := s.jobs.Get(c.Param("id"))
+	if !ok {
+		handleError(c, NewHttpError(404, fmt.Errorf("no such job '%s'", c.Param("id"))))
+		return
+	}
+
+	report := j.Report()
+	switch report.Status {
+	case JobCompleted:
+		entities, _ := j.Result()
+		c.JSON(200, entities)
+	case JobFailed:
+		_, err := j.Result()
+		handleError(c, err)
+	default:
+		c.JSON(202, report)
+	}
+}
+
 // swagger:route POST /tokens Endpoints tokens
 // /tokens splits an HTML or plain text document into tokens.
 // Tokens are the segments of text from the source document which can be used to query
@@ -215,7 +494,7 @@ func (s server) Tokenise(c *gin.Context) {
 		handleError(c, NewHttpError(400, errors.New("invalid content type - must be text/html or text/plain")))
 	}
 
-	tokens, err := s.controller.Tokenize(c.Request.Body, contentType)
+	tokens, err := s.requestController(c).Tokenize(c.Request.Body, contentType)
 	if err != nil {
 		handleError(c, err)
 		return
@@ -247,7 +526,7 @@ func (s server) HTMLToText(c *gin.Context) {
 		handleError(c, NewHttpError(400, errors.New("invalid content type - must be text/html")))
 	}
 
-	data, err := s.controller.HTMLToText(c.Request.Body)
+	data, err := s.currentController(c).HTMLToText(c.Request.Body)
 	if err != nil {
 		handleError(c, err)
 		return
@@ -256,11 +535,51 @@ func (s server) HTMLToText(c *gin.Context) {
 	c.Data(200, "text/plain", data)
 }
 
-func (s *server) getParams(c *gin.Context) {
-	s.controller.exactMatch = c.Query("exact-match") == "true"
+// getParams is a gin middleware func which reads the query params that apply to every recogniser into the request context.
+func (s server) getParams(c *gin.Context) {
+	c.Set(exactMatchKey, c.Query("exact-match") == "true")
+
+	if overlap, ok := c.GetQuery("overlap"); ok {
+		strategy, err := lib.ParseOverlapStrategy(overlap)
+		if err != nil {
+			handleError(c, NewHttpError(400, err))
+			return
+		}
+		c.Set(overlapKey, strategy)
+	}
+
 	c.Next()
 }
 
+// loadController is a gin middleware func which loads the controller once for each request, so that a request which
+// is in progress when the config is reloaded carries on with the recognisers and blocklists it started with. The
+// controller is in use until the request has finished.
+func (s server) loadController(c *gin.Context) {
+	ctrl := s.controller.Acquire()
+	defer ctrl.release()
+	c.Set(controllerKey, ctrl)
+	c.Next()
+}
+
+// currentController returns the controller loaded for this request by loadController.
+func (s server) currentController(c *gin.Context) *controller {
+	if ctrl, ok := c.Get(controllerKey); ok {
+		return ctrl.(*controller)
+	}
+	return s.controller.Load()
+}
+
+// requestController returns a copy of the request's controller configured for this request. The controller is
+// shared by every request, so it must never be modified.
+func (s server) requestController(c *gin.Context) controller {
+	requestController := *s.currentController(c)
+	requestController.exactMatch = c.GetBool(exactMatchKey)
+	if overlap, ok := c.Get(overlapKey); ok {
+		requestController.overlap = overlap.(lib.OverlapStrategy)
+	}
+	return requestController
+}
+
 func validateBody(c *gin.Context) {
 	if c.Request.Body == nil {
 		handleError(c, NewHttpError(400, errors.New("request body missing")))
@@ -14,9 +14,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,9 +28,12 @@ import (
 	. "github.com/onsi/gomega"
 
 	http_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/cmd/recognition-api/http-recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/blocklist"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/text"
 )
 
 var router *gin.Engine
@@ -77,12 +83,12 @@ var _ = Describe("GetRecognisers", func() {
 		recogniser3 := "recogniser3"
 
 		testServer := server{
-			controller: &controller{
+			controller: newLiveController(&controller{
 				// recogniser3 on the controller will be used to test that the allRecognisers flag causes recogniser3 to be used.
-				recognisers: map[string]recogniser.Client{
-					recogniser3: http_recogniser.NewLeadmineClient(recogniser3, "", blocklist.Blocklist{}),
+				recognisers: map[string]recogniser.Factory{
+					recogniser3: http_recogniser.NewLeadmineFactory(recogniser3, "", blocklist.Blocklist{}),
 				},
-			},
+			}),
 		}
 
 		// set up server, routes and handler functions with assertions
@@ -154,3 +160,94 @@ var _ = Describe("GetRecognisers", func() {
 		})
 	})
 })
+
+var _ = Describe("Tokens", func() {
+
+	tokenise := func(url, contentType, body string) []*pb.Snippet {
+		testServer := server{
+			controller: newLiveController(&controller{
+				htmlReader: html.SnippetReader{},
+				textReader: text.SnippetReader{},
+			}),
+		}
+		engine := gin.New()
+		testServer.RegisterRoutes(engine)
+
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		res := httptest.NewRecorder()
+		engine.ServeHTTP(res, req)
+		Expect(res.Code).Should(Equal(http.StatusOK))
+
+		var tokens []*pb.Snippet
+		Expect(json.Unmarshal(res.Body.Bytes(), &tokens)).Should(Succeed())
+		return tokens
+	}
+
+	// With exact matching the brackets are part of the token, and stripping the leading one moves the token's offset on
+	// to the first character which is kept, while its text is still the whole token.
+	var _ = It("Should give the offset of a bracketed token after the bracket", func() {
+		tokens := tokenise("/tokens?exact-match=true", "text/plain", "take (aspirin) daily")
+		Expect(tokens).Should(HaveLen(3))
+		Expect(tokens[1].Text).Should(Equal("(aspirin)"))
+		Expect(tokens[1].NormalisedText).Should(Equal("aspirin"))
+		Expect(tokens[1].Offset).Should(Equal(uint32(6)))
+
+		tokens = tokenise("/tokens?exact-match=true", "text/html", "<p>(aspirin)</p>")
+		Expect(tokens).Should(HaveLen(1))
+		Expect(tokens[0].Offset).Should(Equal(uint32(1)))
+
+		// without exact matching the bracket is a token of its own, which is dropped as it normalises to nothing.
+		tokens = tokenise("/tokens", "text/plain", "take (aspirin) daily")
+		Expect(tokens).Should(HaveLen(3))
+		Expect(tokens[1].Text).Should(Equal("aspirin"))
+		Expect(tokens[1].Offset).Should(Equal(uint32(6)))
+	})
+})
+
+var _ = Describe("Concurrent requests", func() {
+
+	// Run with -race: the exact-match param of one request must not leak into another.
+	var _ = It("Should keep each request's recognisers and params separate", func() {
+		testServer := server{
+			controller: newLiveController(&controller{
+				recognisers: map[string]recogniser.Factory{"echo": newEchoFactory()},
+				htmlReader:  html.SnippetReader{},
+			}),
+		}
+		engine := gin.New()
+		testServer.RegisterRoutes(engine)
+
+		const requests = 50
+		responses := make([]*httptest.ResponseRecorder, requests)
+		waitGroup := &sync.WaitGroup{}
+		for i := 0; i < requests; i++ {
+			waitGroup.Add(1)
+			go func(i int) {
+				defer waitGroup.Done()
+				url := fmt.Sprintf("/entities?recogniser=echo&exact-match=%t", i%2 == 0)
+				req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(fmt.Sprintf("<p>doc%d some-text</p>", i)))
+				req.Header.Set("Content-Type", "text/html")
+				responses[i] = httptest.NewRecorder()
+				engine.ServeHTTP(responses[i], req)
+			}(i)
+		}
+		waitGroup.Wait()
+
+		for i, res := range responses {
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			var entities []lib.APIEntity
+			Expect(json.Unmarshal(res.Body.Bytes(), &entities)).Should(Succeed())
+
+			names := entityNames(entities)
+			Expect(names).Should(HaveKey(fmt.Sprintf("doc%d", i)))
+			if i%2 == 0 {
+				Expect(names).Should(HaveLen(2))
+				Expect(names).Should(HaveKey("some-text"))
+			} else {
+				Expect(names).Should(HaveLen(4))
+				Expect(names).ShouldNot(HaveKey("some-text"))
+			}
+		}
+	})
+})
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
+	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
+)
+
+// BlocklistLoadError is returned when a recogniser's blocklist cannot be loaded.
+type BlocklistLoadError struct {
+	Path string
+	Err  error
+}
+
+func (e BlocklistLoadError) Error() string {
+	return fmt.Sprintf("failed to load blocklist '%s': %s", e.Path, e.Err)
+}
+
+func (e BlocklistLoadError) Unwrap() error {
+	return e.Err
+}
+
+// unavailableRecogniser stands in for a recogniser which could not be set up, so that requests which use it
+// fail with err rather than the whole API failing to start. It has no state, so it is its own factory.
+type unavailableRecogniser struct {
+	err error
+}
+
+func (u unavailableRecogniser) NewClient() recogniser.Client {
+	return u
+}
+
+func (u unavailableRecogniser) Recognise(_ context.Context, _ <-chan snippet_reader.Value, _ *sync.WaitGroup, _ lib.HttpOptions) error {
+	return u.err
+}
+
+func (u unavailableRecogniser) Err() error {
+	return u.err
+}
+
+func (u unavailableRecogniser) Result() []*pb.Entity {
+	return nil
+}
+
+func (u unavailableRecogniser) SetExactMatch(bool) {}
+
+func (u unavailableRecogniser) SetEntityCallback(func(entity *pb.Entity) error) {}
@@ -47,10 +47,21 @@ func main() {
 		log.Fatal().Err(err).Send()
 	}
 
-	regexps, err := getRegexps()
+	set, err := getPatterns()
 	if err != nil {
 		log.Fatal().Str("path", config.RegexFile).Err(err).Send()
 	}
+	patterns := newPatternStore(set)
+
+	// on SIGHUP re-read the regex file. If it is invalid the patterns already in use are kept.
+	lib.ReloadOnSignal(func() error {
+		set, err := getPatterns()
+		if err != nil {
+			return fmt.Errorf("regex file %s: %w", config.RegexFile, err)
+		}
+		patterns.Store(set)
+		return nil
+	})
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Server.GrpcPort))
 	if err != nil {
@@ -58,7 +69,7 @@ func main() {
 	}
 	var opts []grpc.ServerOption
 	grpcServer := grpc.NewServer(opts...)
-	pb.RegisterRecognizerServer(grpcServer, recogniser{regexps: regexps})
+	pb.RegisterRecognizerServer(grpcServer, recogniser{patterns: patterns})
 	log.Info().Int("port", config.Server.GrpcPort).Msg("ready to accept requests")
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatal().Err(err).Send()
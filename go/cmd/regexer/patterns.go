@@ -0,0 +1,291 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+	"gopkg.in/yaml.v2"
+)
+
+// patternConfig is a pattern in the regex file. A pattern can be just its regular expression, as in
+// `chebi: 'CHEBI:\d+'`, or a map of these options:
+//
+//	chebi:
+//	  pattern: 'CHEBI:(?P<id>\d+)'
+//	  case_insensitive: true
+//	  full_token: true
+//	  identifier_group: id
+//	  prefix: CHEBI
+//	  type: chemical
+//	  metadata: {source: ChEBI}
+//	  exclude: 'CHEBI:0+$'
+//	  validator: cas
+type patternConfig struct {
+	Pattern         string
+	CaseInsensitive bool   `yaml:"case_insensitive"`
+	FullToken       bool   `yaml:"full_token"`       // the pattern must match the whole token, not just part of it
+	IdentifierGroup string `yaml:"identifier_group"` // the named capture group which is the identifier, instead of the token
+	Prefix          string // the CURIE prefix of identifiers, e.g. CHEBI
+	Type            string // the type of entity, e.g. chemical
+	Metadata        map[string]interface{}
+	Exclude         string // tokens which match the pattern but also match this aren't recognised
+	Validator       string // the name of the validator in validators which matches must pass, e.g. cas
+}
+
+func (c *patternConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.Pattern); err == nil {
+		return nil
+	}
+	type plain patternConfig
+	return unmarshal((*plain)(c))
+}
+
+// entityMetadata is the metadata of the entities a pattern recognises, JSON encoded in pb.Entity.Metadata.
+type entityMetadata struct {
+	Type     string                 `json:"type,omitempty"`
+	Prefix   string                 `json:"prefix,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// pattern is a compiled patternConfig.
+type pattern struct {
+	name      string
+	re        *regexp.Regexp // matches tokens, so is anchored if the pattern is full_token
+	search    *regexp.Regexp // finds matches in whole snippets, so is never anchored
+	fullToken bool
+	exclude   *regexp.Regexp // nil if nothing is excluded
+	validate  validator      // nil if matches aren't validated
+	group     int            // the index of the identifier group, or 0 if the token is the identifier
+	prefix    string
+	metadata  string // JSON encoded entityMetadata, or "" if it's empty
+}
+
+func newPattern(name string, config patternConfig) (*pattern, error) {
+	if config.Pattern == "" {
+		return nil, fmt.Errorf("pattern %s has no pattern", name)
+	}
+
+	expr := config.Pattern
+	if config.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	search, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %s: %w", name, err)
+	}
+	re := search
+	if config.FullToken {
+		// the flags of expr apply to the whole anchored expression, and the group doesn't capture, so the indexes of
+		// capture groups are the same in both.
+		re = regexp.MustCompile("^(?:" + expr + ")$")
+	}
+	p := &pattern{name: name, re: re, search: search, fullToken: config.FullToken, prefix: config.Prefix}
+
+	if config.IdentifierGroup != "" {
+		p.group = re.SubexpIndex(config.IdentifierGroup)
+		if p.group < 0 {
+			return nil, fmt.Errorf("pattern %s has no capture group named %s", name, config.IdentifierGroup)
+		}
+	}
+
+	if config.Exclude != "" {
+		exclude := config.Exclude
+		if config.CaseInsensitive {
+			exclude = "(?i)" + exclude
+		}
+		if p.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("pattern %s exclude: %w", name, err)
+		}
+	}
+
+	if config.Validator != "" {
+		if p.validate = validators[config.Validator]; p.validate == nil {
+			return nil, fmt.Errorf("pattern %s has unknown validator %s", name, config.Validator)
+		}
+	}
+
+	metadata := entityMetadata{Type: config.Type, Prefix: config.Prefix, Metadata: jsonMap(config.Metadata)}
+	if metadata.Type != "" || metadata.Prefix != "" || len(metadata.Metadata) > 0 {
+		b, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s metadata: %w", name, err)
+		}
+		p.metadata = string(b)
+	}
+	return p, nil
+}
+
+// identifier returns the identifier of the token in snippet, and false if the pattern doesn't recognise it. Unless the
+// pattern has an identifier group, the identifier is the token's text without any enclosing brackets or quotes.
+func (p *pattern) identifier(snippet *pb.Snippet) (string, bool) {
+	token := snippet.GetNormalisedText()
+	match := p.re.FindStringSubmatch(token)
+	if match == nil || match[p.group] == "" {
+		return "", false
+	}
+	if p.exclude != nil && p.exclude.MatchString(token) {
+		return "", false
+	}
+	// the part of the token which matched is validated, even if the whole token is the identifier.
+	if p.validate != nil && !p.validate(match[p.group]) {
+		return "", false
+	}
+
+	// the token's text, without any enclosing brackets or quotes, as in the entity's surface text.
+	start, end, _ := text.TrimEnclosingCharacters(snippet.GetText())
+	identifier := snippet.GetText()[start:end]
+	if p.group > 0 {
+		identifier = match[p.group]
+	}
+	return p.curie(identifier), true
+}
+
+// match is a match of a pattern in a snippet.
+type match struct {
+	start, end int // byte offsets of the match in the snippet's text
+	identifier string
+}
+
+// matches returns the matches of the pattern in text, which hasn't been tokenised, so matches can span several tokens.
+// If the pattern is full_token, matches must start and end at the boundaries of words.
+func (p *pattern) matches(text string) []match {
+	var matches []match
+	for _, loc := range p.search.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start == end {
+			continue
+		}
+		if p.fullToken && !atWordBoundaries(text, start, end) {
+			continue
+		}
+		if p.exclude != nil && p.exclude.MatchString(text[start:end]) {
+			continue
+		}
+
+		identifier := text[start:end]
+		if p.group > 0 {
+			groupStart, groupEnd := loc[2*p.group], loc[2*p.group+1]
+			if groupStart == groupEnd {
+				continue
+			}
+			identifier = text[groupStart:groupEnd]
+		}
+		if p.validate != nil && !p.validate(identifier) {
+			continue
+		}
+		matches = append(matches, match{start: start, end: end, identifier: p.curie(identifier)})
+	}
+	return matches
+}
+
+// curie adds the pattern's prefix, if it has one, to identifier, unless it already starts with it.
+func (p *pattern) curie(identifier string) string {
+	if p.prefix != "" && !strings.HasPrefix(identifier, p.prefix+":") {
+		return p.prefix + ":" + identifier
+	}
+	return identifier
+}
+
+// atWordBoundaries returns whether text[start:end] isn't directly preceded or followed by a letter or digit.
+func atWordBoundaries(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// jsonMap converts the maps which YAML decodes metadata into, which have interface{} keys, into maps with string keys,
+// which can be encoded as JSON.
+func jsonMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	converted := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		converted[k] = jsonValue(v)
+	}
+	return converted
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			converted[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, value := range v {
+			converted[i] = jsonValue(value)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// parsePatterns parses a regex file, returning its patterns in order of their names.
+func parsePatterns(b []byte) ([]*pattern, error) {
+	var configs map[string]patternConfig
+	if err := yaml.Unmarshal(b, &configs); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	patterns := make([]*pattern, 0, len(names))
+	for _, name := range names {
+		p, err := newPattern(name, configs[name])
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func getPatterns() (*patternSet, error) {
+	b, err := ioutil.ReadFile(config.RegexFile)
+	if err != nil {
+		return nil, err
+	}
+	patterns, err := parsePatterns(b)
+	if err != nil {
+		return nil, err
+	}
+	return newPatternSet(patterns)
+}
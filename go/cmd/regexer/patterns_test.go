@@ -0,0 +1,143 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+)
+
+const testPatterns = `
+chembl: 'CHEMBL\d+'
+chebi:
+  pattern: 'chebi:(?P<id>\d+)'
+  case_insensitive: true
+  full_token: true
+  identifier_group: id
+  prefix: CHEBI
+  type: chemical
+  metadata:
+    source: ChEBI
+    tags: [small molecule]
+    links: {home: 'https://www.ebi.ac.uk/chebi'}
+  exclude: ':0+$'
+`
+
+func Test_parsePatterns(t *testing.T) {
+	patterns, err := parsePatterns([]byte(testPatterns))
+	require.NoError(t, err)
+	require.Len(t, patterns, 2)
+
+	assert.Equal(t, "chebi", patterns[0].name)
+	assert.Equal(t, `{"type":"chemical","prefix":"CHEBI","metadata":{"links":{"home":"https://www.ebi.ac.uk/chebi"},"source":"ChEBI","tags":["small molecule"]}}`, patterns[0].metadata)
+	assert.Equal(t, "chembl", patterns[1].name)
+	assert.Equal(t, "", patterns[1].metadata)
+}
+
+func Test_parsePatterns_Errors(t *testing.T) {
+	tests := map[string]string{
+		"no pattern":        `chebi: {type: chemical}`,
+		"invalid pattern":   `chebi: 'CHEBI:(\d+'`,
+		"missing group":     `chebi: {pattern: 'CHEBI:\d+', identifier_group: id}`,
+		"invalid exclusion": `chebi: {pattern: 'CHEBI:\d+', exclude: '('}`,
+	}
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePatterns([]byte(file))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_pattern_identifier(t *testing.T) {
+	patterns, err := parsePatterns([]byte(testPatterns))
+	require.NoError(t, err)
+	chebi, chembl := patterns[0], patterns[1]
+	prefixed, err := newPattern("prefixed", patternConfig{Pattern: `^(CHEBI:)?\d+$`, Prefix: "CHEBI"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		pattern *pattern
+		token   string
+		want    string
+		wantOk  bool
+	}{
+		{name: "legacy pattern is the token", pattern: chembl, token: "CHEMBL25", want: "CHEMBL25", wantOk: true},
+		{name: "legacy pattern isn't anchored", pattern: chembl, token: "xCHEMBL25", want: "xCHEMBL25", wantOk: true},
+		{name: "legacy pattern is case sensitive", pattern: chembl, token: "chembl25"},
+		{name: "identifier group with prefix", pattern: chebi, token: "CHEBI:15365", want: "CHEBI:15365", wantOk: true},
+		{name: "case insensitive", pattern: chebi, token: "ChEBI:15365", want: "CHEBI:15365", wantOk: true},
+		{name: "full token", pattern: chebi, token: "CHEBI:15365x"},
+		{name: "excluded", pattern: chebi, token: "CHEBI:000"},
+		{name: "enclosing brackets aren't in the identifier", pattern: chembl, token: "(CHEMBL25)", want: "CHEMBL25", wantOk: true},
+		{name: "enclosing brackets aren't prefixed", pattern: prefixed, token: "(CHEBI:123)", want: "CHEBI:123", wantOk: true},
+		{name: "enclosing quotes aren't prefixed", pattern: prefixed, token: `"123"`, want: "CHEBI:123", wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet := &pb.Snippet{Text: tt.token}
+			text.NormalizeSnippet(snippet)
+			got, ok := tt.pattern.identifier(snippet)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_pattern_matches(t *testing.T) {
+	patterns, err := parsePatterns([]byte(testPatterns))
+	require.NoError(t, err)
+	chebi, chembl := patterns[0], patterns[1]
+
+	tests := []struct {
+		name    string
+		pattern *pattern
+		text    string
+		want    []match
+	}{
+		{
+			name:    "every match",
+			pattern: chembl,
+			text:    "CHEMBL25 and CHEMBL1",
+			want:    []match{{start: 0, end: 8, identifier: "CHEMBL25"}, {start: 13, end: 20, identifier: "CHEMBL1"}},
+		},
+		{
+			name:    "not full token",
+			pattern: chembl,
+			text:    "xCHEMBL25",
+			want:    []match{{start: 1, end: 9, identifier: "CHEMBL25"}},
+		},
+		{
+			name:    "full token",
+			pattern: chebi,
+			text:    "(chebi:15365) xCHEBI:1 CHEBI:2x CHEBI:000",
+			want:    []match{{start: 1, end: 12, identifier: "CHEBI:15365"}},
+		},
+		{
+			name:    "no matches",
+			pattern: chebi,
+			text:    "aspirin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.pattern.matches(tt.text))
+		})
+	}
+}
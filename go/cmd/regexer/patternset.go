@@ -0,0 +1,208 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// patternSet finds the patterns which may match a token in a single scan, rather than trying every pattern on every
+// token. Almost every match of an identifier pattern contains some literal text, e.g. CHEMBL for CHEMBL\d+, so the
+// literals of all the patterns are put in a trie, which finds all the literals in a token at once. Only the patterns
+// whose literal is in the token, and those which have no literal, are then tried, in order of their names, so entities
+// are always sent in the same order.
+type patternSet struct {
+	patterns   []*pattern
+	literals   *trieNode // the case-sensitive literals of the patterns
+	folded     *trieNode // the case-insensitive literals of the patterns, case folded with foldString
+	unfiltered []int     // the indexes of the patterns which have no literal, so are always tried
+	found      sync.Pool // *[]bool, the patterns found in a token, reused so that candidates doesn't allocate them
+}
+
+// trieNode is a node of a trie of literals, keyed by their bytes.
+type trieNode struct {
+	children map[byte]*trieNode
+	patterns []int // the indexes of the patterns whose literal ends here
+}
+
+func (n *trieNode) add(literal string, pattern int) {
+	for i := 0; i < len(literal); i++ {
+		child, ok := n.children[literal[i]]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[byte]*trieNode)
+			}
+			child = &trieNode{}
+			n.children[literal[i]] = child
+		}
+		n = child
+	}
+	n.patterns = append(n.patterns, pattern)
+}
+
+// find sets found[i] for every pattern i whose literal is in text.
+func (n *trieNode) find(text string, found []bool) {
+	for start := 0; start < len(text); start++ {
+		node := n
+		for i := start; i < len(text); i++ {
+			if node = node.children[text[i]]; node == nil {
+				break
+			}
+			for _, pattern := range node.patterns {
+				found[pattern] = true
+			}
+		}
+	}
+}
+
+func newPatternSet(patterns []*pattern) (*patternSet, error) {
+	set := &patternSet{patterns: patterns}
+	for i, p := range patterns {
+		re, err := syntax.Parse(p.search.String(), syntax.Perl)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", p.name, err)
+		}
+		switch l := requiredLiteral(re); {
+		case l.text == "":
+			set.unfiltered = append(set.unfiltered, i)
+		case l.fold:
+			if set.folded == nil {
+				set.folded = &trieNode{}
+			}
+			set.folded.add(foldString(l.text), i)
+		default:
+			if set.literals == nil {
+				set.literals = &trieNode{}
+			}
+			set.literals.add(l.text, i)
+		}
+	}
+	return set, nil
+}
+
+// literal is text which every match of a pattern contains.
+type literal struct {
+	text string // "" if the pattern has no literal text, so can't be filtered
+	fold bool   // whether text is case-insensitive
+}
+
+// requiredLiteral returns the longest run of literal text which every match of re contains, e.g. CHEMBL for
+// CHEMBL\d+. Alternations are not searched for text in common, so they have no literal text.
+func requiredLiteral(re *syntax.Regexp) literal {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literal{text: string(re.Rune), fold: re.Flags&syntax.FoldCase != 0}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// adjacent literals are one run of text, as long as they are all case-sensitive or all case-insensitive.
+		var longest, run literal
+		for _, sub := range re.Sub {
+			next := requiredLiteral(sub)
+			if sub.Op == syntax.OpLiteral && (run.text == "" || run.fold == next.fold) {
+				run.text += next.text
+				run.fold = next.fold
+			} else {
+				longest = longer(longest, run)
+				run = literal{}
+				if sub.Op == syntax.OpLiteral {
+					run = next
+				} else {
+					longest = longer(longest, next)
+				}
+			}
+		}
+		return longer(longest, run)
+	}
+	return literal{}
+}
+
+func longer(a, b literal) literal {
+	if len(b.text) > len(a.text) {
+		return b
+	}
+	return a
+}
+
+// foldString replaces each rune of s with the smallest rune it is equal to when case is ignored, so two strings are
+// equal ignoring case, as regular expressions ignore case, if their folded strings are equal.
+func foldString(s string) string {
+	return strings.Map(foldRune, s)
+}
+
+func foldRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		// the smallest rune in the fold of every ASCII letter, including k and s, is its upper case.
+		if 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		return r
+	}
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < smallest {
+			smallest = f
+		}
+	}
+	return smallest
+}
+
+// candidates returns the patterns which may match text, which is a token or, for whole snippets, the text of a
+// snippet, or nil if none can.
+func (s *patternSet) candidates(text string) []*pattern {
+	found, ok := s.found.Get().(*[]bool)
+	if !ok {
+		slice := make([]bool, len(s.patterns))
+		found = &slice
+	}
+	defer s.found.Put(found)
+
+	if s.literals != nil {
+		s.literals.find(text, *found)
+	}
+	// most regex files have no case-insensitive literals, so tokens needn't be folded.
+	if s.folded != nil {
+		s.folded.find(foldString(text), *found)
+	}
+	for _, i := range s.unfiltered {
+		(*found)[i] = true
+	}
+
+	count := 0
+	for _, f := range *found {
+		if f {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	candidates := make([]*pattern, 0, count)
+	for i, p := range s.patterns {
+		if (*found)[i] {
+			candidates = append(candidates, p)
+			(*found)[i] = false
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp/syntax"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
+)
+
+func Test_requiredLiteral(t *testing.T) {
+	tests := []struct {
+		expr string
+		want literal
+	}{
+		{expr: `CHEMBL\d+`, want: literal{text: "CHEMBL"}},
+		{expr: `(?i)chebi:(?P<id>\d+)`, want: literal{text: "CHEBI:", fold: true}},
+		{expr: `^(?:ENS(MUS)?[EGPRT]\d{11})$`, want: literal{text: "ENS"}},
+		{expr: `R-[A-Z]{3}-\d+`, want: literal{text: "R-"}},
+		{expr: `(?:HMDB)+\d`, want: literal{text: "HMDB"}},
+		{expr: `(PMC){0,1}\d+`, want: literal{}},
+		{expr: `(HGNC|hgnc):\d+`, want: literal{text: ":"}},
+		{expr: `ab(?i:cde)`, want: literal{text: "CDE", fold: true}},
+		{expr: `[CD]\d{5}`, want: literal{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			re, err := syntax.Parse(tt.expr, syntax.Perl)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, requiredLiteral(re))
+		})
+	}
+}
+
+func Test_foldString(t *testing.T) {
+	// the Kelvin sign and long s are equal to k and s when case is ignored.
+	assert.Equal(t, foldString("kask"), foldString("\u212aA\u017fK"))
+	assert.Equal(t, foldString("straße"), foldString("STRAẞE"))
+	assert.NotEqual(t, foldString("chebi"), foldString("chemb"))
+}
+
+func Test_patternSet_candidates(t *testing.T) {
+	patterns, err := parsePatterns([]byte(`
+chebi: {pattern: 'chebi:(?P<id>\d+)', case_insensitive: true, full_token: true}
+chembl: 'CHEMBL\d+'
+kegg: '[CD]\d{5}'
+`))
+	require.NoError(t, err)
+	set, err := newPatternSet(patterns)
+	require.NoError(t, err)
+	chebi, chembl, kegg := patterns[0], patterns[1], patterns[2]
+
+	// kegg has no literal, so is always a candidate.
+	tests := []struct {
+		token string
+		want  []*pattern
+	}{
+		{token: "aspirin", want: []*pattern{kegg}},
+		{token: "CHEBI:15365", want: []*pattern{chebi, kegg}},
+		{token: "ChEBI:15365", want: []*pattern{chebi, kegg}},
+		{token: "chembl25", want: []*pattern{kegg}},
+		{token: "CHEMBL25", want: []*pattern{chembl, kegg}},
+		{token: "see chebi:15365 and CHEMBL25", want: []*pattern{chebi, chembl, kegg}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			got := set.candidates(tt.token)
+			assert.Equal(t, len(tt.want), len(got))
+			for i := range tt.want {
+				assert.Same(t, tt.want[i], got[i])
+			}
+		})
+	}
+
+	empty, err := newPatternSet(nil)
+	require.NoError(t, err)
+	assert.Empty(t, empty.candidates("CHEMBL25"))
+}
+
+// Test_patternSet_example checks that the pattern set recognises the same tokens as trying every pattern on every
+// token.
+func Test_patternSet_example(t *testing.T) {
+	set := examplePatterns(t)
+	for _, token := range acetylcarnitineTokens(t) {
+		var want, got []string
+		for _, p := range set.patterns {
+			if identifier, ok := p.identifier(token); ok {
+				want = append(want, p.name+"="+identifier)
+			}
+		}
+		for _, p := range set.candidates(token.GetNormalisedText()) {
+			if identifier, ok := p.identifier(token); ok {
+				got = append(got, p.name+"="+identifier)
+			}
+		}
+		assert.Equal(t, want, got, token.GetNormalisedText())
+	}
+}
+
+func examplePatterns(tb testing.TB) *patternSet {
+	b, err := ioutil.ReadFile("../../../config/regex_file.example.yml")
+	require.NoError(tb, err)
+	patterns, err := parsePatterns(b)
+	require.NoError(tb, err)
+	set, err := newPatternSet(patterns)
+	require.NoError(tb, err)
+	return set
+}
+
+// manyPatterns returns n patterns like those in the example regex file, none of which match the acetylcarnitine page.
+func manyPatterns(tb testing.TB, n int) *patternSet {
+	var regexFile strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&regexFile, "id%d: 'ID%d:\\d{5,}'\n", i, i)
+	}
+	patterns, err := parsePatterns([]byte(regexFile.String()))
+	require.NoError(tb, err)
+	set, err := newPatternSet(patterns)
+	require.NoError(tb, err)
+	return set
+}
+
+func acetylcarnitineTokens(tb testing.TB) []*pb.Snippet {
+	b, err := ioutil.ReadFile("../../resources/acetylcarnitine.txt")
+	require.NoError(tb, err)
+	var tokens []*pb.Snippet
+	err = text.Tokenize(&pb.Snippet{Text: string(b)}, func(token *pb.Snippet) error {
+		text.NormalizeSnippet(token)
+		tokens = append(tokens, token)
+		return nil
+	}, false)
+	require.NoError(tb, err)
+	return tokens
+}
+
+// BenchmarkRecogniser compares trying every pattern on every token of the acetylcarnitine page with trying only the
+// candidates of the pattern set.
+func BenchmarkRecogniser(b *testing.B) {
+	tokens := acetylcarnitineTokens(b)
+	sets := []struct {
+		name string
+		set  *patternSet
+	}{
+		{name: "example", set: examplePatterns(b)},
+		{name: "500 patterns", set: manyPatterns(b, 500)},
+	}
+	for _, s := range sets {
+		b.Run(s.name+"/every pattern", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, token := range tokens {
+					for _, p := range s.set.patterns {
+						p.identifier(token)
+					}
+				}
+			}
+		})
+		b.Run(s.name+"/pattern set", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, token := range tokens {
+					for _, p := range s.set.candidates(token.GetNormalisedText()) {
+						p.identifier(token)
+					}
+				}
+			}
+		})
+	}
+}
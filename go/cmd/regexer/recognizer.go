@@ -15,22 +15,46 @@ package main
 
 import (
 	"io"
-	"io/ioutil"
-	"regexp"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	lib_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/text"
-	"gopkg.in/yaml.v2"
 )
 
+// patternStore holds the patterns in use, which are replaced when the regex file is reloaded.
+type patternStore struct {
+	value atomic.Value // *patternSet
+}
+
+func newPatternStore(patterns *patternSet) *patternStore {
+	store := &patternStore{}
+	store.Store(patterns)
+	return store
+}
+
+func (s *patternStore) Load() *patternSet {
+	return s.value.Load().(*patternSet)
+}
+
+func (s *patternStore) Store(patterns *patternSet) {
+	s.value.Store(patterns)
+}
+
 type recogniser struct {
 	pb.UnimplementedRecognizerServer
-	regexps map[string]*regexp.Regexp
+	patterns *patternStore
 }
 
 func (r recogniser) GetStream(stream pb.Recognizer_GetStreamServer) error {
 	log.Info().Msg("received request")
+	// the patterns are loaded once, so a stream which is in progress when the regex file is reloaded carries on with the
+	// patterns it started with.
+	patterns := r.patterns.Load()
+	// the recognition API says whether it sends whole snippets, in which patterns are matched anywhere, or tokens.
+	wholeSnippets := lib_recogniser.WholeSnippets(stream.Context())
 	// listen for tokens
 	for {
 		snippet, err := stream.Recv()
@@ -40,47 +64,69 @@ func (r recogniser) GetStream(stream pb.Recognizer_GetStreamServer) error {
 			return err
 		}
 
+		if wholeSnippets {
+			if err := sendMatches(stream, patterns, snippet); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// normalize the snippet (removes punctuation and enforces NFKC encoding on the utf8 characters).
 		// We might not really need to normalise here. Something to think about.
 		text.NormalizeSnippet(snippet)
+		start, end, _ := text.TrimEnclosingCharacters(snippet.GetText())
+		surfaceText := snippet.GetText()[start:end]
 
-		// For every regexp try to match the snippet and send the recognised entity if there is a match.
-		for name, re := range r.regexps {
-			if re.MatchString(snippet.GetNormalisedText()) {
-				err := stream.Send(&pb.Entity{
-					Name:     snippet.GetNormalisedText(),
-					Position: snippet.GetOffset(),
-					Xpath:    snippet.GetXpath(),
-					Identifiers: map[string]string{
-						name: snippet.GetText(),
-					},
-				})
-				if err != nil {
-					return err
-				}
+		// For every pattern which may match the snippet try to match it and send the recognised entity if there is a match.
+		for _, p := range patterns.candidates(snippet.GetNormalisedText()) {
+			identifier, ok := p.identifier(snippet)
+			if !ok {
+				continue
+			}
+			err := stream.Send(&pb.Entity{
+				Name:        snippet.GetNormalisedText(),
+				Position:    snippet.GetOffset(),
+				EndPosition: snippet.GetOffset() + uint32(utf8.RuneCountInString(surfaceText)),
+				Text:        surfaceText,
+				Xpath:       snippet.GetXpath(),
+				Recogniser:  p.name,
+				Identifiers: map[string]string{
+					p.name: identifier,
+				},
+				Metadata: p.metadata,
+			})
+			if err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
-func getRegexps() (map[string]*regexp.Regexp, error) {
-	b, err := ioutil.ReadFile(config.RegexFile)
-	if err != nil {
-		return nil, err
-	}
-
-	var regexpStringMap map[string]string
-	if err := yaml.Unmarshal(b, &regexpStringMap); err != nil {
-		return nil, err
-	}
-
-	regexps := make(map[string]*regexp.Regexp)
-	for name, uncompiledRegexp := range regexpStringMap {
-		regexps[name], err = regexp.Compile(uncompiledRegexp)
-		if err != nil {
-			return nil, err
+// sendMatches sends an entity for every match of every pattern in snippet, which hasn't been tokenised, with the
+// exact position and text of the match.
+func sendMatches(stream pb.Recognizer_GetStreamServer, patterns *patternSet, snippet *pb.Snippet) error {
+	for _, p := range patterns.candidates(snippet.GetText()) {
+		for _, m := range p.matches(snippet.GetText()) {
+			surfaceText := snippet.GetText()[m.start:m.end]
+			normalisedText, _, _ := text.NormalizeString(surfaceText)
+			position := snippet.GetOffset() + uint32(utf8.RuneCountInString(snippet.GetText()[:m.start]))
+			err := stream.Send(&pb.Entity{
+				Name:        normalisedText,
+				Position:    position,
+				EndPosition: position + uint32(utf8.RuneCountInString(surfaceText)),
+				Text:        surfaceText,
+				Xpath:       snippet.GetXpath(),
+				Recogniser:  p.name,
+				Identifiers: map[string]string{
+					p.name: m.identifier,
+				},
+				Metadata: p.metadata,
+			})
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return regexps, nil
+	return nil
 }
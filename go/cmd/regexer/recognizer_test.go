@@ -14,12 +14,15 @@
 package main
 
 import (
-	"regexp"
+	"context"
 	"testing"
 
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+	lib_recogniser "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/recogniser"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/testhelpers"
+	"google.golang.org/grpc/metadata"
 )
 
 type RecognizerSuite struct {
@@ -32,12 +35,17 @@ func TestRecognizerSuite(t *testing.T) {
 }
 
 func (s *RecognizerSuite) Test_recogniser_Recognize() {
-	s.recogniser = recogniser{regexps: map[string]*regexp.Regexp{
-		"test_regex": regexp.MustCompile("hello"),
-	}}
+	patterns, err := parsePatterns([]byte(`test_regex: hello`))
+	s.Require().NoError(err)
+	set, err := newPatternSet(patterns)
+	s.Require().NoError(err)
+	s.recogniser = recogniser{patterns: newPatternStore(set)}
 	mockStream := testhelpers.NewMockRecognizeServerStream(testhelpers.CreateSnippets("hello", "my", "name", "is", "jeff")...)
 	foundEntity := &pb.Entity{
-		Name: "hello",
+		Name:        "hello",
+		EndPosition: 5,
+		Text:        "hello",
+		Recogniser:  "test_regex",
 		Identifiers: map[string]string{
 			"test_regex": "hello",
 		},
@@ -64,3 +72,94 @@ func (s *RecognizerSuite) Test_recogniser_Recognize() {
 	}
 	mockStream.AssertExpectations(s.T())
 }
+
+func (s *RecognizerSuite) Test_recogniser_Recognize_WholeSnippets() {
+	patterns, err := parsePatterns([]byte(`
+clinical_trials: {pattern: 'NCT ?\d{4} ?\d{4}', full_token: true}
+ec: {pattern: 'EC (?P<number>\d+\.\d+\.\d+\.\d+)', identifier_group: number, prefix: EC, full_token: true}
+reactome: {pattern: 'R-[A-Z]{3}-\d+', full_token: true}
+`))
+	s.Require().NoError(err)
+	set, err := newPatternSet(patterns)
+	s.Require().NoError(err)
+	s.recogniser = recogniser{patterns: newPatternStore(set)}
+
+	// the recognition API tells the regexer it is sending whole snippets in the stream's metadata.
+	md, _ := metadata.FromOutgoingContext(lib_recogniser.WithWholeSnippets(context.Background()))
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	// positions are counted in runes, so é, which is two bytes, only counts once.
+	mockStream := testhelpers.NewMockRecognizeServerStreamWithContext(ctx,
+		testhelpers.CreateSnippet("Inhibits EC 1.1.1.1 in NCT 0123 4567, see é R-HSA-199420 (not xR-HSA-1).", "", 10, "/p"),
+	)
+	for _, entity := range []*pb.Entity{
+		{
+			Name:        "NCT 0123 4567",
+			Position:    33,
+			EndPosition: 46,
+			Text:        "NCT 0123 4567",
+			Xpath:       "/p",
+			Recogniser:  "clinical_trials",
+			Identifiers: map[string]string{"clinical_trials": "NCT 0123 4567"},
+		},
+		{
+			Name:        "EC 1.1.1.1",
+			Position:    19,
+			EndPosition: 29,
+			Text:        "EC 1.1.1.1",
+			Xpath:       "/p",
+			Recogniser:  "ec",
+			Identifiers: map[string]string{"ec": "EC:1.1.1.1"},
+			Metadata:    `{"prefix":"EC"}`,
+		},
+		{
+			Name:        "R-HSA-199420",
+			Position:    54,
+			EndPosition: 66,
+			Text:        "R-HSA-199420",
+			Xpath:       "/p",
+			Recogniser:  "reactome",
+			Identifiers: map[string]string{"reactome": "R-HSA-199420"},
+		},
+	} {
+		mockStream.On("Send", entity).Return(nil).Once()
+	}
+
+	s.NoError(s.recogniser.GetStream(mockStream))
+	mockStream.AssertExpectations(s.T())
+}
+
+func (s *RecognizerSuite) Test_recogniser_Recognize_Reload() {
+	parse := func(regexFile string) *patternSet {
+		patterns, err := parsePatterns([]byte(regexFile))
+		s.Require().NoError(err)
+		set, err := newPatternSet(patterns)
+		s.Require().NoError(err)
+		return set
+	}
+	s.recogniser = recogniser{patterns: newPatternStore(parse(`before: hello`))}
+	entity := func(pattern string) *pb.Entity {
+		return &pb.Entity{
+			Name:        "hello",
+			EndPosition: 5,
+			Text:        "hello",
+			Recogniser:  pattern,
+			Identifiers: map[string]string{pattern: "hello"},
+		}
+	}
+
+	// the regex file is reloaded after the first token, but the stream carries on with the patterns it started with.
+	mockStream := testhelpers.NewMockRecognizeServerStream(testhelpers.CreateSnippets("hello", "hello")...)
+	mockStream.On("Send", entity("before")).Return(nil).Once().Run(func(mock.Arguments) {
+		s.recogniser.patterns.Store(parse(`after: hello`))
+	})
+	mockStream.On("Send", entity("before")).Return(nil).Once()
+	s.NoError(s.recogniser.GetStream(mockStream))
+	mockStream.AssertExpectations(s.T())
+
+	// new streams use the reloaded patterns.
+	mockStream = testhelpers.NewMockRecognizeServerStream(testhelpers.CreateSnippets("hello")...)
+	mockStream.On("Send", entity("after")).Return(nil).Once()
+	s.NoError(s.recogniser.GetStream(mockStream))
+	mockStream.AssertExpectations(s.T())
+}
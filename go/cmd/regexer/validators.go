@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A validator checks an identifier which a pattern has matched, e.g. by its check digit, to weed out text which only
+// looks like an identifier.
+type validator func(identifier string) bool
+
+// validators are the validators which patterns can name with the regex file's validator option. Add a validator to
+// make it available to every pattern.
+var validators = map[string]validator{
+	"cas":      validCAS,
+	"inchikey": validInChIKey,
+	"isbn":     validISBN,
+	"issn":     validISSN,
+	"luhn":     validLuhn,
+	"doi":      validDOI,
+}
+
+var (
+	casPattern      = regexp.MustCompile(`^(\d{2,7})-(\d{2})-(\d)$`)
+	inchiKeyPattern = regexp.MustCompile(`^[A-Z]{14}-[A-Z]{8}[SN]A-[A-Z]$`)
+	issnPattern     = regexp.MustCompile(`^(\d{4})-?(\d{3}[\dXx])$`)
+	// Crossref's recommended pattern, which matches all but a few very old DOIs.
+	doiPattern = regexp.MustCompile(`(?i)^10\.\d{4,9}/[-._;()/:a-z0-9]+$`)
+)
+
+// validCAS checks the check digit of a CAS registry number, e.g. 50-78-2: the last digit is the sum of the others,
+// each multiplied by its position from the right, mod 10.
+func validCAS(identifier string) bool {
+	parts := casPattern.FindStringSubmatch(identifier)
+	if parts == nil {
+		return false
+	}
+	digits := parts[1] + parts[2]
+	sum := 0
+	for i := range digits {
+		sum += int(digits[len(digits)-1-i]-'0') * (i + 1)
+	}
+	return sum%10 == int(parts[3][0]-'0')
+}
+
+// validInChIKey checks the structure of a standard or non-standard InChIKey, e.g. BSYNRYMUTXBXSQ-UHFFFAOYSA-N. The
+// blocks are hashes, so they can't be checked further.
+func validInChIKey(identifier string) bool {
+	return inchiKeyPattern.MatchString(identifier)
+}
+
+// validISSN checks the check digit of an ISSN, e.g. 0378-5955, which is X, or x, for 10.
+func validISSN(identifier string) bool {
+	parts := issnPattern.FindStringSubmatch(identifier)
+	if parts == nil {
+		return false
+	}
+	return validMod11(parts[1] + parts[2])
+}
+
+// validISBN checks the check digit of an ISBN-10 or ISBN-13, with or without hyphens or spaces between its groups.
+func validISBN(identifier string) bool {
+	digits := stripSeparators(identifier)
+	switch len(digits) {
+	case 10:
+		return validMod11(digits)
+	case 13:
+		sum := 0
+		for i := range digits {
+			d := digits[i]
+			if d < '0' || d > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += int(d-'0') * weight
+		}
+		return sum%10 == 0
+	default:
+		return false
+	}
+}
+
+// validMod11 checks the check digit of ISSNs and ISBN-10s: the sum of the digits, each multiplied by its position
+// from the right, is a multiple of 11. The check digit may be X, or x, for 10.
+func validMod11(digits string) bool {
+	sum := 0
+	for i := range digits {
+		d := digits[i]
+		var value int
+		switch {
+		case d >= '0' && d <= '9':
+			value = int(d - '0')
+		case (d == 'X' || d == 'x') && i == len(digits)-1:
+			value = 10
+		default:
+			return false
+		}
+		sum += value * (len(digits) - i)
+	}
+	return sum%11 == 0
+}
+
+// validLuhn checks the check digit of identifiers using the Luhn algorithm, e.g. credit card and IMEI numbers, with or
+// without hyphens or spaces between groups of digits.
+func validLuhn(identifier string) bool {
+	digits := stripSeparators(identifier)
+	if len(digits) < 2 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if d < '0' || d > '9' {
+			return false
+		}
+		value := int(d - '0')
+		if i%2 == 1 {
+			value *= 2
+			if value > 9 {
+				value -= 9
+			}
+		}
+		sum += value
+	}
+	return sum%10 == 0
+}
+
+// validDOI checks the syntax of a DOI, e.g. 10.1000/182.
+func validDOI(identifier string) bool {
+	return doiPattern.MatchString(identifier)
+}
+
+func stripSeparators(identifier string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(identifier)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+)
+
+func Test_validators(t *testing.T) {
+	tests := []struct {
+		validator string
+		valid     []string
+		invalid   []string
+	}{
+		{
+			validator: "cas",
+			valid:     []string{"50-78-2", "7732-18-5", "1111111-11-5"},
+			invalid:   []string{"50-78-3", "1-23-4", "50-7-2", "50-78-22", "50782"},
+		},
+		{
+			validator: "inchikey",
+			valid:     []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N", "XLYOFNOQVPJJNP-UHFFFAOYNA-N"},
+			invalid:   []string{"bsynrymutxbxsq-uhfffaoysa-n", "BSYNRYMUTXBXSQ-UHFFFAOYXA-N", "BSYNRYMUTXBXSQ-UHFFFAOYSA"},
+		},
+		{
+			validator: "issn",
+			valid:     []string{"0378-5955", "2434-561X", "2434-561x", "03785955"},
+			invalid:   []string{"0378-5954", "2434-5610", "378-5955", "X378-5955"},
+		},
+		{
+			validator: "isbn",
+			valid:     []string{"0-306-40615-2", "0306406152", "978-0-306-40615-7", "978 0 306 40615 7", "0-8044-2957-X", "0-8044-2957-x"},
+			invalid:   []string{"0-306-40615-3", "978-0-306-40615-8", "978-0-306-4061", "X-306-40615-2"},
+		},
+		{
+			validator: "luhn",
+			valid:     []string{"79927398713", "4539 1488 0343 6467"},
+			invalid:   []string{"0", "79927398710", "4539-1488-0343-6468", "7992739871a"},
+		},
+		{
+			validator: "doi",
+			valid:     []string{"10.1000/182", "10.1038/nphys1170", "10.1016/j.cell.2009.01.002"},
+			invalid:   []string{"10.10/182", "11.1000/182", "10.1000/", "10.1000/has space"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.validator, func(t *testing.T) {
+			validate := validators[tt.validator]
+			require.NotNil(t, validate)
+			for _, identifier := range tt.valid {
+				assert.True(t, validate(identifier), identifier)
+			}
+			for _, identifier := range tt.invalid {
+				assert.False(t, validate(identifier), identifier)
+			}
+		})
+	}
+}
+
+func Test_pattern_Validator(t *testing.T) {
+	patterns, err := parsePatterns([]byte(`cas: {pattern: '(?P<number>\d+-\d+-\d)', identifier_group: number, validator: cas}`))
+	require.NoError(t, err)
+	cas := patterns[0]
+
+	identifier, ok := cas.identifier(&pb.Snippet{Text: "50-78-2", NormalisedText: "50-78-2"})
+	assert.True(t, ok)
+	assert.Equal(t, "50-78-2", identifier)
+	_, ok = cas.identifier(&pb.Snippet{Text: "2021-10-1", NormalisedText: "2021-10-1"})
+	assert.False(t, ok)
+
+	assert.Equal(t, []match{{start: 10, end: 17, identifier: "50-78-2"}}, cas.matches("2021-10-1 50-78-2"))
+
+	_, err = parsePatterns([]byte(`cas: {pattern: '\d+-\d+-\d', validator: checksum}`))
+	assert.Error(t, err)
+}
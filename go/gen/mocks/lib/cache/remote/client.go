@@ -12,13 +12,136 @@ type Client struct {
 	mock.Mock
 }
 
-// NewGetPipeline provides a mock function with given fields: size
-func (_m *Client) NewGetPipeline(size int) remote.GetPipeline {
-	ret := _m.Called(size)
+// Activate provides a mock function with given fields: manifest
+func (_m *Client) Activate(manifest remote.Manifest) error {
+	ret := _m.Called(manifest)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(remote.Manifest) error); ok {
+		r0 = rf(manifest)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ActiveNamespaces provides a mock function with given fields: dictionaries
+func (_m *Client) ActiveNamespaces(dictionaries []string) ([]string, error) {
+	ret := _m.Called(dictionaries)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func([]string) []string); ok {
+		r0 = rf(dictionaries)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]string) error); ok {
+		r1 = rf(dictionaries)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Checkpoint provides a mock function with given fields: dictionary
+func (_m *Client) Checkpoint(dictionary string) (remote.Checkpoint, bool, error) {
+	ret := _m.Called(dictionary)
+
+	var r0 remote.Checkpoint
+	if rf, ok := ret.Get(0).(func(string) remote.Checkpoint); ok {
+		r0 = rf(dictionary)
+	} else {
+		r0 = ret.Get(0).(remote.Checkpoint)
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(dictionary)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(dictionary)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// DeleteCheckpoint provides a mock function with given fields: dictionary
+func (_m *Client) DeleteCheckpoint(dictionary string) error {
+	ret := _m.Called(dictionary)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(dictionary)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteVersion provides a mock function with given fields: dictionary, version
+func (_m *Client) DeleteVersion(dictionary string, version string) error {
+	ret := _m.Called(dictionary, version)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(dictionary, version)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Manifests provides a mock function with given fields: dictionary
+func (_m *Client) Manifests(dictionary string) ([]remote.Manifest, string, error) {
+	ret := _m.Called(dictionary)
+
+	var r0 []remote.Manifest
+	if rf, ok := ret.Get(0).(func(string) []remote.Manifest); ok {
+		r0 = rf(dictionary)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]remote.Manifest)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(string) string); ok {
+		r1 = rf(dictionary)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(dictionary)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// NewGetPipeline provides a mock function with given fields: size, namespaces
+func (_m *Client) NewGetPipeline(size int, namespaces []string) remote.GetPipeline {
+	ret := _m.Called(size, namespaces)
 
 	var r0 remote.GetPipeline
-	if rf, ok := ret.Get(0).(func(int) remote.GetPipeline); ok {
-		r0 = rf(size)
+	if rf, ok := ret.Get(0).(func(int, []string) remote.GetPipeline); ok {
+		r0 = rf(size, namespaces)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(remote.GetPipeline)
@@ -44,6 +167,64 @@ func (_m *Client) NewSetPipeline(size int) remote.SetPipeline {
 	return r0
 }
 
+// NewVersion provides a mock function with given fields: dictionary
+func (_m *Client) NewVersion(dictionary string) (string, error) {
+	ret := _m.Called(dictionary)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(dictionary)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(dictionary)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PruneVersions provides a mock function with given fields: dictionary, keep
+func (_m *Client) PruneVersions(dictionary string, keep int) ([]string, error) {
+	ret := _m.Called(dictionary, keep)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string, int) []string); ok {
+		r0 = rf(dictionary, keep)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(dictionary, keep)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReadNamespace provides a mock function with given fields: namespace, onSynonym
+func (_m *Client) ReadNamespace(namespace string, onSynonym func(string, []string) error) error {
+	ret := _m.Called(namespace, onSynonym)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, func(string, []string) error) error); ok {
+		r0 = rf(namespace, onSynonym)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Ready provides a mock function with given fields:
 func (_m *Client) Ready() bool {
 	ret := _m.Called()
@@ -57,3 +238,52 @@ func (_m *Client) Ready() bool {
 
 	return r0
 }
+
+// Rollback provides a mock function with given fields: dictionary
+func (_m *Client) Rollback(dictionary string) (remote.Manifest, error) {
+	ret := _m.Called(dictionary)
+
+	var r0 remote.Manifest
+	if rf, ok := ret.Get(0).(func(string) remote.Manifest); ok {
+		r0 = rf(dictionary)
+	} else {
+		r0 = ret.Get(0).(remote.Manifest)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(dictionary)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveCheckpoint provides a mock function with given fields: checkpoint
+func (_m *Client) SaveCheckpoint(checkpoint remote.Checkpoint) error {
+	ret := _m.Called(checkpoint)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(remote.Checkpoint) error); ok {
+		r0 = rf(checkpoint)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateActive provides a mock function with given fields: manifest, update
+func (_m *Client) UpdateActive(manifest remote.Manifest, update func(remote.SetPipeline) error) error {
+	ret := _m.Called(manifest, update)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(remote.Manifest, func(remote.SetPipeline) error) error); ok {
+		r0 = rf(manifest, update)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
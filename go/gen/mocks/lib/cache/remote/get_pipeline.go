@@ -15,11 +15,11 @@ type GetPipeline struct {
 }
 
 // ExecGet provides a mock function with given fields: onResult
-func (_m *GetPipeline) ExecGet(onResult func(*pb.Snippet, *cache.Lookup) error) error {
+func (_m *GetPipeline) ExecGet(onResult func(*pb.Snippet, []*cache.Lookup) error) error {
 	ret := _m.Called(onResult)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(func(*pb.Snippet, *cache.Lookup) error) error); ok {
+	if rf, ok := ret.Get(0).(func(func(*pb.Snippet, []*cache.Lookup) error) error); ok {
 		r0 = rf(onResult)
 	} else {
 		r0 = ret.Error(0)
@@ -9,6 +9,11 @@ type SetPipeline struct {
 	mock.Mock
 }
 
+// Add provides a mock function with given fields: namespace, synonym, data
+func (_m *SetPipeline) Add(namespace string, synonym string, data []byte) {
+	_m.Called(namespace, synonym, data)
+}
+
 // ExecSet provides a mock function with given fields:
 func (_m *SetPipeline) ExecSet() error {
 	ret := _m.Called()
@@ -23,9 +28,9 @@ func (_m *SetPipeline) ExecSet() error {
 	return r0
 }
 
-// Set provides a mock function with given fields: key, data
-func (_m *SetPipeline) Set(key string, data []byte) {
-	_m.Called(key, data)
+// Remove provides a mock function with given fields: namespace, synonym, data
+func (_m *SetPipeline) Remove(namespace string, synonym string, data []byte) {
+	_m.Called(namespace, synonym, data)
 }
 
 // Size provides a mock function with given fields:
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 	lib "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 
@@ -32,13 +34,13 @@ func (_m *Client) Err() error {
 	return r0
 }
 
-// Recognise provides a mock function with given fields: _a0, _a1, _a2
-func (_m *Client) Recognise(_a0 <-chan snippet_reader.Value, _a1 *sync.WaitGroup, _a2 lib.HttpOptions) error {
-	ret := _m.Called(_a0, _a1, _a2)
+// Recognise provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Client) Recognise(_a0 context.Context, _a1 <-chan snippet_reader.Value, _a2 *sync.WaitGroup, _a3 lib.HttpOptions) error {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(<-chan snippet_reader.Value, *sync.WaitGroup, lib.HttpOptions) error); ok {
-		r0 = rf(_a0, _a1, _a2)
+	if rf, ok := ret.Get(0).(func(context.Context, <-chan snippet_reader.Value, *sync.WaitGroup, lib.HttpOptions) error); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -62,6 +64,11 @@ func (_m *Client) Result() []*pb.Entity {
 	return r0
 }
 
+// SetEntityCallback provides a mock function with given fields: _a0
+func (_m *Client) SetEntityCallback(_a0 func(*pb.Entity) error) {
+	_m.Called(_a0)
+}
+
 // SetExactMatch provides a mock function with given fields: _a0
 func (_m *Client) SetExactMatch(_a0 bool) {
 	_m.Called(_a0)
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+	ahocorasick provides a token-level Aho-Corasick automaton. Patterns are sequences of tokens (words) rather than
+	characters, so a document can be matched against every pattern in a single pass over its tokens.
+*/
+package ahocorasick
+
+// Automaton matches sequences of tokens against a set of patterns.
+// Patterns are added with Add, then Build must be called before matching. Once built, an Automaton is read-only and
+// safe for concurrent use: the state of each match is held in a State.
+type Automaton struct {
+	root      *node
+	maxLength int
+	built     bool
+}
+
+type node struct {
+	children map[string]*node
+	fail     *node // the node for the longest proper suffix of this node's path which is also a path in the trie
+	output   *node // the nearest node along the fail links which ends a pattern
+	depth    int   // the number of tokens in this node's path
+	value    interface{}
+	terminal bool // whether a pattern ends at this node
+}
+
+// Match is a pattern which ends at the token most recently passed to Next.
+type Match struct {
+	Length int // the number of tokens in the pattern
+	Value  interface{}
+}
+
+// State is the position of the automaton part of the way through a sequence of tokens. The zero State is invalid:
+// use Automaton.Start.
+type State struct {
+	node *node
+}
+
+func New() *Automaton {
+	return &Automaton{
+		root: newNode(0),
+	}
+}
+
+func newNode(depth int) *node {
+	return &node{
+		children: make(map[string]*node),
+		depth:    depth,
+	}
+}
+
+// Add adds a pattern to the automaton. If the pattern has already been added, its value is replaced.
+// Empty patterns are ignored. Add panics if the automaton has been built.
+func (a *Automaton) Add(tokens []string, value interface{}) {
+	if a.built {
+		panic("ahocorasick: Add called after Build")
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	current := a.root
+	for _, token := range tokens {
+		child, ok := current.children[token]
+		if !ok {
+			child = newNode(current.depth + 1)
+			current.children[token] = child
+		}
+		current = child
+	}
+	current.terminal = true
+	current.value = value
+
+	if len(tokens) > a.maxLength {
+		a.maxLength = len(tokens)
+	}
+}
+
+// Build computes the failure links of the automaton. It must be called once every pattern has been added.
+func (a *Automaton) Build() {
+	a.root.fail = a.root
+
+	// Breadth first, so that every node's fail link points to a node which has already been processed.
+	queue := make([]*node, 0, len(a.root.children))
+	for _, child := range a.root.children {
+		child.fail = a.root
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if current.fail.terminal {
+			current.output = current.fail
+		} else {
+			current.output = current.fail.output
+		}
+
+		for token, child := range current.children {
+			fail := current.fail
+			for fail != a.root && fail.children[token] == nil {
+				fail = fail.fail
+			}
+			if next, ok := fail.children[token]; ok && next != child {
+				child.fail = next
+			} else {
+				child.fail = a.root
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	a.built = true
+}
+
+// MaxLength returns the number of tokens in the longest pattern.
+func (a *Automaton) MaxLength() int {
+	return a.maxLength
+}
+
+// Start returns the state of the automaton before any tokens have been seen.
+func (a *Automaton) Start() State {
+	return State{node: a.root}
+}
+
+// Next moves the automaton on by a single token and returns the new state, along with every pattern which ends with
+// that token, longest first. Next panics if the automaton has not been built.
+func (a *Automaton) Next(state State, token string) (State, []Match) {
+	if !a.built {
+		panic("ahocorasick: Next called before Build")
+	}
+
+	current := state.node
+	for current != a.root && current.children[token] == nil {
+		current = current.fail
+	}
+	if next, ok := current.children[token]; ok {
+		current = next
+	}
+
+	var matches []Match
+	if current.terminal {
+		matches = append(matches, Match{Length: current.depth, Value: current.value})
+	}
+	for output := current.output; output != nil; output = output.output {
+		matches = append(matches, Match{Length: output.depth, Value: output.value})
+	}
+
+	return State{node: current}, matches
+}
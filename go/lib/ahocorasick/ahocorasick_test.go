@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ahocorasick
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// matchAll runs text through the automaton and returns the value of every match keyed by the index of the token
+// the match ends on.
+func matchAll(a *Automaton, text string) map[int][]interface{} {
+	res := make(map[int][]interface{})
+	state := a.Start()
+	for i, token := range strings.Fields(text) {
+		var matches []Match
+		state, matches = a.Next(state, token)
+		for _, match := range matches {
+			res[i] = append(res[i], match.Value)
+		}
+	}
+	return res
+}
+
+func TestAutomaton(t *testing.T) {
+	a := New()
+	a.Add([]string{"acetyl"}, "acetyl")
+	a.Add([]string{"acetyl", "carnitine"}, "acetyl carnitine")
+	a.Add([]string{"carnitine"}, "carnitine")
+	a.Add([]string{"l", "acetyl", "carnitine", "hcl"}, "l acetyl carnitine hcl")
+	a.Add([]string{"sodium", "chloride"}, "sodium chloride")
+	a.Add([]string{}, "empty")
+	a.Build()
+
+	assert.Equal(t, 4, a.MaxLength())
+
+	tests := []struct {
+		name string
+		text string
+		want map[int][]interface{}
+	}{
+		{
+			name: "no matches",
+			text: "nothing to see here",
+			want: map[int][]interface{}{},
+		},
+		{
+			name: "overlapping matches are all returned, longest first",
+			text: "some acetyl carnitine",
+			want: map[int][]interface{}{
+				1: {"acetyl"},
+				2: {"acetyl carnitine", "carnitine"},
+			},
+		},
+		{
+			name: "falls back along failure links",
+			text: "l acetyl carnitine sodium chloride",
+			want: map[int][]interface{}{
+				1: {"acetyl"},
+				2: {"acetyl carnitine", "carnitine"},
+				4: {"sodium chloride"},
+			},
+		},
+		{
+			name: "longest pattern",
+			text: "l acetyl carnitine hcl",
+			want: map[int][]interface{}{
+				1: {"acetyl"},
+				2: {"acetyl carnitine", "carnitine"},
+				3: {"l acetyl carnitine hcl"},
+			},
+		},
+		{
+			name: "partial match is abandoned",
+			text: "sodium sodium chloride",
+			want: map[int][]interface{}{
+				2: {"sodium chloride"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchAll(a, tt.text))
+		})
+	}
+}
+
+func TestAutomaton_Add_ReplacesValue(t *testing.T) {
+	a := New()
+	a.Add([]string{"calcium"}, "first")
+	a.Add([]string{"calcium"}, "second")
+	a.Build()
+
+	_, matches := a.Next(a.Start(), "calcium")
+	assert.Equal(t, []Match{{Length: 1, Value: "second"}}, matches)
+}
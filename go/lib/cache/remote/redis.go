@@ -16,6 +16,8 @@ package remote
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/go-redis/redis"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
@@ -34,31 +36,72 @@ func NewRedisClient(conf RedisConfig) Client {
 	}
 }
 
+// Key returns the redis key of synonym in the dictionary called namespace. Each key holds a set of JSON encoded
+// cache.Lookups, one for each entry the synonym belongs to, so that homonyms and other dictionaries don't overwrite
+// each other.
+func Key(namespace, synonym string) string {
+	return namespace + ":" + synonym
+}
+
 type redisClient struct {
 	*redis.Client
 }
 
 type redisGetPipeline struct {
-	pipeline redis.Pipeliner
-	cmds     map[*pb.Snippet]*redis.StringCmd
+	pipeline   redis.Pipeliner
+	namespaces []string
+	cmds       map[*pb.Snippet]*redis.StringSliceCmd
 }
 
 type redisSetPipeline struct {
 	pipeline redis.Pipeliner
-	cmds     map[string]*redis.StatusCmd
+	size     int
 }
 
-func (r *redisClient) NewGetPipeline(size int) GetPipeline {
+func (r *redisClient) NewGetPipeline(size int, namespaces []string) GetPipeline {
 	return &redisGetPipeline{
-		pipeline: r.Pipeline(),
-		cmds:     make(map[*pb.Snippet]*redis.StringCmd, size),
+		pipeline:   r.Pipeline(),
+		namespaces: namespaces,
+		cmds:       make(map[*pb.Snippet]*redis.StringSliceCmd, size),
 	}
 }
 
 func (r *redisClient) NewSetPipeline(size int) SetPipeline {
 	return &redisSetPipeline{
 		pipeline: r.Pipeline(),
-		cmds:     make(map[string]*redis.StatusCmd, size),
+	}
+}
+
+func (r *redisClient) ReadNamespace(namespace string, onSynonym func(synonym string, lookups []string) error) error {
+	prefix := Key(namespace, "")
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(cursor, prefix+"*", 1000).Result()
+		if err != nil {
+			return err
+		}
+
+		pipeline := r.Pipeline()
+		cmds := make([]*redis.StringSliceCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipeline.SMembers(key)
+		}
+		if len(keys) > 0 {
+			if _, err := pipeline.Exec(); err != nil {
+				return err
+			}
+		}
+
+		for i, key := range keys {
+			if err := onSynonym(strings.TrimPrefix(key, prefix), cmds[i].Val()); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
 	}
 }
 
@@ -66,9 +109,11 @@ func (r *redisClient) Ready() bool {
 	return r.Ping().Err() == nil
 }
 
-// Set adds (key, data) to the pipeline. It won't go to redis until you call ExecSet.
-func (r *redisSetPipeline) Set(key string, data []byte) {
-	r.cmds[key] = r.pipeline.Set(key, data, 0)
+// Add adds data to the lookups of synonym in the dictionary called namespace. It won't go to redis until you call
+// ExecSet. Adding the same data again has no effect.
+func (r *redisSetPipeline) Add(namespace, synonym string, data []byte) {
+	r.pipeline.SAdd(Key(namespace, synonym), data)
+	r.size++
 }
 
 // ExecSet empties the contents of the pipeline into redis.
@@ -77,19 +122,30 @@ func (r *redisSetPipeline) ExecSet() error {
 	return err
 }
 
+// Remove removes data from the lookups of synonym in the dictionary called namespace. It won't go to redis until you
+// call ExecSet. Once a synonym has no lookups it is no longer in the dictionary.
+func (r *redisSetPipeline) Remove(namespace, synonym string, data []byte) {
+	r.pipeline.SRem(Key(namespace, synonym), data)
+	r.size++
+}
+
 func (r *redisSetPipeline) Size() int {
-	return len(r.cmds)
+	return r.size
 }
 
-// Get queues a GET request from redis with token.GetNormalisedText() as the key. It won't be returned until
-// you call ExecGet!
+// Get queues a request for the lookups of token.GetNormalisedText() in every namespace of the pipeline. It won't be
+// returned until you call ExecGet!
 func (redisPipeline *redisGetPipeline) Get(token *pb.Snippet) {
-	redisPipeline.cmds[token] = redisPipeline.pipeline.Get(token.GetNormalisedText())
+	keys := make([]string, len(redisPipeline.namespaces))
+	for i, namespace := range redisPipeline.namespaces {
+		keys[i] = Key(namespace, token.GetNormalisedText())
+	}
+	redisPipeline.cmds[token] = redisPipeline.pipeline.SUnion(keys...)
 }
 
 // ExecGet retrieves values from redis based on the keys queued in the pipeline and executes
-// the callback for each.
-func (redisPipeline *redisGetPipeline) ExecGet(onResult func(*pb.Snippet, *cache.Lookup) error) error {
+// the callback for each. The lookups are nil if the token isn't in any of the namespaces.
+func (redisPipeline *redisGetPipeline) ExecGet(onResult func(*pb.Snippet, []*cache.Lookup) error) error {
 
 	_, err := redisPipeline.pipeline.Exec()
 	if err != nil && err != redis.Nil {
@@ -97,22 +153,23 @@ func (redisPipeline *redisGetPipeline) ExecGet(onResult func(*pb.Snippet, *cache
 	}
 
 	for key, cmd := range redisPipeline.cmds {
-		bytes, err := cmd.Bytes()
-		if err == redis.Nil {
-			if err = onResult(key, nil); err != nil {
-				return err
-			}
-			continue
-		} else if err != nil {
+		members, err := cmd.Result()
+		if err != nil && err != redis.Nil {
 			return err
 		}
 
-		var lookup cache.Lookup
-		if err = json.Unmarshal(bytes, &lookup); err != nil {
-			return err
+		// sets are unordered, so sort them to return homonyms in the same order every time.
+		sort.Strings(members)
+		var lookups []*cache.Lookup
+		for _, member := range members {
+			var lookup cache.Lookup
+			if err = json.Unmarshal([]byte(member), &lookup); err != nil {
+				return err
+			}
+			lookups = append(lookups, &lookup)
 		}
 
-		if err = onResult(key, &lookup); err != nil {
+		if err = onResult(key, lookups); err != nil {
 			return err
 		}
 	}
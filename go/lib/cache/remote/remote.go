@@ -19,9 +19,28 @@ import (
 )
 
 type Client interface {
-	NewGetPipeline(size int) GetPipeline
+	// NewGetPipeline returns a pipeline which looks tokens up in each of the dictionaries named by namespaces.
+	NewGetPipeline(size int, namespaces []string) GetPipeline
 	NewSetPipeline(size int) SetPipeline
+	// ReadNamespace calls onSynonym with the JSON encoded lookups of every synonym in namespace, in no particular order.
+	ReadNamespace(namespace string, onSynonym func(synonym string, lookups []string) error) error
 	Ready() bool
+	Versions
+}
+
+// Versions manages the versions of dictionaries. See Manifest.
+type Versions interface {
+	NewVersion(dictionary string) (string, error)
+	Activate(manifest Manifest) error
+	UpdateActive(manifest Manifest, update func(pipeline SetPipeline) error) error
+	Rollback(dictionary string) (Manifest, error)
+	Manifests(dictionary string) (manifests []Manifest, active string, err error)
+	DeleteVersion(dictionary, version string) error
+	PruneVersions(dictionary string, keep int) ([]string, error)
+	ActiveNamespaces(dictionaries []string) ([]string, error)
+	SaveCheckpoint(checkpoint Checkpoint) error
+	Checkpoint(dictionary string) (Checkpoint, bool, error)
+	DeleteCheckpoint(dictionary string) error
 }
 
 type Pipeline interface {
@@ -30,12 +49,13 @@ type Pipeline interface {
 
 type GetPipeline interface {
 	Get(token *pb.Snippet)
-	ExecGet(onResult func(*pb.Snippet, *cache.Lookup) error) error
+	ExecGet(onResult func(*pb.Snippet, []*cache.Lookup) error) error
 	Pipeline
 }
 
 type SetPipeline interface {
-	Set(key string, data []byte)
+	Add(namespace, synonym string, data []byte)
+	Remove(namespace, synonym string, data []byte)
 	ExecSet() error
 	Pipeline
 }
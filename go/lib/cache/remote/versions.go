@@ -0,0 +1,329 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Dictionaries are imported as versions, each in a namespace of its own, and a pointer to the active version is
+// swapped once a version has been completely imported. Readers follow the pointer, so they never see a half-imported
+// dictionary, and moving the pointer back rolls back to an earlier version.
+
+// Manifest records what was imported into a version of a dictionary.
+type Manifest struct {
+	Dictionary string    `json:"dictionary"`
+	Version    string    `json:"version"`
+	SourcePath string    `json:"sourcePath"`
+	Format     string    `json:"format"`
+	Entries    int       `json:"entries"`
+	Checksum   string    `json:"checksum"` // the SHA-256 of the source file, hex encoded
+	ImportedAt time.Time `json:"importedAt"`
+}
+
+// Checkpoint records how far an import into a version which hasn't been activated yet has got, so that it can be
+// resumed if it is interrupted. A dictionary has at most one checkpoint.
+type Checkpoint struct {
+	Dictionary  string    `json:"dictionary"`
+	Version     string    `json:"version"`
+	SourcePath  string    `json:"sourcePath"`
+	Format      string    `json:"format"`
+	Fingerprint string    `json:"fingerprint"` // identifies the source files, see dict.InputStat
+	Entries     int       `json:"entries"`     // the number of entries, from the start of the source, which have been imported
+	SavedAt     time.Time `json:"savedAt"`
+}
+
+// VersionNamespace returns the namespace which version of dictionary is imported into.
+func VersionNamespace(dictionary, version string) string {
+	return dictionary + "@" + version
+}
+
+// dictionaryKey returns the key of one of dictionary's version records. These are kept apart from the namespaces of
+// the dictionary's synonyms.
+func dictionaryKey(dictionary string, parts ...string) string {
+	key := "_dictionary:" + dictionary
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key
+}
+
+// NewVersion reserves a new version of dictionary to import into. It doesn't become active until it is activated.
+func (r *redisClient) NewVersion(dictionary string) (string, error) {
+	version, err := r.Incr(dictionaryKey(dictionary, "next-version")).Result()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(version, 10), nil
+}
+
+// Activate records manifest and makes its version the active version of its dictionary, in a single transaction. The
+// dictionary's checkpoint, which is no longer needed, is deleted.
+func (r *redisClient) Activate(manifest Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(dictionaryKey(manifest.Dictionary, "manifest", manifest.Version), data, 0)
+		pipe.LRem(dictionaryKey(manifest.Dictionary, "versions"), 0, manifest.Version)
+		pipe.RPush(dictionaryKey(manifest.Dictionary, "versions"), manifest.Version)
+		pipe.Set(dictionaryKey(manifest.Dictionary, "active"), manifest.Version, 0)
+		pipe.Del(dictionaryKey(manifest.Dictionary, "checkpoint"))
+		return nil
+	})
+	return err
+}
+
+// UpdateActive applies the changes which update queues to the active version of manifest.Dictionary and replaces the
+// version's manifest with manifest, in a single transaction, so readers see either all of the changes or none of them.
+// Nothing is changed if manifest.Version is not, or stops being, the active version before the transaction is executed.
+//
+// The changes are held in memory until they are executed, and redis executes them without serving any other requests.
+func (r *redisClient) UpdateActive(manifest Manifest, update func(pipeline SetPipeline) error) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	activeKey := dictionaryKey(manifest.Dictionary, "active")
+	return r.Watch(func(tx *redis.Tx) error {
+		active, err := tx.Get(activeKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if active != manifest.Version {
+			return fmt.Errorf("version %s of dictionary %s is not active", manifest.Version, manifest.Dictionary)
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if err := update(&redisSetPipeline{pipeline: pipe}); err != nil {
+				return err
+			}
+			pipe.Set(dictionaryKey(manifest.Dictionary, "manifest", manifest.Version), data, 0)
+			return nil
+		})
+		return err
+	}, activeKey)
+}
+
+// SaveCheckpoint replaces the checkpoint of its dictionary with checkpoint.
+func (r *redisClient) SaveCheckpoint(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return r.Set(dictionaryKey(checkpoint.Dictionary, "checkpoint"), data, 0).Err()
+}
+
+// Checkpoint returns the checkpoint of dictionary, if an import of it has been interrupted.
+func (r *redisClient) Checkpoint(dictionary string) (Checkpoint, bool, error) {
+	data, err := r.Get(dictionaryKey(dictionary, "checkpoint")).Bytes()
+	if err == redis.Nil {
+		return Checkpoint{}, false, nil
+	} else if err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	var checkpoint Checkpoint
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err == nil, err
+}
+
+// DeleteCheckpoint deletes the checkpoint of dictionary, but not the version it was importing into.
+func (r *redisClient) DeleteCheckpoint(dictionary string) error {
+	return r.Del(dictionaryKey(dictionary, "checkpoint")).Err()
+}
+
+// Rollback makes the version which was activated before the active version of dictionary active again, and returns
+// its manifest.
+func (r *redisClient) Rollback(dictionary string) (Manifest, error) {
+	versions, err := r.LRange(dictionaryKey(dictionary, "versions"), 0, -1).Result()
+	if err != nil {
+		return Manifest{}, err
+	}
+	active, err := r.activeVersion(dictionary)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	previous, ok := previousVersion(versions, active)
+	if !ok {
+		return Manifest{}, fmt.Errorf("dictionary %s has no version before %q to roll back to", dictionary, active)
+	}
+	manifest, err := r.manifest(dictionary, previous)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return manifest, r.Set(dictionaryKey(dictionary, "active"), previous, 0).Err()
+}
+
+// Manifests returns the manifests of every version of dictionary which has been activated and not deleted, oldest
+// first, and the active version.
+func (r *redisClient) Manifests(dictionary string) (manifests []Manifest, active string, err error) {
+	versions, err := r.LRange(dictionaryKey(dictionary, "versions"), 0, -1).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, version := range versions {
+		manifest, err := r.manifest(dictionary, version)
+		if err != nil {
+			return nil, "", err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	active, err = r.activeVersion(dictionary)
+	return manifests, active, err
+}
+
+// DeleteVersion deletes version of dictionary and its manifest. The active version can't be deleted.
+func (r *redisClient) DeleteVersion(dictionary, version string) error {
+	active, err := r.activeVersion(dictionary)
+	if err != nil {
+		return err
+	}
+	if version == active {
+		return fmt.Errorf("version %s of dictionary %s is active and can't be deleted", version, dictionary)
+	}
+
+	match := Key(VersionNamespace(dictionary, version), "*")
+	var cursor uint64
+	for {
+		var keys []string
+		keys, cursor, err = r.Scan(cursor, match, 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := r.Unlink(keys...).Err(); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	_, err = r.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LRem(dictionaryKey(dictionary, "versions"), 0, version)
+		pipe.Del(dictionaryKey(dictionary, "manifest", version))
+		return nil
+	})
+	return err
+}
+
+// PruneVersions deletes all but the newest keep versions of dictionary, not counting the active version, which is
+// always kept. It returns the versions which were deleted.
+func (r *redisClient) PruneVersions(dictionary string, keep int) ([]string, error) {
+	versions, err := r.LRange(dictionaryKey(dictionary, "versions"), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	active, err := r.activeVersion(dictionary)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := expiredVersions(versions, active, keep)
+	for _, version := range expired {
+		if err := r.DeleteVersion(dictionary, version); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
+
+// ActiveNamespaces returns the namespace of the active version of each dictionary. Dictionaries which have no active
+// version are returned as they are, so dictionaries imported before versioning can still be read.
+func (r *redisClient) ActiveNamespaces(dictionaries []string) ([]string, error) {
+	if len(dictionaries) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(dictionaries))
+	for i, dictionary := range dictionaries {
+		keys[i] = dictionaryKey(dictionary, "active")
+	}
+	versions, err := r.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]string, len(dictionaries))
+	for i, dictionary := range dictionaries {
+		if version, ok := versions[i].(string); ok {
+			namespaces[i] = VersionNamespace(dictionary, version)
+		} else {
+			namespaces[i] = dictionary
+		}
+	}
+	return namespaces, nil
+}
+
+// activeVersion returns the active version of dictionary, or "" if it has none.
+func (r *redisClient) activeVersion(dictionary string) (string, error) {
+	version, err := r.Get(dictionaryKey(dictionary, "active")).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return version, err
+}
+
+func (r *redisClient) manifest(dictionary, version string) (Manifest, error) {
+	data, err := r.Get(dictionaryKey(dictionary, "manifest", version)).Bytes()
+	if err == redis.Nil {
+		return Manifest{}, fmt.Errorf("version %s of dictionary %s has no manifest", version, dictionary)
+	} else if err != nil {
+		return Manifest{}, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// previousVersion returns the version activated before active, given versions in the order they were activated.
+func previousVersion(versions []string, active string) (string, bool) {
+	for i, version := range versions {
+		if version == active && i > 0 {
+			return versions[i-1], true
+		}
+	}
+	return "", false
+}
+
+// expiredVersions returns the versions, in the order they were activated, which aren't active or among the newest
+// keep others.
+func expiredVersions(versions []string, active string, keep int) []string {
+	var expired []string
+	kept := 0
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] == active {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		expired = append([]string{versions[i]}, expired...)
+	}
+	return expired
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_previousVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		active   string
+		want     string
+		wantOk   bool
+	}{
+		{name: "newest is active", versions: []string{"1", "2", "3"}, active: "3", want: "2", wantOk: true},
+		{name: "already rolled back", versions: []string{"1", "2", "3"}, active: "2", want: "1", wantOk: true},
+		{name: "oldest is active", versions: []string{"1", "2"}, active: "1", wantOk: false},
+		{name: "no active version", versions: []string{"1", "2"}, active: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := previousVersion(tt.versions, tt.active)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_expiredVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		active   string
+		keep     int
+		want     []string
+	}{
+		{name: "keep one previous version", versions: []string{"1", "2", "3", "4"}, active: "4", keep: 1, want: []string{"1", "2"}},
+		{name: "keep none", versions: []string{"1", "2", "3"}, active: "3", keep: 0, want: []string{"1", "2"}},
+		{name: "active version is never expired", versions: []string{"1", "2", "3", "4"}, active: "1", keep: 1, want: []string{"2", "3"}},
+		{name: "nothing to expire", versions: []string{"1", "2"}, active: "2", keep: 1, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, expiredVersions(tt.versions, tt.active, tt.keep))
+		})
+	}
+}
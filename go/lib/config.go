@@ -101,8 +101,27 @@ func InitializeConfig(defaultPath string, defaultConfig map[string]interface{},
 		return err
 	}
 
+	return unmarshalConfig(targetStruct)
+}
+
+// ReloadConfig re-reads the config file which InitializeConfig read, e.g. when it has been edited, into targetStruct.
+// targetStruct should be a pointer to a new struct rather than to the config in use, which is then left as it was if
+// the file can't be read. InitializeConfig must have been called first.
+func ReloadConfig(targetStruct interface{}) error {
+	err := viper.ReadInConfig()
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		log.Warn().Err(err).Msg("default settings applied")
+	} else if err != nil {
+		return err
+	}
+
+	return unmarshalConfig(targetStruct)
+}
+
+// unmarshalConfig sets the log level and unmarshals the config which viper has read into targetStruct.
+func unmarshalConfig(targetStruct interface{}) error {
 	var bc BaseConfig
-	err = viper.Unmarshal(&bc)
+	err := viper.Unmarshal(&bc)
 	if err != nil {
 		return err
 	}
@@ -111,12 +130,12 @@ func InitializeConfig(defaultPath string, defaultConfig map[string]interface{},
 	if err != nil {
 		return err
 	}
-	zerolog.SetGlobalLevel(lvl)
 
 	// unmarshal config into struct
 	if err := viper.Unmarshal(targetStruct); err != nil {
 		return err
 	}
 
+	zerolog.SetGlobalLevel(lvl)
 	return nil
 }
@@ -124,6 +124,36 @@ func TestInitializeConfigWithFlag(t *testing.T) {
 	os.Remove(filename)
 }
 
+func TestReloadConfig(t *testing.T) {
+	resetFlags()
+
+	type reloadConfig struct {
+		ReloadKey string
+	}
+	filename, err := createConfigFile(map[string]interface{}{"reloadkey": "before"}, ".", "*.yml")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(filename)
+
+	var parsedConfig reloadConfig
+	err = InitializeConfig(filename, map[string]interface{}{}, &parsedConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "before", parsedConfig.ReloadKey)
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("reloadkey: after\n"), 0))
+	var reloadedConfig reloadConfig
+	err = ReloadConfig(&reloadedConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "after", reloadedConfig.ReloadKey)
+
+	// an invalid file is an error, and the config which was in use is untouched.
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("reloadkey: [unclosed\n"), 0))
+	err = ReloadConfig(&reloadedConfig)
+	assert.Error(t, err)
+	assert.Equal(t, "before", parsedConfig.ReloadKey)
+}
+
 func createConfigFile(configMap map[string]interface{}, path, name string) (fileName string, err error) {
 	file, err := ioutil.TempFile(path, name)
 	if err != nil {
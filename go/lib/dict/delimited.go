@@ -0,0 +1,316 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DelimitedOptions configures how csv and tsv dictionaries are read.
+type DelimitedOptions struct {
+	// Delimiter separates the columns. It defaults to "," for csv and a tab for tsv.
+	Delimiter string
+	// Quotes is how quoted cells are read: "csv" (RFC 4180, the default for csv), "lazy" (RFC 4180, but quotes can
+	// appear in unquoted cells) or "none" (quotes are part of the text, the default for tsv).
+	Quotes string
+	// Header is whether the first row names the columns.
+	Header bool
+	// Comment is the prefix of rows to skip, e.g. "#".
+	Comment string
+	// Columns are the columns to import. Other columns are ignored.
+	Columns []DelimitedColumn
+}
+
+// DelimitedColumn says what the values in a column of a csv or tsv dictionary are.
+type DelimitedColumn struct {
+	// Name is the name of the column in the header. Either Name or Number is required.
+	Name string
+	// Number is the 1-based position of the column.
+	Number int
+	// Role is what the column's values are: "synonym", "identifier" or "metadata".
+	Role string
+	// Key is the key of an identifier or metadata column. A metadata column's key defaults to its name in the header.
+	// If an identifier column has no key, each value is the key of an identifier with no value, as in leadmine
+	// dictionaries.
+	Key string
+	// Separator splits a cell into several values, e.g. "|" for "aspirin|ASA". Several identifiers with a key are
+	// joined with ", ", as in swissprot dictionaries, and several metadata values are a list.
+	Separator string
+}
+
+const (
+	synonymColumn    = "synonym"
+	identifierColumn = "identifier"
+	metadataColumn   = "metadata"
+)
+
+const (
+	csvQuotes  = "csv"
+	lazyQuotes = "lazy"
+	noQuotes   = "none"
+)
+
+// NewDelimitedReader returns a reader for csv and tsv dictionaries whose columns are described by options.
+func NewDelimitedReader(format Format, options DelimitedOptions, maxLineSize int) (Reader, error) {
+	if options.Delimiter == "" {
+		options.Delimiter = ","
+		if format == TSVDictionaryFormat {
+			options.Delimiter = "\t"
+		}
+	}
+	if options.Quotes == "" {
+		options.Quotes = csvQuotes
+		if format == TSVDictionaryFormat {
+			options.Quotes = noQuotes
+		}
+	}
+
+	switch options.Quotes {
+	case csvQuotes, lazyQuotes:
+		if utf8.RuneCountInString(options.Delimiter) != 1 {
+			return nil, fmt.Errorf("the delimiter of quoted %s dictionaries must be a single character, not %q", format, options.Delimiter)
+		}
+	case noQuotes:
+	default:
+		return nil, fmt.Errorf("unsupported quotes %q, expected %s, %s or %s", options.Quotes, csvQuotes, lazyQuotes, noQuotes)
+	}
+
+	hasSynonyms := false
+	for _, column := range options.Columns {
+		switch {
+		case column.Name == "" && column.Number < 1:
+			return nil, fmt.Errorf("%s dictionary columns need a name or a number", format)
+		case column.Name != "" && !options.Header:
+			return nil, fmt.Errorf("column %q is named, but the %s dictionary has no header", column.Name, format)
+		case column.Role == metadataColumn && column.Key == "" && !options.Header:
+			return nil, fmt.Errorf("metadata column %d needs a key", column.Number)
+		}
+		switch column.Role {
+		case synonymColumn:
+			hasSynonyms = true
+		case identifierColumn, metadataColumn:
+		default:
+			return nil, fmt.Errorf("unsupported column role %q, expected %s, %s or %s", column.Role, synonymColumn, identifierColumn, metadataColumn)
+		}
+	}
+	if !hasSynonyms {
+		return nil, fmt.Errorf("%s dictionaries need at least one synonym column", format)
+	}
+
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return delimitedReader{options: options, maxLineSize: maxLineSize}, nil
+}
+
+type delimitedReader struct {
+	options     DelimitedOptions
+	maxLineSize int
+}
+
+func (d delimitedReader) Read(file io.Reader) (chan Entry, chan error) {
+	entries := make(chan Entry)
+	errors := make(chan error)
+	go d.read(file, entries, errors)
+	return entries, errors
+}
+
+// recordReader reads the cells of each row.
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// splitReader reads rows which are split on a delimiter, without quotes.
+type splitReader struct {
+	scanner   *lineScanner
+	delimiter string
+}
+
+func (s splitReader) Read() ([]string, error) {
+	for s.scanner.Scan() {
+		if line := s.scanner.Text(); line != "" {
+			return strings.Split(line, s.delimiter), nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// records returns a reader of the rows of dict. Rows which can't be read, e.g. because of a bare quote or because they
+// are too long, are sent to errors.
+func (d delimitedReader) records(dict io.Reader, errors chan error) recordReader {
+	if d.options.Quotes == noQuotes {
+		return splitReader{scanner: newLineScanner(dict, d.maxLineSize, errors), delimiter: d.options.Delimiter}
+	}
+	r := csv.NewReader(dict)
+	r.Comma, _ = utf8.DecodeRuneInString(d.options.Delimiter)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = d.options.Quotes == lazyQuotes
+	r.ReuseRecord = true
+	return r
+}
+
+func (d delimitedReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	records := d.records(dict, errors)
+	columns := d.options.Columns
+	needHeader := d.options.Header
+
+	for row := 1; ; row++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		} else if parseErr, ok := err.(*csv.ParseError); ok {
+			errors <- RowError{File: inputName(dict), Row: parseErr.Line, Err: parseErr.Err}
+			continue
+		} else if err != nil {
+			// the line scanner has already tagged its errors
+			if d.options.Quotes != noQuotes {
+				err = fileError(dict, err)
+			}
+			errors <- err
+			return
+		}
+
+		if d.options.Quotes != noQuotes && recordSize(record) > d.maxLineSize {
+			errors <- RowError{File: inputName(dict), Row: row, Err: ErrLineTooLong}
+			continue
+		}
+
+		// skip comments
+		if d.options.Comment != "" && len(record) > 0 && strings.HasPrefix(record[0], d.options.Comment) {
+			continue
+		}
+
+		// the first row which isn't a comment is the header
+		if needHeader {
+			if columns, err = headerColumns(record, columns); err != nil {
+				errors <- err
+				return
+			}
+			needHeader = false
+			continue
+		}
+
+		if entry := rowEntry(record, columns); entry != nil {
+			entries <- entry
+		}
+	}
+	errors <- nil
+}
+
+// recordSize returns the number of bytes in the cells of record.
+func recordSize(record []string) int {
+	size := 0
+	for _, cell := range record {
+		size += len(cell)
+	}
+	return size
+}
+
+// headerColumns returns columns with the numbers and default keys of the named columns in header.
+func headerColumns(header []string, columns []DelimitedColumn) ([]DelimitedColumn, error) {
+	numbers := make(map[string]int, len(header))
+	for i, name := range header {
+		numbers[strings.TrimSpace(name)] = i + 1
+	}
+
+	numbered := make([]DelimitedColumn, len(columns))
+	for i, column := range columns {
+		if column.Name != "" {
+			number, ok := numbers[column.Name]
+			if !ok {
+				return nil, fmt.Errorf("the header has no column %q", column.Name)
+			}
+			column.Number = number
+		} else if column.Number <= len(header) {
+			column.Name = strings.TrimSpace(header[column.Number-1])
+		}
+		numbered[i] = column
+	}
+	return numbered, nil
+}
+
+// rowEntry returns the entry in record, or nil if it has no synonyms.
+func rowEntry(record []string, columns []DelimitedColumn) Entry {
+	entry := &NerEntry{
+		Identifiers: make(map[string]string),
+		Metadata:    make(map[string]interface{}),
+	}
+
+	for _, column := range columns {
+		values := columnValues(record, column)
+		if len(values) == 0 {
+			continue
+		}
+
+		switch column.Role {
+		case synonymColumn:
+			entry.Synonyms = append(entry.Synonyms, values...)
+		case identifierColumn:
+			if column.Key == "" {
+				for _, value := range values {
+					entry.Identifiers[value] = ""
+				}
+			} else {
+				entry.Identifiers[column.Key] = strings.Join(values, ", ")
+			}
+		case metadataColumn:
+			key := column.Key
+			if key == "" {
+				key = column.Name
+			}
+			if key == "" {
+				key = "column " + strconv.Itoa(column.Number)
+			}
+			if column.Separator != "" {
+				entry.Metadata[key] = values
+			} else {
+				entry.Metadata[key] = values[0]
+			}
+		}
+	}
+
+	if len(entry.Synonyms) == 0 {
+		return nil
+	}
+	return entry
+}
+
+// columnValues returns the non-empty values in column of record.
+func columnValues(record []string, column DelimitedColumn) []string {
+	if column.Number > len(record) {
+		return nil
+	}
+	cell := record[column.Number-1]
+
+	cells := []string{cell}
+	if column.Separator != "" {
+		cells = strings.Split(cell, column.Separator)
+	}
+
+	var values []string
+	for _, value := range cells {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
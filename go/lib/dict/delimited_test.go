@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_delimitedReader_CSV(t *testing.T) {
+	options := DelimitedOptions{
+		Header:  true,
+		Comment: "#",
+		Columns: []DelimitedColumn{
+			{Name: "Name", Role: synonymColumn},
+			{Name: "Synonyms", Role: synonymColumn, Separator: ";"},
+			{Name: "ChEMBL ID", Role: identifierColumn},
+			{Name: "CAS", Role: identifierColumn, Key: "cas"},
+			{Name: "Targets", Role: metadataColumn, Key: "targets", Separator: ";"},
+			{Number: 6, Role: metadataColumn},
+		},
+	}
+	entries := readEntries(t, "compounds.csv", DictConfig{Format: CSVDictionaryFormat, Delimited: options})
+
+	assert.Equal(t, []Entry{
+		&NerEntry{
+			Synonyms:    []string{"Aspirin", "acetylsalicylic acid", "ASA"},
+			Identifiers: map[string]string{"CHEMBL25": "", "cas": "50-78-2"},
+			Metadata:    map[string]interface{}{"targets": []string{"PTGS1", "PTGS2"}, "Notes": "analgesic, antipyretic"},
+		},
+		&NerEntry{
+			Synonyms:    []string{"Paracetamol", "acetaminophen", `"APAP"`},
+			Identifiers: map[string]string{"CHEMBL112": "", "cas": "103-90-2"},
+			Metadata:    map[string]interface{}{},
+		},
+	}, entries)
+}
+
+func Test_delimitedReader_TSV(t *testing.T) {
+	options := DelimitedOptions{
+		Comment: "#",
+		Columns: []DelimitedColumn{
+			{Number: 1, Role: synonymColumn},
+			{Number: 2, Role: synonymColumn, Separator: "|"},
+			{Number: 3, Role: identifierColumn, Key: "chebi"},
+		},
+	}
+	entries := readEntries(t, "compounds.tsv", DictConfig{Format: TSVDictionaryFormat, Delimited: options})
+
+	assert.Equal(t, []Entry{
+		&NerEntry{
+			Synonyms:    []string{"aspirin", "ASA", "acetylsalicylic acid"},
+			Identifiers: map[string]string{"chebi": "CHEBI:15365"},
+			Metadata:    map[string]interface{}{},
+		},
+		&NerEntry{
+			Synonyms:    []string{"water", `"aqua"`},
+			Identifiers: map[string]string{"chebi": "CHEBI:15377"},
+			Metadata:    map[string]interface{}{},
+		},
+	}, entries)
+}
+
+func Test_NewDelimitedReader(t *testing.T) {
+	synonyms := DelimitedColumn{Number: 1, Role: synonymColumn}
+	tests := []struct {
+		name    string
+		format  Format
+		options DelimitedOptions
+		wantErr bool
+	}{
+		{name: "valid", format: CSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{synonyms}}},
+		{name: "no synonyms", format: CSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{{Number: 1, Role: identifierColumn}}}, wantErr: true},
+		{name: "unknown role", format: CSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{synonyms, {Number: 2, Role: "other"}}}, wantErr: true},
+		{name: "no name or number", format: CSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{{Role: synonymColumn}}}, wantErr: true},
+		{name: "named without a header", format: CSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{{Name: "synonym", Role: synonymColumn}}}, wantErr: true},
+		{name: "metadata without a key", format: TSVDictionaryFormat, options: DelimitedOptions{Columns: []DelimitedColumn{synonyms, {Number: 2, Role: metadataColumn}}}, wantErr: true},
+		{name: "quoted with a long delimiter", format: CSVDictionaryFormat, options: DelimitedOptions{Delimiter: "||", Columns: []DelimitedColumn{synonyms}}, wantErr: true},
+		{name: "unquoted with a long delimiter", format: CSVDictionaryFormat, options: DelimitedOptions{Delimiter: "||", Quotes: noQuotes, Columns: []DelimitedColumn{synonyms}}},
+		{name: "unknown quotes", format: TSVDictionaryFormat, options: DelimitedOptions{Quotes: "double", Columns: []DelimitedColumn{synonyms}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDelimitedReader(tt.format, tt.options, 0)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
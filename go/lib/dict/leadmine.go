@@ -14,31 +14,33 @@
 package dict
 
 import (
-	"bufio"
-	"os"
+	"errors"
+	"io"
 	"strings"
 )
 
-func NewLeadmineReader() Reader {
-	return leadmineReader{}
+func NewLeadmineReader(maxLineSize int) Reader {
+	return leadmineReader{maxLineSize: maxLineSize}
 }
 
-type leadmineReader struct{}
+type leadmineReader struct {
+	maxLineSize int
+}
 
-func (l leadmineReader) Read(dict *os.File) (chan Entry, chan error) {
+func (l leadmineReader) Read(dict io.Reader) (chan Entry, chan error) {
 	entries := make(chan Entry)
 	errors := make(chan error)
 	go l.read(dict, entries, errors)
 	return entries, errors
 }
 
-func (l leadmineReader) read(dict *os.File, entries chan Entry, errors chan error) {
+var errNoLeadmineSynonyms = errors.New("expected synonyms and an identifier separated by tabs")
 
-	// Instantiate variables we need to keep track of across lines.
-	scn := bufio.NewScanner(dict)
+func (l leadmineReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	scanner := newLineScanner(dict, l.maxLineSize, errors)
 
-	for scn.Scan() {
-		line := scn.Text()
+	for scanner.Scan() {
+		line := scanner.Text()
 
 		// skip empty lines and commented out lines.
 		if len(line) == 0 || line[0] == '#' {
@@ -46,6 +48,10 @@ func (l leadmineReader) read(dict *os.File, entries chan Entry, errors chan erro
 		}
 
 		row := strings.Split(line, "\t")
+		if len(row) < 2 {
+			scanner.rowError(errNoLeadmineSynonyms)
+			continue
+		}
 
 		// The identifier is the last entry, other entries are synonyms.
 		identifier := row[len(row)-1]
@@ -57,5 +63,5 @@ func (l leadmineReader) read(dict *os.File, entries chan Entry, errors chan erro
 			Identifiers: map[string]string{identifier: ""},
 		}
 	}
-	errors <- nil
+	errors <- scanner.Err()
 }
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+func NewMeSHReader() Reader {
+	return meshReader{}
+}
+
+type meshReader struct{}
+
+// meshDescriptor is what we keep of a DescriptorRecord in MeSH descriptor XML (desc20XX.xml).
+type meshDescriptor struct {
+	UI          string        `xml:"DescriptorUI"`
+	Name        string        `xml:"DescriptorName>String"`
+	TreeNumbers []string      `xml:"TreeNumberList>TreeNumber"`
+	Concepts    []meshConcept `xml:"ConceptList>Concept"`
+}
+
+type meshConcept struct {
+	Terms []string `xml:"TermList>Term>String"`
+}
+
+func (m meshReader) Read(file io.Reader) (chan Entry, chan error) {
+	entries := make(chan Entry)
+	errors := make(chan error)
+	go m.read(file, entries, errors)
+	return entries, errors
+}
+
+// read decodes one DescriptorRecord at a time, so the whole file is never held in memory.
+func (m meshReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	d := xml.NewDecoder(dict)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errors <- fileError(dict, err)
+			return
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "DescriptorRecord" {
+			continue
+		}
+		var descriptor meshDescriptor
+		if err := d.DecodeElement(&descriptor, &start); err != nil {
+			errors <- fileError(dict, err)
+			return
+		}
+		if entry := descriptor.entry(); entry != nil {
+			entries <- entry
+		}
+	}
+	errors <- nil
+}
+
+// entry converts the descriptor to an entry whose synonyms are the descriptor's name and the terms of each of its
+// concepts, and whose identifiers are its UI and tree numbers.
+func (descriptor meshDescriptor) entry() Entry {
+	if descriptor.UI == "" {
+		return nil
+	}
+
+	entry := &NerEntry{
+		Identifiers: map[string]string{descriptor.UI: ""},
+		Metadata:    map[string]interface{}{"id": descriptor.UI, "name": descriptor.Name},
+	}
+	for _, treeNumber := range descriptor.TreeNumbers {
+		entry.Identifiers[treeNumber] = ""
+	}
+
+	seen := make(map[string]bool)
+	addSynonym := func(synonym string) {
+		if synonym != "" && !seen[synonym] {
+			seen[synonym] = true
+			entry.Synonyms = append(entry.Synonyms, synonym)
+		}
+	}
+	addSynonym(descriptor.Name)
+	for _, concept := range descriptor.Concepts {
+		for _, term := range concept.Terms {
+			addSynonym(term)
+		}
+	}
+	if len(entry.Synonyms) == 0 {
+		return nil
+	}
+	return entry
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_meshReader(t *testing.T) {
+	entries := readEntries(t, "mesh-descriptors.xml", DictConfig{Format: MeSHDictionaryFormat})
+
+	assert.Equal(t, []Entry{
+		&NerEntry{
+			Synonyms:    []string{"Acetaminophen", "Paracetamol", "Tylenol"},
+			Identifiers: map[string]string{"D000082": "", "D02.065.199.092.040": "", "D02.241.223.100.140": ""},
+			Metadata:    map[string]interface{}{"id": "D000082", "name": "Acetaminophen"},
+		},
+		&NerEntry{
+			Synonyms:    []string{"Asthma", "Asthma, Bronchial", "Bronchial Asthma"},
+			Identifiers: map[string]string{"D001249": "", "C08.127.108": ""},
+			Metadata:    map[string]interface{}{"id": "D001249", "name": "Asthma"},
+		},
+	}, entries)
+}
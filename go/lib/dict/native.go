@@ -14,32 +14,37 @@
 package dict
 
 import (
-	"bufio"
 	"encoding/json"
-	"os"
+	"io"
 )
 
-func NewNativeReader() Reader {
-	return nativeReader{}
+func NewNativeReader(maxLineSize int) Reader {
+	return nativeReader{maxLineSize: maxLineSize}
 }
 
-type nativeReader struct{}
+type nativeReader struct {
+	maxLineSize int
+}
 
-func (p nativeReader) Read(file *os.File) (chan Entry, chan error) {
+func (p nativeReader) Read(file io.Reader) (chan Entry, chan error) {
 	entries := make(chan Entry)
 	errors := make(chan error)
 	go p.read(file, entries, errors)
 	return entries, errors
 }
 
-func (p nativeReader) read(dict *os.File, entries chan Entry, errors chan error) {
-	scn := bufio.NewScanner(dict)
-	for scn.Scan() {
+func (p nativeReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	scanner := newLineScanner(dict, p.maxLineSize, errors)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
 		var e NerEntry
-		if err := json.Unmarshal(scn.Bytes(), &e); err != nil {
-			errors <- err
-			return
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			scanner.rowError(err)
+			continue
 		}
 		entries <- &e
 	}
+	errors <- scanner.Err()
 }
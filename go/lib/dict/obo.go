@@ -0,0 +1,264 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OboOptions configures how OBO ontologies are read.
+type OboOptions struct {
+	// SynonymScopes are the scopes (EXACT, RELATED, NARROW or BROAD) of the synonyms to import. Every synonym is imported
+	// if it is empty. A term's name is always imported.
+	SynonymScopes []string `mapstructure:"synonym_scopes"`
+	// IncludeObsolete imports obsolete terms, flagged as obsolete in their metadata, instead of skipping them.
+	IncludeObsolete bool `mapstructure:"include_obsolete"`
+}
+
+// oboSynonymTags maps the tags which hold synonyms to their default scope. The scoped tags are from OBO 1.0.
+var oboSynonymTags = map[string]string{
+	"synonym":         "RELATED",
+	"exact_synonym":   "EXACT",
+	"related_synonym": "RELATED",
+	"narrow_synonym":  "NARROW",
+	"broad_synonym":   "BROAD",
+}
+
+var oboScopes = map[string]struct{}{
+	"EXACT":   {},
+	"RELATED": {},
+	"NARROW":  {},
+	"BROAD":   {},
+}
+
+func NewOboReader(options OboOptions, maxLineSize int) Reader {
+	return oboReader{options: options, maxLineSize: maxLineSize}
+}
+
+type oboReader struct {
+	options     OboOptions
+	maxLineSize int
+}
+
+// oboTerm is what we keep of a [Term] stanza.
+type oboTerm struct {
+	id       string
+	name     string
+	synonyms []oboSynonym
+	xrefs    []string
+	obsolete bool
+}
+
+type oboSynonym struct {
+	text  string
+	scope string
+}
+
+func (o oboReader) Read(file io.Reader) (chan Entry, chan error) {
+	entries := make(chan Entry)
+	errors := make(chan error)
+	go o.read(file, entries, errors)
+	return entries, errors
+}
+
+// read sends an entry for each [Term] stanza. The header and other stanzas, e.g. [Typedef], are skipped.
+func (o oboReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	scanner := newLineScanner(dict, o.maxLineSize, errors)
+
+	var term *oboTerm
+	sendTerm := func() {
+		if term != nil {
+			if entry := o.entry(term); entry != nil {
+				entries <- entry
+			}
+		}
+		term = nil
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// skip empty lines and comments.
+		if len(line) == 0 || line[0] == '!' {
+			continue
+		}
+
+		if line[0] == '[' {
+			sendTerm()
+			if line == "[Term]" {
+				term = &oboTerm{}
+			}
+			continue
+		}
+		if term == nil {
+			continue
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			scanner.rowError(fmt.Errorf("expected a tag and value, got %q", line))
+			continue
+		}
+		tag, value := line[:colon], strings.TrimSpace(line[colon+1:])
+
+		switch tag {
+		case "id":
+			term.id = oboValue(value)
+		case "name":
+			term.name = oboValue(value)
+		case "xref":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				term.xrefs = append(term.xrefs, fields[0])
+			}
+		case "is_obsolete":
+			term.obsolete = oboValue(value) == "true"
+		default:
+			if defaultScope, ok := oboSynonymTags[tag]; ok {
+				synonym, err := parseOboSynonym(value, defaultScope)
+				if err != nil {
+					scanner.rowError(err)
+					continue
+				}
+				term.synonyms = append(term.synonyms, synonym)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errors <- err
+		return
+	}
+	sendTerm()
+	errors <- nil
+}
+
+// entry converts term to an entry, or returns nil if it should be skipped. The term ID and xrefs are its identifiers,
+// and the scope of each synonym is kept in its metadata.
+func (o oboReader) entry(term *oboTerm) Entry {
+	if term.id == "" || (term.obsolete && !o.options.IncludeObsolete) {
+		return nil
+	}
+
+	entry := &NerEntry{
+		Identifiers: map[string]string{term.id: ""},
+		Metadata:    map[string]interface{}{"id": term.id},
+	}
+	for _, xref := range term.xrefs {
+		entry.Identifiers[xref] = ""
+	}
+
+	scopes := make(map[string]string)
+	addSynonym := func(synonym oboSynonym) {
+		if _, ok := scopes[synonym.text]; ok || synonym.text == "" {
+			return
+		}
+		scopes[synonym.text] = synonym.scope
+		entry.Synonyms = append(entry.Synonyms, synonym.text)
+	}
+
+	if term.name != "" {
+		entry.Metadata["name"] = term.name
+		addSynonym(oboSynonym{text: term.name, scope: "EXACT"})
+	}
+	for _, synonym := range term.synonyms {
+		if o.importScope(synonym.scope) {
+			addSynonym(synonym)
+		}
+	}
+	if len(entry.Synonyms) == 0 {
+		return nil
+	}
+
+	entry.Metadata["synonym_scopes"] = scopes
+	if term.obsolete {
+		entry.Metadata["obsolete"] = true
+	}
+	return entry
+}
+
+func (o oboReader) importScope(scope string) bool {
+	if len(o.options.SynonymScopes) == 0 {
+		return true
+	}
+	for _, s := range o.options.SynonymScopes {
+		if strings.EqualFold(s, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOboSynonym parses the value of a synonym tag, e.g. `"dihydrogen oxide" EXACT IUPAC_NAME [ChEBI:]`. Only the
+// quoted text and the scope are kept.
+func parseOboSynonym(value, defaultScope string) (oboSynonym, error) {
+	if !strings.HasPrefix(value, `"`) {
+		return oboSynonym{}, fmt.Errorf("synonym is not quoted: %q", value)
+	}
+
+	var text strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			if i+1 < len(value) {
+				i++
+				text.WriteString(oboUnescape(value[i]))
+			}
+		case '"':
+			synonym := oboSynonym{text: text.String(), scope: defaultScope}
+			if fields := strings.Fields(value[i+1:]); len(fields) > 0 {
+				if _, ok := oboScopes[fields[0]]; ok {
+					synonym.scope = fields[0]
+				}
+			}
+			return synonym, nil
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return oboSynonym{}, fmt.Errorf("synonym is missing its closing quote: %q", value)
+}
+
+// oboValue unescapes an unquoted tag value, without its trailing modifiers (e.g. "{source="ChEBI"}") or comment.
+func oboValue(value string) string {
+	var text strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		atWordStart := i > 0 && (value[i-1] == ' ' || value[i-1] == '\t')
+		switch {
+		case c == '\\' && i+1 < len(value):
+			i++
+			text.WriteString(oboUnescape(value[i]))
+		case c == '!' && atWordStart, c == '{' && atWordStart && strings.HasSuffix(strings.TrimSpace(value), "}"):
+			return strings.TrimSpace(text.String())
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// oboUnescape returns the character which c stands for when it is escaped with a backslash.
+func oboUnescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'W':
+		return " "
+	default:
+		return string(c)
+	}
+}
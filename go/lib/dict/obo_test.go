@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEntries reads the example dictionary called name.
+func readEntries(t *testing.T, name string, config DictConfig) []Entry {
+	file, err := os.Open("../../cmd/dictionary-importer/dictionaries/" + name)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []Entry
+	err = ReadWithCallback(file, config, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}, nil)
+	require.NoError(t, err)
+	return entries
+}
+
+func readObo(t *testing.T, options OboOptions) []Entry {
+	return readEntries(t, "chebi.obo", DictConfig{Format: OboDictionaryFormat, Obo: options})
+}
+
+func Test_oboReader(t *testing.T) {
+	entries := readObo(t, OboOptions{})
+
+	assert.Equal(t, []Entry{
+		&NerEntry{
+			Synonyms:    []string{"water", "dihydrogen oxide", "H2O", "aqua"},
+			Identifiers: map[string]string{"CHEBI:15377": "", "CAS:7732-18-5": "", "KEGG:C00001": ""},
+			Metadata: map[string]interface{}{
+				"id":   "CHEBI:15377",
+				"name": "water",
+				"synonym_scopes": map[string]string{
+					"water":            "EXACT",
+					"dihydrogen oxide": "EXACT",
+					"H2O":              "RELATED",
+					"aqua":             "RELATED",
+				},
+			},
+		},
+		&NerEntry{
+			Synonyms:    []string{"acetylsalicylic acid", "aspirin", "2-acetoxybenzoic acid"},
+			Identifiers: map[string]string{"CHEBI:15365": "", "CAS:50-78-2": ""},
+			Metadata: map[string]interface{}{
+				"id":   "CHEBI:15365",
+				"name": "acetylsalicylic acid",
+				"synonym_scopes": map[string]string{
+					"acetylsalicylic acid":  "EXACT",
+					"aspirin":               "EXACT",
+					"2-acetoxybenzoic acid": "RELATED",
+				},
+			},
+		},
+	}, entries)
+}
+
+func Test_oboReader_SynonymScopes(t *testing.T) {
+	entries := readObo(t, OboOptions{SynonymScopes: []string{"exact"}})
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, []string{"water", "dihydrogen oxide"}, entries[0].GetSynonyms())
+	assert.Equal(t, []string{"acetylsalicylic acid", "aspirin"}, entries[1].GetSynonyms())
+}
+
+func Test_oboReader_IncludeObsolete(t *testing.T) {
+	entries := readObo(t, OboOptions{IncludeObsolete: true})
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"obsolete thing"}, entries[2].GetSynonyms())
+	assert.Equal(t, true, entries[2].GetMetadata()["obsolete"])
+}
+
+func Test_parseOboSynonym(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    oboSynonym
+		wantErr bool
+	}{
+		{name: "scope and xrefs", value: `"aspirin" EXACT [WHO_MedNet:]`, want: oboSynonym{text: "aspirin", scope: "EXACT"}},
+		{name: "synonym type", value: `"H2O" RELATED FORMULA []`, want: oboSynonym{text: "H2O", scope: "RELATED"}},
+		{name: "no scope", value: `"aqua" []`, want: oboSynonym{text: "aqua", scope: "RELATED"}},
+		{name: "escaped quote", value: `"5\" nucleotide" NARROW []`, want: oboSynonym{text: `5" nucleotide`, scope: "NARROW"}},
+		{name: "unquoted", value: `aspirin EXACT []`, wantErr: true},
+		{name: "unterminated", value: `"aspirin EXACT []`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOboSynonym(tt.value, "RELATED")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
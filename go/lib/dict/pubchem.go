@@ -14,80 +14,66 @@
 package dict
 
 import (
-	"bufio"
 	"errors"
-	"os"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/rs/zerolog/log"
 )
 
-func NewPubchemReader() Reader {
-	return pubchemReader{}
+func NewPubchemReader(maxLineSize int) Reader {
+	return pubchemReader{maxLineSize: maxLineSize}
 }
 
-type pubchemReader struct{}
+type pubchemReader struct {
+	maxLineSize int
+}
 
-func (p pubchemReader) Read(file *os.File) (chan Entry, chan error) {
+func (p pubchemReader) Read(file io.Reader) (chan Entry, chan error) {
 	entries := make(chan Entry)
 	errors := make(chan error)
 	go p.read(file, entries, errors)
 	return entries, errors
 }
 
-func (p pubchemReader) read(dict *os.File, entries chan Entry, errors chan error) {
-
-	// Instantiate variables we need to keep track of across lines.
-	scn := bufio.NewScanner(dict)
-	row := 1
-	var synonyms []string
+func (p pubchemReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	scanner := newLineScanner(dict, p.maxLineSize, errors)
 
-	scn.Scan()
-	currentId, firstValue, err := parseLine(scn.Text())
-	if err != nil {
-		errors <- err
-		return
-	}
-
-	identifiers := map[string]string{"pubchem": strconv.Itoa(currentId)}
-	if isIdentifier(firstValue) {
-		identifiers[firstValue] = ""
-	} else {
-		synonyms = append(synonyms, firstValue)
-	}
-
-	for scn.Scan() {
-		row++
-		line := scn.Text()
-		id, value, err := parseLine(line)
+	// A compound's rows are consecutive, so its entry is sent when the next compound's rows start, or at the end.
+	var entry *NerEntry
+	currentId := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		id, value, err := parseLine(scanner.Text())
 		if err != nil {
-			log.Warn().Int("row", row).Err(err).Send()
+			scanner.rowError(err)
 			continue
 		}
 
-		if id != currentId {
-			ids := make(map[string]string)
-			for _, id := range identifiers {
-				ids[id] = ""
-			}
-			entries <- &NerEntry{
-				Synonyms:    synonyms,
-				Identifiers: ids,
+		if entry == nil || id != currentId {
+			if entry != nil {
+				entries <- entry
 			}
-			synonyms = []string{}
-			identifiers = map[string]string{"pubchem": strconv.Itoa(id)}
 			currentId = id
+			entry = &NerEntry{Identifiers: map[string]string{strconv.Itoa(id): ""}}
 		}
 
 		if isIdentifier(value) {
-			identifiers[value] = ""
+			entry.Identifiers[value] = ""
 		} else {
-			synonyms = append(synonyms, value)
+			entry.Synonyms = append(entry.Synonyms, value)
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		errors <- err
+		return
+	}
+	if entry != nil {
+		entries <- entry
+	}
 	errors <- nil
 }
 
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"sort"
+	"strings"
+)
+
+// RDFOptions configures how OWL and SKOS vocabularies are read from RDF.
+type RDFOptions struct {
+	// Prefixes are the compact identifier prefixes and the IRIs they stand for, e.g. MESH and
+	// http://id.nlm.nih.gov/mesh/. IRIs are compacted with the longest matching IRI. OBO PURLs, e.g.
+	// http://purl.obolibrary.org/obo/GO_0008150, are compacted to e.g. GO:0008150 unless a prefix matches. Other IRIs
+	// are kept whole. It is a list rather than a map because config keys aren't case sensitive.
+	Prefixes []RDFPrefix
+	// Languages are the language tags of the labels to import, e.g. [en]. Labels without a language tag are always
+	// imported. Every label is imported if it is empty.
+	Languages []string
+	// SynonymScopes are the scopes (EXACT, RELATED, NARROW or BROAD) of the synonyms to import. Every synonym is
+	// imported if it is empty. A resource's rdfs:label and skos:prefLabel are always imported.
+	SynonymScopes []string `mapstructure:"synonym_scopes"`
+	// IncludeObsolete imports resources which are owl:deprecated, flagged as obsolete in their metadata, instead of
+	// skipping them.
+	IncludeObsolete bool `mapstructure:"include_obsolete"`
+}
+
+const (
+	rdfNamespace      = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	rdfsNamespace     = "http://www.w3.org/2000/01/rdf-schema#"
+	owlNamespace      = "http://www.w3.org/2002/07/owl#"
+	skosNamespace     = "http://www.w3.org/2004/02/skos/core#"
+	oboInOwlNamespace = "http://www.geneontology.org/formats/oboInOwl#"
+	oboPurl           = "http://purl.obolibrary.org/obo/"
+)
+
+// rdfNameProperties are the properties whose values are a resource's name.
+var rdfNameProperties = map[string]struct{}{
+	rdfsNamespace + "label":     {},
+	skosNamespace + "prefLabel": {},
+}
+
+// rdfSynonymProperties maps the properties whose values are a resource's synonyms to their scope.
+var rdfSynonymProperties = map[string]string{
+	skosNamespace + "altLabel":              "EXACT",
+	skosNamespace + "hiddenLabel":           "RELATED",
+	oboInOwlNamespace + "hasExactSynonym":   "EXACT",
+	oboInOwlNamespace + "hasRelatedSynonym": "RELATED",
+	oboInOwlNamespace + "hasNarrowSynonym":  "NARROW",
+	oboInOwlNamespace + "hasBroadSynonym":   "BROAD",
+}
+
+// rdfXrefProperties are the properties whose values are other identifiers of a resource.
+var rdfXrefProperties = map[string]struct{}{
+	oboInOwlNamespace + "hasDbXref": {},
+	skosNamespace + "exactMatch":    {},
+}
+
+// rdfTerm is the object of an RDF statement.
+type rdfTerm struct {
+	value   string // an IRI, a blank node label beginning "_:", or a literal's lexical form
+	literal bool
+	lang    string
+}
+
+// rdfResource is what we keep of the statements about a resource.
+type rdfResource struct {
+	iri        string
+	name       string
+	synonyms   []oboSynonym
+	xrefs      []string
+	deprecated bool
+}
+
+// rdfEntries turns RDF statements into entries. Statements about a resource must be contiguous, as they are in
+// Turtle and RDF/XML written by common tools and in sorted N-Triples, so that only one resource is held in memory at
+// a time. Statements about blank nodes, e.g. OWL axioms and restrictions, are ignored.
+type rdfEntries struct {
+	options  RDFOptions
+	resource *rdfResource
+	prefixes []RDFPrefix // longest IRI first
+}
+
+// RDFPrefix is a compact identifier prefix and the IRI it stands for.
+type RDFPrefix struct {
+	Prefix string
+	IRI    string
+}
+
+func newRDFEntries(options RDFOptions) *rdfEntries {
+	entries := &rdfEntries{options: options, prefixes: append([]RDFPrefix(nil), options.Prefixes...)}
+	sort.SliceStable(entries.prefixes, func(i, j int) bool {
+		return len(entries.prefixes[i].IRI) > len(entries.prefixes[j].IRI)
+	})
+	return entries
+}
+
+// add adds a statement. If it is about a different resource to the statements before it, the entry for the resource
+// before is returned.
+func (r *rdfEntries) add(subject, predicate string, object rdfTerm) Entry {
+	if strings.HasPrefix(subject, "_:") {
+		return nil
+	}
+
+	var entry Entry
+	if r.resource == nil || r.resource.iri != subject {
+		entry = r.flush()
+		r.resource = &rdfResource{iri: subject}
+	}
+
+	resource := r.resource
+	if _, ok := rdfNameProperties[predicate]; ok && object.literal && r.importLanguage(object.lang) {
+		if resource.name == "" {
+			resource.name = object.value
+		} else {
+			resource.synonyms = append(resource.synonyms, oboSynonym{text: object.value, scope: "EXACT"})
+		}
+	} else if scope, ok := rdfSynonymProperties[predicate]; ok && object.literal && r.importLanguage(object.lang) {
+		resource.synonyms = append(resource.synonyms, oboSynonym{text: object.value, scope: scope})
+	} else if _, ok := rdfXrefProperties[predicate]; ok && !strings.HasPrefix(object.value, "_:") {
+		xref := object.value
+		if !object.literal {
+			xref = r.compact(xref)
+		}
+		resource.xrefs = append(resource.xrefs, xref)
+	} else if predicate == owlNamespace+"deprecated" && object.literal {
+		resource.deprecated = object.value == "true" || object.value == "1"
+	}
+	return entry
+}
+
+// flush returns the entry for the resource whose statements were added last, if it should be imported.
+func (r *rdfEntries) flush() Entry {
+	resource := r.resource
+	r.resource = nil
+	if resource == nil {
+		return nil
+	}
+
+	term := &oboTerm{
+		id:       r.compact(resource.iri),
+		name:     resource.name,
+		synonyms: resource.synonyms,
+		xrefs:    resource.xrefs,
+		obsolete: resource.deprecated,
+	}
+	entry := oboReader{options: OboOptions{SynonymScopes: r.options.SynonymScopes, IncludeObsolete: r.options.IncludeObsolete}}.entry(term)
+	if entry != nil {
+		entry.GetMetadata()["iri"] = resource.iri
+	}
+	return entry
+}
+
+// compact returns the compact identifier for iri.
+func (r *rdfEntries) compact(iri string) string {
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(iri, p.IRI) && len(iri) > len(p.IRI) {
+			return p.Prefix + ":" + iri[len(p.IRI):]
+		}
+	}
+	if local := strings.TrimPrefix(iri, oboPurl); local != iri {
+		if underscore := strings.IndexByte(local, '_'); underscore > 0 && !strings.Contains(local, "/") {
+			return local[:underscore] + ":" + local[underscore+1:]
+		}
+	}
+	return iri
+}
+
+func (r *rdfEntries) importLanguage(lang string) bool {
+	if lang == "" || len(r.options.Languages) == 0 {
+		return true
+	}
+	for _, l := range r.options.Languages {
+		if strings.EqualFold(l, lang) || (len(lang) > len(l) && lang[len(l)] == '-' && strings.EqualFold(l, lang[:len(l)])) {
+			return true
+		}
+	}
+	return false
+}
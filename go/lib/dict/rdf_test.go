@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var meshOptions = RDFOptions{Prefixes: []RDFPrefix{{Prefix: "MESH", IRI: "http://id.nlm.nih.gov/mesh/"}}}
+
+var meshEntries = []Entry{
+	&NerEntry{
+		Synonyms:    []string{"Asthma", "Asthma, Bronchial", "Bronchial Asthma", "Asthme"},
+		Identifiers: map[string]string{"MESH:D001249": ""},
+		Metadata: map[string]interface{}{
+			"id":   "MESH:D001249",
+			"iri":  "http://id.nlm.nih.gov/mesh/D001249",
+			"name": "Asthma",
+			"synonym_scopes": map[string]string{
+				"Asthma":            "EXACT",
+				"Asthma, Bronchial": "EXACT",
+				"Bronchial Asthma":  "EXACT",
+				"Asthme":            "EXACT",
+			},
+		},
+	},
+	&NerEntry{
+		Synonyms:    []string{"Acetaminophen", "Paracetamol", "N-(4-hydroxyphenyl)acetamide"},
+		Identifiers: map[string]string{"MESH:D000082": ""},
+		Metadata: map[string]interface{}{
+			"id":   "MESH:D000082",
+			"iri":  "http://id.nlm.nih.gov/mesh/D000082",
+			"name": "Acetaminophen",
+			"synonym_scopes": map[string]string{
+				"Acetaminophen":                "EXACT",
+				"Paracetamol":                  "EXACT",
+				"N-(4-hydroxyphenyl)acetamide": "EXACT",
+			},
+		},
+	},
+}
+
+func Test_turtleReader(t *testing.T) {
+	entries := readEntries(t, "mesh.ttl", DictConfig{Format: TurtleDictionaryFormat, RDF: meshOptions})
+
+	require.Len(t, entries, 2)
+	// the hidden label is only in the Turtle
+	assert.Equal(t, append(meshEntries[0].GetSynonyms(), "Asthmas"), entries[0].GetSynonyms())
+	assert.Equal(t, "RELATED", entries[0].GetMetadata()["synonym_scopes"].(map[string]string)["Asthmas"])
+	assert.Equal(t, meshEntries[1], entries[1])
+}
+
+func Test_nTriplesReader(t *testing.T) {
+	entries := readEntries(t, "mesh.nt", DictConfig{Format: NTriplesDictionaryFormat, RDF: meshOptions})
+
+	assert.Equal(t, meshEntries, entries)
+}
+
+func Test_rdfXMLReader(t *testing.T) {
+	options := RDFOptions{Prefixes: []RDFPrefix{{Prefix: "EFO", IRI: "http://www.ebi.ac.uk/efo/EFO_"}}}
+	entries := readEntries(t, "efo.owl", DictConfig{Format: RDFXMLDictionaryFormat, RDF: options})
+
+	assert.Equal(t, []Entry{
+		&NerEntry{
+			Synonyms:    []string{"asthma", "asthmatic", "asthme", "allergic asthma"},
+			Identifiers: map[string]string{"EFO:0000270": "", "MESH:D001249": "", "MONDO:0004979": ""},
+			Metadata: map[string]interface{}{
+				"id":   "EFO:0000270",
+				"iri":  "http://www.ebi.ac.uk/efo/EFO_0000270",
+				"name": "asthma",
+				"synonym_scopes": map[string]string{
+					"asthma":          "EXACT",
+					"asthmatic":       "EXACT",
+					"asthme":          "RELATED",
+					"allergic asthma": "NARROW",
+				},
+			},
+		},
+		&NerEntry{
+			Synonyms:    []string{"Asthma", "Bronchial asthma"},
+			Identifiers: map[string]string{"HP:0002099": ""},
+			Metadata: map[string]interface{}{
+				"id":   "HP:0002099",
+				"iri":  "http://purl.obolibrary.org/obo/HP_0002099",
+				"name": "Asthma",
+				"synonym_scopes": map[string]string{
+					"Asthma":           "EXACT",
+					"Bronchial asthma": "EXACT",
+				},
+			},
+		},
+	}, entries)
+}
+
+func Test_rdfXMLReader_Options(t *testing.T) {
+	options := RDFOptions{Languages: []string{"en"}, SynonymScopes: []string{"EXACT"}, IncludeObsolete: true}
+	entries := readEntries(t, "efo.owl", DictConfig{Format: RDFXMLDictionaryFormat, RDF: options})
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"asthma", "asthmatic"}, entries[0].GetSynonyms())
+	assert.Equal(t, "http://www.ebi.ac.uk/efo/EFO_0000270", entries[0].GetMetadata()["id"])
+	assert.Equal(t, []string{"obsolete experimental factor"}, entries[2].GetSynonyms())
+	assert.Equal(t, true, entries[2].GetMetadata()["obsolete"])
+}
+
+func Test_turtleParser(t *testing.T) {
+	type statement struct {
+		subject, predicate string
+		object             rdfTerm
+	}
+	tests := []struct {
+		name    string
+		turtle  string
+		want    []statement
+		wantErr bool
+	}{
+		{
+			name:   "base and relative IRIs",
+			turtle: "@base <http://example.org/> .\n<a> <b> <c> .",
+			want:   []statement{{"http://example.org/a", "http://example.org/b", rdfTerm{value: "http://example.org/c"}}},
+		},
+		{
+			name:   "SPARQL prefix",
+			turtle: "PREFIX ex: <http://example.org/>\nex:a ex:b ex:c.d .",
+			want:   []statement{{"http://example.org/a", "http://example.org/b", rdfTerm{value: "http://example.org/c.d"}}},
+		},
+		{
+			name:   "escapes",
+			turtle: `<a> <b> "café \"au lait\""@fr-CA .`,
+			want:   []statement{{"a", "b", rdfTerm{value: `café "au lait"`, literal: true, lang: "fr-CA"}}},
+		},
+		{
+			name:   "long string",
+			turtle: "<a> <b> '''two\n\"lines\"''' .",
+			want:   []statement{{"a", "b", rdfTerm{value: "two\n\"lines\"", literal: true}}},
+		},
+		{
+			name:   "numbers, booleans and collections",
+			turtle: "<a> <b> 1.5, true, ( <c> 2 ) .",
+			want: []statement{
+				{"a", "b", rdfTerm{value: "1.5", literal: true}},
+				{"a", "b", rdfTerm{value: "true", literal: true}},
+				{"a", "b", rdfTerm{value: "_:b1"}},
+			},
+		},
+		{
+			name:    "undefined prefix",
+			turtle:  "ex:a ex:b ex:c .",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			turtle:  `<a> <b> "c .`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []statement
+			parser := newTurtleParser(bufio.NewReader(strings.NewReader(tt.turtle)), func(subject, predicate string, object rdfTerm) {
+				got = append(got, statement{subject, predicate, object})
+			})
+			err := parser.parse()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// xmlEntity matches the entity declarations in a DOCTYPE, which OWL tools use to abbreviate IRIs, e.g.
+// <!ENTITY obo "http://purl.obolibrary.org/obo/">.
+var xmlEntity = regexp.MustCompile(`<!ENTITY\s+(\S+)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+
+// NewRDFXMLReader returns a reader for OWL and SKOS vocabularies in RDF/XML. The file is parsed as a stream of
+// elements, so the whole graph is never held in memory.
+func NewRDFXMLReader(options RDFOptions) Reader {
+	return rdfXMLReader{options: options}
+}
+
+type rdfXMLReader struct {
+	options RDFOptions
+}
+
+func (r rdfXMLReader) Read(file io.Reader) (chan Entry, chan error) {
+	entries := make(chan Entry)
+	errors := make(chan error)
+	go r.read(file, entries, errors)
+	return entries, errors
+}
+
+func (r rdfXMLReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	rdf := newRDFEntries(r.options)
+	parser := newRDFXMLParser(dict, func(subject, predicate string, object rdfTerm) {
+		if entry := rdf.add(subject, predicate, object); entry != nil {
+			entries <- entry
+		}
+	})
+	if err := parser.parse(); err != nil {
+		errors <- fileError(dict, err)
+		return
+	}
+	if entry := rdf.flush(); entry != nil {
+		entries <- entry
+	}
+	errors <- nil
+}
+
+type rdfStatementFunc func(subject, predicate string, object rdfTerm)
+
+// rdfXMLScope is the xml:base and xml:lang which apply to an element.
+type rdfXMLScope struct {
+	base *url.URL
+	lang string
+}
+
+func (s rdfXMLScope) with(attrs []xml.Attr) rdfXMLScope {
+	for _, attr := range attrs {
+		if attr.Name.Space != xmlNamespace {
+			continue
+		}
+		switch attr.Name.Local {
+		case "lang":
+			s.lang = attr.Value
+		case "base":
+			if base, err := url.Parse(attr.Value); err == nil {
+				s.base = s.resolveURL(base)
+			}
+		}
+	}
+	return s
+}
+
+func (s rdfXMLScope) resolveURL(ref *url.URL) *url.URL {
+	if s.base == nil || ref.IsAbs() {
+		return ref
+	}
+	return s.base.ResolveReference(ref)
+}
+
+func (s rdfXMLScope) resolve(iri string) string {
+	ref, err := url.Parse(iri)
+	if err != nil {
+		return iri
+	}
+	return s.resolveURL(ref).String()
+}
+
+// rdfXMLParser is a streaming parser for RDF/XML. It calls onStatement with the statements about each node element
+// which is a child of rdf:RDF. Statements about nested node elements are discarded.
+type rdfXMLParser struct {
+	d           *xml.Decoder
+	onStatement rdfStatementFunc
+	blankNodes  int
+}
+
+func newRDFXMLParser(r io.Reader, onStatement rdfStatementFunc) *rdfXMLParser {
+	d := xml.NewDecoder(r)
+	d.Entity = make(map[string]string)
+	return &rdfXMLParser{d: d, onStatement: onStatement}
+}
+
+func (p *rdfXMLParser) errorf(format string, args ...interface{}) error {
+	line, _ := p.d.InputPos()
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *rdfXMLParser) parse() error {
+	var scope rdfXMLScope
+	for {
+		tok, err := p.d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.Directive:
+			for _, entity := range xmlEntity.FindAllStringSubmatch(string(t), -1) {
+				p.d.Entity[entity[1]] = entity[2] + entity[3]
+			}
+		case xml.StartElement:
+			// the children of rdf:RDF are node elements
+			if t.Name.Space == rdfNamespace && t.Name.Local == "RDF" {
+				scope = scope.with(t.Attr)
+				continue
+			}
+			if _, err := p.node(t, scope, p.onStatement); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// node parses a node element, after its start, and returns its subject.
+func (p *rdfXMLParser) node(start xml.StartElement, scope rdfXMLScope, onStatement rdfStatementFunc) (string, error) {
+	scope = scope.with(start.Attr)
+
+	subject := ""
+	for _, attr := range start.Attr {
+		if attr.Name.Space != rdfNamespace {
+			continue
+		}
+		switch attr.Name.Local {
+		case "about":
+			subject = scope.resolve(attr.Value)
+		case "ID":
+			subject = scope.resolve("#" + attr.Value)
+		case "nodeID":
+			subject = "_:" + attr.Value
+		}
+	}
+	if subject == "" {
+		subject = p.newBlankNode()
+	}
+
+	if start.Name.Space != rdfNamespace || start.Name.Local != "Description" {
+		onStatement(subject, rdfNamespace+"type", rdfTerm{value: start.Name.Space + start.Name.Local})
+	}
+	// property attributes
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "" || attr.Name.Space == rdfNamespace || attr.Name.Space == xmlNamespace || attr.Name.Space == "xmlns" {
+			continue
+		}
+		onStatement(subject, attr.Name.Space+attr.Name.Local, rdfTerm{value: attr.Value, literal: true, lang: scope.lang})
+	}
+
+	return subject, p.properties(subject, scope, onStatement)
+}
+
+// properties parses the property elements of a node, up to the node's end.
+func (p *rdfXMLParser) properties(subject string, scope rdfXMLScope, onStatement rdfStatementFunc) error {
+	for {
+		tok, err := p.d.Token()
+		if err != nil {
+			return p.errorf("unterminated node element: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := p.property(subject, t, scope, onStatement); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// property parses a property element, after its start.
+func (p *rdfXMLParser) property(subject string, start xml.StartElement, scope rdfXMLScope, onStatement rdfStatementFunc) error {
+	scope = scope.with(start.Attr)
+	predicate := start.Name.Space + start.Name.Local
+
+	var resource, parseType string
+	for _, attr := range start.Attr {
+		if attr.Name.Space != rdfNamespace {
+			continue
+		}
+		switch attr.Name.Local {
+		case "resource":
+			resource = scope.resolve(attr.Value)
+		case "nodeID":
+			resource = "_:" + attr.Value
+		case "parseType":
+			parseType = attr.Value
+		}
+	}
+
+	switch {
+	case resource != "":
+		onStatement(subject, predicate, rdfTerm{value: resource})
+		return p.d.Skip()
+	case parseType == "Resource":
+		blankNode := p.newBlankNode()
+		onStatement(subject, predicate, rdfTerm{value: blankNode})
+		return p.properties(blankNode, scope, discardStatement)
+	case parseType != "":
+		// XML literals and collections
+		return p.d.Skip()
+	}
+
+	// the value is either text or a nested node element
+	var text strings.Builder
+	object := ""
+	for {
+		tok, err := p.d.Token()
+		if err != nil {
+			return p.errorf("unterminated property element: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			if object, err = p.node(t, scope, discardStatement); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if object != "" {
+				onStatement(subject, predicate, rdfTerm{value: object})
+			} else {
+				onStatement(subject, predicate, rdfTerm{value: text.String(), literal: true, lang: scope.lang})
+			}
+			return nil
+		}
+	}
+}
+
+func (p *rdfXMLParser) newBlankNode() string {
+	p.blankNodes++
+	return "_:b" + strconv.Itoa(p.blankNodes)
+}
+
+func discardStatement(string, string, rdfTerm) {}
@@ -14,16 +14,39 @@
 package dict
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 type DictConfig struct {
-	Name   string
-	Path   string
-	Format Format
+	Name      string
+	Path      string
+	Format    Format
+	Obo       OboOptions       // options for the obo format
+	RDF       RDFOptions       // options for the rdfxml, turtle and ntriples formats
+	Delimited DelimitedOptions // options for the csv and tsv formats
+	// MaxLineSize is the longest line, in bytes, which line based formats read. Longer lines are bad rows. It defaults
+	// to DefaultMaxLineSize.
+	MaxLineSize int `mapstructure:"max_line_size"`
+	// BadRows is what to do with malformed rows. It defaults to SkipBadRows.
+	BadRows BadRowPolicy `mapstructure:"bad_rows"`
+	// HTTPTimeout is how long the server of a remote dictionary may take to respond, or to send more of a file, before
+	// the read fails. It defaults to DefaultHTTPTimeout, and a negative timeout never fails.
+	HTTPTimeout time.Duration `mapstructure:"http_timeout"`
 }
 
+// BadRowPolicy is what to do with malformed rows in a dictionary.
+type BadRowPolicy string
+
+const (
+	SkipBadRows    BadRowPolicy = "skip"  // log and skip them
+	AbortOnBadRows BadRowPolicy = "abort" // stop reading at the first one
+)
+
 /**
 	Entry provides an interface for readers which may have different formats for identifiers and metadata.
 
@@ -104,57 +127,176 @@ const (
 	LeadmineDictionaryFormat  Format = "leadmine"
 	NativeDictionaryFormat    Format = "native"
 	SwissProtDictionaryFormat Format = "swissprot"
+	OboDictionaryFormat       Format = "obo"
+	RDFXMLDictionaryFormat    Format = "rdfxml"
+	TurtleDictionaryFormat    Format = "turtle"
+	NTriplesDictionaryFormat  Format = "ntriples"
+	MeSHDictionaryFormat      Format = "mesh"
+	CSVDictionaryFormat       Format = "csv"
+	TSVDictionaryFormat       Format = "tsv"
 )
 
+// Reader reads the entries of one dictionary input, e.g. a file or a decompressed shard of one. Errors are tagged with
+// the input's name if it has a Name method, as *os.File does.
 type Reader interface {
-	Read(file *os.File) (chan Entry, chan error)
+	Read(file io.Reader) (chan Entry, chan error)
 }
 
-func Read(format Format, file *os.File) (chan Entry, chan error, error) {
-	switch format {
+// NewReader returns a reader for dictionaries described by config.
+func NewReader(config DictConfig) (Reader, error) {
+	switch config.BadRows {
+	case "", SkipBadRows, AbortOnBadRows:
+	default:
+		return nil, fmt.Errorf("unsupported bad row policy %q, expected %s or %s", config.BadRows, SkipBadRows, AbortOnBadRows)
+	}
+
+	switch config.Format {
 	case PubchemDictionaryFormat:
-		entries, errors := NewPubchemReader().Read(file)
-		return entries, errors, nil
+		return NewPubchemReader(config.MaxLineSize), nil
 	case LeadmineDictionaryFormat:
-		entries, errors := NewLeadmineReader().Read(file)
-		return entries, errors, nil
+		return NewLeadmineReader(config.MaxLineSize), nil
 	case NativeDictionaryFormat:
-		entries, errors := NewNativeReader().Read(file)
-		return entries, errors, nil
+		return NewNativeReader(config.MaxLineSize), nil
 	case SwissProtDictionaryFormat:
-		entries, errors := NewSwissProtReader().Read(file)
-		return entries, errors, nil
+		return NewSwissProtReader(config.MaxLineSize), nil
+	case OboDictionaryFormat:
+		return NewOboReader(config.Obo, config.MaxLineSize), nil
+	case RDFXMLDictionaryFormat:
+		return NewRDFXMLReader(config.RDF), nil
+	case TurtleDictionaryFormat, NTriplesDictionaryFormat:
+		return NewTurtleReader(config.RDF), nil
+	case MeSHDictionaryFormat:
+		return NewMeSHReader(), nil
+	case CSVDictionaryFormat, TSVDictionaryFormat:
+		return NewDelimitedReader(config.Format, config.Delimited, config.MaxLineSize)
 	default:
-		return nil, nil, fmt.Errorf("unsupported dictionary format %v", format)
+		return nil, fmt.Errorf("unsupported dictionary format %v", config.Format)
 	}
 }
 
-// ReadWithCallback reads the dictionary file according to its format and executes the onEntry callback for each NerEntry.
-// The onEOF callback is executed when there are no more entries in the file.
-func ReadWithCallback(file *os.File, format Format, onEntry func(entry Entry) error, onEOF func() error) error {
-	entries, errors, err := Read(format, file)
+// Read reads the dictionary file according to its format, with each format's default options.
+func Read(format Format, file io.Reader) (chan Entry, chan error, error) {
+	reader, err := NewReader(DictConfig{Format: format})
 	if err != nil {
+		return nil, nil, err
+	}
+	entries, errors := reader.Read(file)
+	return entries, errors, nil
+}
+
+// RowError is a malformed row which a reader has skipped. Readers send it on their error channel and carry on reading.
+type RowError struct {
+	File string
+	Row  int // the line number, or the number of the record in formats which aren't line based
+	Err  error
+}
+
+func (e RowError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Row, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// ReadWithCallback reads the dictionary file described by config and executes the onEntry callback for each NerEntry.
+// The onEOF callback is executed when there are no more entries in the file. Malformed rows are logged and skipped, or
+// returned if config.BadRows is AbortOnBadRows.
+func ReadWithCallback(file io.Reader, config DictConfig, onEntry func(entry Entry) error, onEOF func() error) error {
+	onRowError := func(err RowError) error {
+		if config.BadRows == AbortOnBadRows {
+			return err
+		}
+		log.Warn().Str("file", err.File).Int("row", err.Row).Err(err.Err).Msg("skipping malformed row")
+		return nil
+	}
+	if err := ReadWithRowErrors(file, config, onEntry, onRowError); err != nil {
 		return err
 	}
 
-Listen:
+	if onEOF != nil {
+		return onEOF()
+	}
+
+	return nil
+}
+
+// ReadWithRowErrors reads the dictionary file described by config and executes the onEntry callback for each entry,
+// and the onRowError callback for each malformed row which the reader skips. Reading stops if either returns an error,
+// and the reader has stopped by the time ReadWithRowErrors returns.
+func ReadWithRowErrors(file io.Reader, config DictConfig, onEntry func(entry Entry) error, onRowError func(err RowError) error) error {
+	reader, err := NewReader(config)
+	if err != nil {
+		return err
+	}
+	input := abortableReader{reader: file, done: make(chan struct{})}
+	entries, errs := reader.Read(input)
+	// if reading stops early, the reader's next read of the file fails, and the rest of its entries and errors are
+	// discarded until it has stopped, rather than leaving it blocked sending them.
+	stopped := false
+	defer func() {
+		if !stopped {
+			close(input.done)
+			drain(entries, errs)
+		}
+	}()
+
 	for {
 		select {
-		case err := <-errors:
-			if err != nil {
-				return err
+		case err := <-errs:
+			var rowErr RowError
+			if errors.As(err, &rowErr) {
+				if err := onRowError(rowErr); err != nil {
+					return err
+				}
+				continue
 			}
-			break Listen
+			stopped = true
+			return err
 		case entry := <-entries:
 			if err := onEntry(entry); err != nil {
 				return err
 			}
 		}
 	}
+}
 
-	if onEOF != nil {
-		return onEOF()
+// errReadAborted is returned by the file of a reader whose entries are no longer wanted.
+var errReadAborted = errors.New("dictionary read aborted")
+
+// abortableReader reads from reader until done is closed, then fails, so that the Reader reading it stops.
+type abortableReader struct {
+	reader io.Reader
+	done   chan struct{}
+}
+
+func (a abortableReader) Read(p []byte) (int, error) {
+	select {
+	case <-a.done:
+		return 0, errReadAborted
+	default:
+		return a.reader.Read(p)
 	}
+}
 
-	return nil
+// Name returns the name of the file being read, if it has one, for readers' errors.
+func (a abortableReader) Name() string {
+	return inputName(a.reader)
+}
+
+// drain discards entries and errors until a Reader sends the error, or nil, which it stops after.
+func drain(entries chan Entry, errs chan error) {
+	for {
+		select {
+		case err := <-errs:
+			var rowErr RowError
+			if !errors.As(err, &rowErr) {
+				return
+			}
+		case <-entries:
+		}
+	}
 }
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// long is longer than the maximum line size used by the tests.
+var long = strings.Repeat("x", 200)
+
+const testMaxLineSize = 100
+
+// readerTestCase is a dictionary with two entries in a format. Line based formats skip long lines as bad rows, others
+// have no maximum line size. The long line is always the second.
+type readerTestCase struct {
+	config     DictConfig
+	dictionary string
+	// withLongLine is dictionary with a line longer than testMaxLineSize.
+	withLongLine string
+	lineBased    bool
+}
+
+var readerTestCases = map[Format]readerTestCase{
+	PubchemDictionaryFormat: {
+		dictionary:   "1\taspirin\n1\tCHEBI:15365\n2\twater\n",
+		withLongLine: "1\taspirin\n1\t" + long + "\n2\twater\n",
+		lineBased:    true,
+	},
+	LeadmineDictionaryFormat: {
+		dictionary:   "aspirin\tASA\tD1\nwater\tD2\n",
+		withLongLine: "aspirin\tASA\tD1\n" + long + "\tD3\nwater\tD2\n",
+		lineBased:    true,
+	},
+	NativeDictionaryFormat: {
+		dictionary:   `{"Synonyms":["aspirin"],"Identifiers":{"id":"1"}}` + "\n" + `{"Synonyms":["water"],"Identifiers":{"id":"2"}}` + "\n",
+		withLongLine: `{"Synonyms":["aspirin"],"Identifiers":{"id":"1"}}` + "\n" + `{"Synonyms":["` + long + `"]}` + "\n" + `{"Synonyms":["water"],"Identifiers":{"id":"2"}}` + "\n",
+		lineBased:    true,
+	},
+	SwissProtDictionaryFormat: {
+		dictionary:   `{"synonyms":["P1"],"identifiers":{"Homo sapiens":{"Accession":"P1"}}}` + "\n" + `{"synonyms":["P2"],"identifiers":{"Homo sapiens":{"Accession":"P2"}}}` + "\n",
+		withLongLine: `{"synonyms":["P1"],"identifiers":{"Homo sapiens":{"Accession":"P1"}}}` + "\n" + `{"synonyms":["` + long + `"]}` + "\n" + `{"synonyms":["P2"],"identifiers":{"Homo sapiens":{"Accession":"P2"}}}` + "\n",
+		lineBased:    true,
+	},
+	OboDictionaryFormat: {
+		dictionary:   "[Term]\nid: X:1\nname: aspirin\n\n[Term]\nid: X:2\nname: water\n",
+		withLongLine: "[Term]\ncomment: " + long + "\nid: X:1\nname: aspirin\n\n[Term]\nid: X:2\nname: water\n",
+		lineBased:    true,
+	},
+	TSVDictionaryFormat: {
+		config:       DictConfig{Delimited: DelimitedOptions{Columns: []DelimitedColumn{{Number: 1, Role: synonymColumn}}}},
+		dictionary:   "aspirin\t1\nwater\t2\n",
+		withLongLine: "aspirin\t1\n" + long + "\t3\nwater\t2\n",
+		lineBased:    true,
+	},
+	CSVDictionaryFormat: {
+		config:       DictConfig{Delimited: DelimitedOptions{Columns: []DelimitedColumn{{Number: 1, Role: synonymColumn}}}},
+		dictionary:   "aspirin,1\nwater,2\n",
+		withLongLine: "aspirin,1\n\"" + long + "\",3\nwater,2\n",
+		lineBased:    true,
+	},
+	TurtleDictionaryFormat: {
+		dictionary:   "@prefix skos: <http://www.w3.org/2004/02/skos/core#> .\n<a> skos:prefLabel \"aspirin\" .\n<b> skos:prefLabel \"water\" .\n",
+		withLongLine: "@prefix skos: <http://www.w3.org/2004/02/skos/core#> .\n<a> skos:prefLabel \"aspirin\" ; skos:altLabel \"" + long + "\" .\n<b> skos:prefLabel \"water\" .\n",
+	},
+	NTriplesDictionaryFormat: {
+		dictionary:   "<a> <http://www.w3.org/2004/02/skos/core#prefLabel> \"aspirin\" .\n<b> <http://www.w3.org/2004/02/skos/core#prefLabel> \"water\" .\n",
+		withLongLine: "<a> <http://www.w3.org/2004/02/skos/core#prefLabel> \"aspirin\" .\n<a> <http://www.w3.org/2004/02/skos/core#altLabel> \"" + long + "\" .\n<b> <http://www.w3.org/2004/02/skos/core#prefLabel> \"water\" .\n",
+	},
+	RDFXMLDictionaryFormat: {
+		dictionary:   `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:rdfs="http://www.w3.org/2000/01/rdf-schema#">` + "\n" + `<rdf:Description rdf:about="a"><rdfs:label>aspirin</rdfs:label></rdf:Description>` + "\n" + `<rdf:Description rdf:about="b"><rdfs:label>water</rdfs:label></rdf:Description>` + "\n</rdf:RDF>\n",
+		withLongLine: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:rdfs="http://www.w3.org/2000/01/rdf-schema#">` + "\n" + `<rdf:Description rdf:about="a"><rdfs:label>aspirin</rdfs:label><rdfs:label>` + long + `</rdfs:label></rdf:Description>` + "\n" + `<rdf:Description rdf:about="b"><rdfs:label>water</rdfs:label></rdf:Description>` + "\n</rdf:RDF>\n",
+	},
+	MeSHDictionaryFormat: {
+		dictionary:   "<DescriptorRecordSet>\n<DescriptorRecord><DescriptorUI>D1</DescriptorUI><DescriptorName><String>aspirin</String></DescriptorName></DescriptorRecord>\n<DescriptorRecord><DescriptorUI>D2</DescriptorUI><DescriptorName><String>water</String></DescriptorName></DescriptorRecord>\n</DescriptorRecordSet>\n",
+		withLongLine: "<DescriptorRecordSet>\n<DescriptorRecord><DescriptorUI>D1</DescriptorUI><DescriptorName><String>aspirin</String></DescriptorName><ConceptList><Concept><TermList><Term><String>" + long + "</String></Term></TermList></Concept></ConceptList></DescriptorRecord>\n<DescriptorRecord><DescriptorUI>D2</DescriptorUI><DescriptorName><String>water</String></DescriptorName></DescriptorRecord>\n</DescriptorRecordSet>\n",
+	},
+}
+
+type ReaderSuite struct {
+	suite.Suite
+}
+
+func TestReaderSuite(t *testing.T) {
+	suite.Run(t, new(ReaderSuite))
+}
+
+func (s *ReaderSuite) read(format Format, dictionary string) (entries []Entry, rowErrors []RowError, err error) {
+	return readString(s.T(), format, dictionary)
+}
+
+// tempDictionary writes dictionary to a temporary file, which is removed when the test finishes.
+func tempDictionary(t *testing.T, dictionary string) *os.File {
+	file, err := ioutil.TempFile("", "dictionary-*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		file.Close()
+		os.Remove(file.Name())
+	})
+	_, err = file.WriteString(dictionary)
+	require.NoError(t, err)
+	_, err = file.Seek(0, 0)
+	require.NoError(t, err)
+	return file
+}
+
+// readString reads dictionary in format, returning its entries, its bad rows and the error which stopped the read.
+func readString(t *testing.T, format Format, dictionary string) (entries []Entry, rowErrors []RowError, err error) {
+	file := tempDictionary(t, dictionary)
+
+	config := readerTestCases[format].config
+	config.Format = format
+	config.MaxLineSize = testMaxLineSize
+	err = ReadWithRowErrors(file, config, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}, func(err RowError) error {
+		rowErrors = append(rowErrors, err)
+		return nil
+	})
+	return entries, rowErrors, err
+}
+
+func (s *ReaderSuite) TestComplete() {
+	for format, tt := range readerTestCases {
+		entries, rowErrors, err := s.read(format, tt.dictionary)
+		s.NoError(err, format)
+		s.Empty(rowErrors, format)
+		s.Len(entries, 2, format)
+	}
+}
+
+func (s *ReaderSuite) TestEmpty() {
+	for format := range readerTestCases {
+		entries, rowErrors, err := s.read(format, "")
+		s.NoError(err, format)
+		s.Empty(rowErrors, format)
+		s.Empty(entries, format)
+	}
+}
+
+func (s *ReaderSuite) TestTruncated() {
+	for format, tt := range readerTestCases {
+		entries, _, err := s.read(format, tt.dictionary[:len(tt.dictionary)-4])
+		if tt.lineBased {
+			// the last row is either a bad row or shorter
+			s.NoError(err, format)
+			s.NotEmpty(entries, format)
+		} else {
+			s.Error(err, format)
+			s.Contains(err.Error(), "dictionary-", "the error should name the file")
+		}
+	}
+}
+
+func (s *ReaderSuite) TestLongLine() {
+	for format, tt := range readerTestCases {
+		entries, rowErrors, err := s.read(format, tt.withLongLine)
+		s.NoError(err, format)
+		s.Len(entries, 2, format)
+		if tt.lineBased {
+			if s.Len(rowErrors, 1, format) {
+				s.True(errors.Is(rowErrors[0], ErrLineTooLong), format)
+				s.Equal(2, rowErrors[0].Row, format)
+			}
+		} else {
+			s.Empty(rowErrors, format)
+		}
+	}
+}
+
+func (s *ReaderSuite) TestAbort() {
+	aborted := errors.New("aborted")
+	for format, tt := range readerTestCases {
+		goroutines := runtime.NumGoroutine()
+		config := tt.config
+		config.Format = format
+		config.MaxLineSize = testMaxLineSize
+
+		// the reader is left with an entry to send when the first stops the read.
+		entries := 0
+		err := ReadWithRowErrors(tempDictionary(s.T(), tt.dictionary), config, func(entry Entry) error {
+			entries++
+			return aborted
+		}, nil)
+		s.Equal(aborted, err, format)
+		s.Equal(1, entries, format)
+		s.True(goroutinesStop(goroutines), "%s reader didn't stop", format)
+
+		if tt.lineBased {
+			// or a bad row stops the read before the entry after it is sent.
+			config.BadRows = AbortOnBadRows
+			err = ReadWithCallback(tempDictionary(s.T(), tt.withLongLine), config, func(Entry) error { return nil }, nil)
+			s.True(errors.Is(err, ErrLineTooLong), format)
+			s.True(goroutinesStop(goroutines), "%s reader didn't stop", format)
+		}
+	}
+}
+
+// goroutinesStop waits for up to a second for the number of goroutines to fall to n.
+func goroutinesStop(n int) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if runtime.NumGoroutine() <= n {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_pubchemReader(t *testing.T) {
+	entries, _, err := readString(t, PubchemDictionaryFormat, "1\taspirin\n1\tCHEBI:15365\n2\twater\n")
+	require.NoError(t, err)
+
+	// the last compound is read too
+	assert.Equal(t, []Entry{
+		&NerEntry{Synonyms: []string{"aspirin"}, Identifiers: map[string]string{"1": "", "CHEBI:15365": ""}},
+		&NerEntry{Synonyms: []string{"water"}, Identifiers: map[string]string{"2": ""}},
+	}, entries)
+}
+
+func Test_ReadWithCallback_BadRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  BadRowPolicy
+		wantErr bool
+		want    int
+	}{
+		{name: "skip by default", want: 2},
+		{name: "skip", policy: SkipBadRows, want: 2},
+		{name: "abort", policy: AbortOnBadRows, wantErr: true, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tempDictionary(t, "aspirin\tD1\nbad row\nwater\tD2\n")
+
+			entries := 0
+			err := ReadWithCallback(file, DictConfig{Format: LeadmineDictionaryFormat, BadRows: tt.policy}, func(entry Entry) error {
+				entries++
+				return nil
+			}, nil)
+
+			assert.Equal(t, tt.want, entries)
+			if tt.wantErr {
+				var rowErr RowError
+				require.True(t, errors.As(err, &rowErr))
+				assert.Equal(t, 2, rowErr.Row)
+				assert.Equal(t, file.Name(), rowErr.File)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxLineSize is the longest line, in bytes, which line based readers read if DictConfig.MaxLineSize isn't set.
+const DefaultMaxLineSize = 1024 * 1024
+
+// ErrLineTooLong is the error of a row which is longer than the maximum line size.
+var ErrLineTooLong = errors.New("line is longer than the maximum line size")
+
+// lineScanner reads the lines of a dictionary file for line based readers. Lines longer than the maximum line size are
+// skipped and sent as row errors, rather than stopping the read as they would with a bufio.Scanner. Errors are tagged
+// with the file name and line number.
+type lineScanner struct {
+	r           *bufio.Reader
+	file        string
+	line        int
+	maxLineSize int
+	text        []byte
+	err         error
+	errors      chan error
+}
+
+func newLineScanner(file io.Reader, maxLineSize int, errors chan error) *lineScanner {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	return &lineScanner{r: bufio.NewReader(file), file: inputName(file), maxLineSize: maxLineSize, errors: errors}
+}
+
+// Scan advances to the next line which isn't too long, and returns false at the end of the file or if there is an
+// error.
+func (s *lineScanner) Scan() bool {
+	for {
+		ok, tooLong := s.readLine()
+		if !ok {
+			return false
+		}
+		if !tooLong {
+			return true
+		}
+		s.rowError(ErrLineTooLong)
+	}
+}
+
+func (s *lineScanner) readLine() (ok, tooLong bool) {
+	if s.err != nil {
+		return false, false
+	}
+
+	s.text = s.text[:0]
+	read := false
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		// allow for the line ending, which is trimmed below
+		if !tooLong && len(s.text)+len(chunk) > s.maxLineSize+2 {
+			tooLong = true
+			s.text = s.text[:0]
+		}
+		if !tooLong {
+			s.text = append(s.text, chunk...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && read {
+			break
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			return false, false
+		}
+		break
+	}
+
+	s.line++
+	if n := len(s.text); n > 0 && s.text[n-1] == '\n' {
+		s.text = s.text[:n-1]
+	}
+	if n := len(s.text); n > 0 && s.text[n-1] == '\r' {
+		s.text = s.text[:n-1]
+	}
+	return true, tooLong || len(s.text) > s.maxLineSize
+}
+
+// Text returns the current line.
+func (s *lineScanner) Text() string {
+	return string(s.text)
+}
+
+// Bytes returns the current line. It is overwritten by the next call to Scan.
+func (s *lineScanner) Bytes() []byte {
+	return s.text
+}
+
+// Err returns the error which stopped the scanner, tagged with the file name and line number, or nil at the end of the
+// file.
+func (s *lineScanner) Err() error {
+	if s.err == nil {
+		return nil
+	}
+	if s.file == "" {
+		return fmt.Errorf("line %d: %w", s.line+1, s.err)
+	}
+	return fmt.Errorf("%s:%d: %w", s.file, s.line+1, s.err)
+}
+
+// rowError sends err as the error of the current line, which is skipped or aborts the read depending on the caller.
+func (s *lineScanner) rowError(err error) {
+	s.errors <- RowError{File: s.file, Row: s.line, Err: err}
+}
+
+// fileError tags err, which stopped the read of file, with the file name if it has one.
+func fileError(file io.Reader, err error) error {
+	name := inputName(file)
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lineScanner(t *testing.T) {
+	// longer than bufio's default buffer
+	longer := strings.Repeat("y", 5000)
+	tests := []struct {
+		name        string
+		input       string
+		maxLineSize int
+		want        []string
+		wantTooLong []int
+	}{
+		{name: "line endings", input: "a\r\nb\nc", maxLineSize: 10, want: []string{"a", "b", "c"}},
+		{name: "empty lines", input: "\n\na\n", maxLineSize: 10, want: []string{"", "", "a"}},
+		{name: "exactly the maximum", input: "abc\r\nabcd\n", maxLineSize: 3, want: []string{"abc"}, wantTooLong: []int{2}},
+		{name: "longer than the buffer", input: longer + "\nb\n", maxLineSize: 6000, want: []string{longer, "b"}},
+		{name: "too long and longer than the buffer", input: "a\n" + longer + longer + "\nb", maxLineSize: 6000, want: []string{"a", "b"}, wantTooLong: []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := make(chan error)
+			scanner := newLineScanner(tempDictionary(t, tt.input), tt.maxLineSize, errors)
+
+			var tooLong []int
+			done := make(chan struct{})
+			go func() {
+				for err := range errors {
+					tooLong = append(tooLong, err.(RowError).Row)
+				}
+				close(done)
+			}()
+			var lines []string
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			close(errors)
+			<-done
+
+			assert.NoError(t, scanner.Err())
+			assert.Equal(t, tt.want, lines)
+			assert.Equal(t, tt.wantTooLong, tooLong)
+		})
+	}
+}
@@ -0,0 +1,473 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrNoInputs is the error of a dictionary path, e.g. a glob or an empty directory, which doesn't have any files.
+var ErrNoInputs = errors.New("no dictionary files found")
+
+// ErrStalled is the error of a remote dictionary file whose server stops responding for longer than the
+// DictConfig.HTTPTimeout.
+var ErrStalled = errors.New("the server stopped responding")
+
+// DefaultHTTPTimeout is the HTTPTimeout of a DictConfig which doesn't set one.
+const DefaultHTTPTimeout = time.Minute
+
+// Compressed inputs are detected by their magic numbers rather than their file extensions.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// namedReader is a dictionary input which isn't a file, e.g. a decompressed file, named by where it was read from so
+// that errors can be tagged with it.
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func (n namedReader) Name() string {
+	return n.name
+}
+
+// inputName returns the name of input, e.g. the path of an *os.File, or "" if it doesn't have one.
+func inputName(input io.Reader) string {
+	if named, ok := input.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
+
+// Inputs returns the locations of the files which make up the dictionary at path, in the order they are read. path is
+// either a file, an http(s) URL, a directory whose files (but not hidden files or subdirectories) are shards of the
+// dictionary, or a glob of shards e.g. "pubchem/CID-Synonym-*.gz". Shards are read in lexical order.
+func Inputs(path string) ([]string, error) {
+	if isURL(path) {
+		return []string{path}, nil
+	}
+
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%s: %w", path, ErrNoInputs)
+		}
+		return files, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrNoInputs)
+	}
+	return files, nil
+}
+
+// EachInput calls onInput with each file of the dictionary at config.Path, as returned by Inputs, in turn. gzip, bzip2
+// and zstd compressed files are decompressed as they are read, and each file in a zip archive is a separate input.
+// Inputs have a Name method, so errors can be tagged with where they came from. Remote files are requested with ctx,
+// and fail with ErrStalled if their server stops responding for config.HTTPTimeout.
+//
+// It returns the hex encoded SHA-256 of the files as they are stored, before they are decompressed, which is the same
+// as Checksum(ctx, config).
+func EachInput(ctx context.Context, config DictConfig, onInput func(input io.Reader) error) (string, error) {
+	return EachInputWithProgress(ctx, config, ioutil.Discard, onInput)
+}
+
+// EachInputWithProgress is EachInput, writing every byte of the files to stored as it is read, before it is
+// decompressed, so that the progress of the read can be measured against InputStat.Size.
+func EachInputWithProgress(ctx context.Context, config DictConfig, stored io.Writer, onInput func(input io.Reader) error) (string, error) {
+	locations, err := Inputs(config.Path)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := sha256.New()
+	for _, location := range locations {
+		if err := eachInput(ctx, location, httpTimeout(config), io.MultiWriter(checksum, stored), onInput); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// Checksum returns the hex encoded SHA-256 of the files of the dictionary at config.Path, without reading their
+// contents.
+func Checksum(ctx context.Context, config DictConfig) (string, error) {
+	locations, err := Inputs(config.Path)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := sha256.New()
+	for _, location := range locations {
+		file, err := openLocation(ctx, location, httpTimeout(config))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(checksum, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", location, err)
+		}
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// InputStat describes the files of a dictionary without reading them.
+type InputStat struct {
+	// Size is the total size of the files as they are stored, or -1 if the size of a remote file isn't known.
+	Size int64
+	// Fingerprint changes if a file is added, removed, resized or modified. It is much cheaper than Checksum, but relies
+	// on modification times, or the ETag and Last-Modified headers of remote files.
+	Fingerprint string
+}
+
+// StatInputs returns the InputStat of the files of the dictionary at config.Path.
+func StatInputs(ctx context.Context, config DictConfig) (InputStat, error) {
+	locations, err := Inputs(config.Path)
+	if err != nil {
+		return InputStat{}, err
+	}
+
+	stat := InputStat{}
+	fingerprint := sha256.New()
+	for _, location := range locations {
+		size, version, err := statLocation(ctx, location, httpTimeout(config))
+		if err != nil {
+			return InputStat{}, err
+		}
+		if size < 0 || stat.Size < 0 {
+			stat.Size = -1
+		} else {
+			stat.Size += size
+		}
+		fmt.Fprintf(fingerprint, "%s\t%d\t%s\n", location, size, version)
+	}
+	stat.Fingerprint = hex.EncodeToString(fingerprint.Sum(nil))
+	return stat, nil
+}
+
+// statLocation returns the size of the local file or http(s) URL at location, or -1 if it isn't known, and a string
+// which changes when it is modified.
+func statLocation(ctx context.Context, location string, timeout time.Duration) (int64, string, error) {
+	if !isURL(location) {
+		info, err := os.Stat(location)
+		if err != nil {
+			return 0, "", err
+		}
+		return info.Size(), info.ModTime().UTC().Format(time.RFC3339Nano), nil
+	}
+
+	ctx, stall := newStallTimer(ctx, timeout)
+	defer stall.stop()
+	resp, err := request(ctx, http.MethodHead, location)
+	if err != nil {
+		return 0, "", stall.err(location, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("%s: %s", location, resp.Status)
+	}
+	return resp.ContentLength, resp.Header.Get("ETag") + " " + resp.Header.Get("Last-Modified"), nil
+}
+
+// eachInput calls onInput with the decompressed contents of the file at location, writing every byte of the file to
+// checksum.
+func eachInput(ctx context.Context, location string, timeout time.Duration, checksum io.Writer, onInput func(input io.Reader) error) error {
+	file, err := openLocation(ctx, location, timeout)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// the whole file is checksummed, even if the decompressor doesn't read to the end of it.
+	stored := bufio.NewReader(io.TeeReader(file, checksum))
+	if magic, _ := stored.Peek(len(zipMagic)); bytes.Equal(magic, zipMagic) {
+		return eachZipInput(location, file, stored, onInput)
+	}
+
+	input, closeInput, err := decompress(location, stored)
+	if err != nil {
+		return err
+	}
+	if err := onInput(input); err != nil {
+		closeInput()
+		return err
+	}
+	if err := closeInput(); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(ioutil.Discard, stored); err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	return nil
+}
+
+// eachZipInput calls onInput with each file in the zip archive at location. zip archives can't be read as a stream, so
+// remote archives are downloaded to a temporary file first.
+func eachZipInput(location string, file io.Reader, stored io.Reader, onInput func(input io.Reader) error) error {
+	archive, ok := file.(*os.File)
+	if ok {
+		if _, err := io.Copy(ioutil.Discard, stored); err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+	} else {
+		tmp, err := ioutil.TempFile("", "dictionary-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if _, err := io.Copy(tmp, stored); err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		archive = tmp
+	}
+
+	info, err := archive.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+
+	for _, member := range r.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		if err := eachZipMember(location+"/"+member.Name, member, onInput); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eachZipMember(name string, member *zip.File, onInput func(input io.Reader) error) error {
+	contents, err := member.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer contents.Close()
+
+	input, closeInput, err := decompress(name, bufio.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	if err := onInput(input); err != nil {
+		closeInput()
+		return err
+	}
+	return closeInput()
+}
+
+// decompress returns the contents of stored, decompressing them if they are gzip, bzip2 or zstd compressed, and a
+// function which releases the decompressor and reports any error it had.
+func decompress(name string, stored *bufio.Reader) (io.Reader, func() error, error) {
+	noop := func() error { return nil }
+
+	magic, err := stored.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(stored)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return namedReader{Reader: gz, name: name}, gz.Close, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return namedReader{Reader: bzip2.NewReader(stored), name: name}, noop, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return zstdDecompress(name, stored)
+	default:
+		return namedReader{Reader: stored, name: name}, noop, nil
+	}
+}
+
+// zstdDecompress decompresses stored, returning a function which releases the decoder.
+func zstdDecompress(name string, stored io.Reader) (io.Reader, func() error, error) {
+	decoder, err := zstd.NewReader(stored)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	closeInput := func() error {
+		decoder.Close()
+		return nil
+	}
+	return namedReader{Reader: decoder, name: name}, closeInput, nil
+}
+
+// openLocation opens the local file or http(s) URL at location. The server of a URL must respond, and then keep sending
+// the file, within timeout.
+func openLocation(ctx context.Context, location string, timeout time.Duration) (io.ReadCloser, error) {
+	if !isURL(location) {
+		return os.Open(location)
+	}
+
+	ctx, stall := newStallTimer(ctx, timeout)
+	resp, err := request(ctx, http.MethodGet, location)
+	if err != nil {
+		stall.stop()
+		return nil, stall.err(location, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		stall.stop()
+		return nil, fmt.Errorf("%s: %s", location, resp.Status)
+	}
+	return &remoteFile{body: resp.Body, location: location, stall: stall}, nil
+}
+
+func request(ctx context.Context, method string, location string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// remoteFile is the body of a remote dictionary file, whose request is cancelled if a read makes no progress within
+// the timeout of its stallTimer.
+type remoteFile struct {
+	body     io.ReadCloser
+	location string
+	stall    *stallTimer
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+	if n > 0 {
+		f.stall.progress()
+	}
+	if err != nil && err != io.EOF {
+		err = f.stall.err(f.location, err)
+	}
+	return n, err
+}
+
+func (f *remoteFile) Close() error {
+	f.stall.stop()
+	return f.body.Close()
+}
+
+// stallTimer cancels the context of a request once it has made no progress for timeout. A timeout of less than zero
+// never cancels it.
+type stallTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled int32
+}
+
+func newStallTimer(ctx context.Context, timeout time.Duration) (context.Context, *stallTimer) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &stallTimer{timeout: timeout, cancel: cancel}
+	if timeout >= 0 {
+		s.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&s.stalled, 1)
+			cancel()
+		})
+	}
+	return ctx, s
+}
+
+// progress restarts the timer.
+func (s *stallTimer) progress() {
+	if s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+}
+
+// stop stops the timer and releases the context.
+func (s *stallTimer) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.cancel()
+}
+
+// err returns ErrStalled, tagged with location, if the timer cancelled the request, or else err.
+func (s *stallTimer) err(location string, err error) error {
+	if atomic.LoadInt32(&s.stalled) == 1 {
+		return fmt.Errorf("%s: no response for %s: %w", location, s.timeout, ErrStalled)
+	}
+	return err
+}
+
+// httpTimeout returns config.HTTPTimeout, or DefaultHTTPTimeout if it isn't set.
+func httpTimeout(config DictConfig) time.Duration {
+	if config.HTTPTimeout == 0 {
+		return DefaultHTTPTimeout
+	}
+	return config.HTTPTimeout
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
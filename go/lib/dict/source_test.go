@@ -0,0 +1,312 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sourceContents = "1\taspirin\n"
+
+// bzip2 and zstd compressed sourceContents, as compressed by the bzip2 and zstd commands.
+var (
+	bzip2Contents = []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x22, 0x3e, 0xe2, 0x14, 0x00, 0x00, 0x01, 0x49,
+		0x80, 0x00, 0x30, 0x20, 0x00, 0x20, 0x21, 0x58, 0x00, 0x20, 0x00, 0x22, 0x06, 0x87, 0xa4, 0x20, 0xc9, 0x88,
+		0xbd, 0x48, 0x07, 0x4f, 0xc5, 0xdc, 0x91, 0x4e, 0x14, 0x24, 0x08, 0x8f, 0xb8, 0x85, 0x00,
+	}
+	zstdContents = []byte{
+		0x28, 0xb5, 0x2f, 0xfd, 0x04, 0x58, 0x51, 0x00, 0x00, 0x31, 0x09, 0x61, 0x73, 0x70, 0x69, 0x72, 0x69, 0x6e,
+		0x0a, 0xd7, 0x5a, 0x20, 0x96,
+	}
+)
+
+func gzipped(t *testing.T, contents string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, members map[string][]byte, order ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range order {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write(members[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// writeFiles writes files, relative to a new temporary directory which is returned.
+func writeFiles(t *testing.T, files map[string][]byte) string {
+	dir, err := ioutil.TempDir("", "dictionary-")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, contents, 0644))
+	}
+	return dir
+}
+
+type input struct {
+	name     string
+	contents string
+}
+
+func readInputs(t *testing.T, path string) ([]input, string, error) {
+	var inputs []input
+	checksum, err := EachInput(context.Background(), DictConfig{Path: path}, func(r io.Reader) error {
+		contents, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input{name: inputName(r), contents: string(contents)})
+		return nil
+	})
+	return inputs, checksum, err
+}
+
+func Test_EachInput(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "plain", file: []byte(sourceContents)},
+		{name: "gzip", file: gzipped(t, sourceContents)},
+		{name: "bzip2", file: bzip2Contents},
+		{name: "zstd", file: zstdContents},
+		{name: "empty", file: []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(writeFiles(t, map[string][]byte{"dictionary": tt.file}), "dictionary")
+
+			inputs, checksum, err := readInputs(t, path)
+			require.NoError(t, err)
+
+			want := sourceContents
+			if len(tt.file) == 0 {
+				want = ""
+			}
+			assert.Equal(t, []input{{name: path, contents: want}}, inputs)
+			sum := sha256.Sum256(tt.file)
+			assert.Equal(t, hex.EncodeToString(sum[:]), checksum)
+
+			stored, err := Checksum(context.Background(), DictConfig{Path: path})
+			require.NoError(t, err)
+			assert.Equal(t, checksum, stored)
+		})
+	}
+}
+
+func Test_EachInput_Shards(t *testing.T) {
+	dir := writeFiles(t, map[string][]byte{
+		"shard-1.tsv.gz":    gzipped(t, "1\taspirin\n"),
+		"shard-2.tsv":       []byte("2\twater\n"),
+		".hidden":           []byte("3\tignored\n"),
+		"nested/shard-3.gz": gzipped(t, "3\tignored\n"),
+		"other.zip": zipped(t, map[string][]byte{
+			"b.tsv": []byte("4\tethanol\n"),
+			"a.gz":  gzipped(t, "5\tmethanol\n"),
+		}, "b.tsv", "a.gz"),
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want []input
+	}{
+		{
+			name: "directory",
+			path: dir,
+			want: []input{
+				{name: filepath.Join(dir, "other.zip") + "/b.tsv", contents: "4\tethanol\n"},
+				{name: filepath.Join(dir, "other.zip") + "/a.gz", contents: "5\tmethanol\n"},
+				{name: filepath.Join(dir, "shard-1.tsv.gz"), contents: "1\taspirin\n"},
+				{name: filepath.Join(dir, "shard-2.tsv"), contents: "2\twater\n"},
+			},
+		},
+		{
+			name: "glob",
+			path: filepath.Join(dir, "shard-*"),
+			want: []input{
+				{name: filepath.Join(dir, "shard-1.tsv.gz"), contents: "1\taspirin\n"},
+				{name: filepath.Join(dir, "shard-2.tsv"), contents: "2\twater\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs, _, err := readInputs(t, tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, inputs)
+		})
+	}
+
+	_, _, err := readInputs(t, filepath.Join(dir, "missing-*"))
+	assert.True(t, errors.Is(err, ErrNoInputs))
+}
+
+func Test_EachInput_URL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dictionary.tsv.gz":
+			w.Write(gzipped(t, sourceContents))
+		case "/dictionary.zip":
+			w.Write(zipped(t, map[string][]byte{"dictionary.tsv": []byte(sourceContents)}, "dictionary.tsv"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	inputs, _, err := readInputs(t, server.URL+"/dictionary.tsv.gz")
+	require.NoError(t, err)
+	assert.Equal(t, []input{{name: server.URL + "/dictionary.tsv.gz", contents: sourceContents}}, inputs)
+
+	inputs, _, err = readInputs(t, server.URL+"/dictionary.zip")
+	require.NoError(t, err)
+	assert.Equal(t, []input{{name: server.URL + "/dictionary.zip/dictionary.tsv", contents: sourceContents}}, inputs)
+
+	_, _, err = readInputs(t, server.URL+"/missing.tsv")
+	assert.Error(t, err)
+}
+
+func Test_EachInput_RowErrors(t *testing.T) {
+	path := filepath.Join(writeFiles(t, map[string][]byte{"pubchem.tsv.gz": gzipped(t, "1\taspirin\nnot a row\n")}), "pubchem.tsv.gz")
+
+	var rowErrors []RowError
+	_, err := EachInput(context.Background(), DictConfig{Path: path}, func(input io.Reader) error {
+		return ReadWithRowErrors(input, DictConfig{Format: PubchemDictionaryFormat}, func(entry Entry) error {
+			return nil
+		}, func(err RowError) error {
+			rowErrors = append(rowErrors, err)
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	require.Len(t, rowErrors, 1)
+	assert.Equal(t, path, rowErrors[0].File)
+	assert.Equal(t, 2, rowErrors[0].Row)
+}
+
+func Test_StatInputs(t *testing.T) {
+	gz := gzipped(t, "1\taspirin\n")
+	dir := writeFiles(t, map[string][]byte{"shard-1.gz": gz, "shard-2.tsv": []byte("2\twater\n")})
+
+	stat, err := StatInputs(context.Background(), DictConfig{Path: dir})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(gz)+len("2\twater\n")), stat.Size)
+
+	var stored bytes.Buffer
+	_, err = EachInputWithProgress(context.Background(), DictConfig{Path: dir}, &stored, func(input io.Reader) error {
+		_, err := ioutil.ReadAll(input)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, stat.Size, int64(stored.Len()))
+
+	same, err := StatInputs(context.Background(), DictConfig{Path: dir})
+	require.NoError(t, err)
+	assert.Equal(t, stat, same)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shard-2.tsv"), []byte("2\twater\n3\tethanol\n"), 0644))
+	changed, err := StatInputs(context.Background(), DictConfig{Path: dir})
+	require.NoError(t, err)
+	assert.NotEqual(t, stat.Fingerprint, changed.Fingerprint)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1"`)
+		w.Write(gz)
+	}))
+	defer server.Close()
+	remote, err := StatInputs(context.Background(), DictConfig{Path: server.URL + "/dictionary.gz"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(gz)), remote.Size)
+}
+
+func Test_EachInput_StalledServer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/no-response.tsv":
+			<-release
+		case "/stalled-body.tsv":
+			w.Write([]byte("1\taspirin\n"))
+			w.(http.Flusher).Flush()
+			<-release
+		case "/slow.tsv":
+			// every part arrives within the timeout, although the whole file doesn't.
+			for i := 0; i < 5; i++ {
+				fmt.Fprintf(w, "%d\taspirin\n", i)
+				w.(http.Flusher).Flush()
+				time.Sleep(40 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := DictConfig{HTTPTimeout: 100 * time.Millisecond}
+	read := func(ctx context.Context, path string) error {
+		config.Path = server.URL + path
+		_, err := EachInput(ctx, config, func(input io.Reader) error {
+			_, err := ioutil.ReadAll(input)
+			return err
+		})
+		return err
+	}
+
+	assert.ErrorIs(t, read(context.Background(), "/no-response.tsv"), ErrStalled)
+	assert.ErrorIs(t, read(context.Background(), "/stalled-body.tsv"), ErrStalled)
+	assert.NoError(t, read(context.Background(), "/slow.tsv"))
+
+	config.Path = server.URL + "/no-response.tsv"
+	_, err := StatInputs(context.Background(), config)
+	assert.ErrorIs(t, err, ErrStalled)
+	_, err = Checksum(context.Background(), config)
+	assert.ErrorIs(t, err, ErrStalled)
+
+	// the read is cancelled with its context too.
+	config.HTTPTimeout = -1
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, read(ctx, "/no-response.tsv"), context.DeadlineExceeded)
+}
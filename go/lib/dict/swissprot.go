@@ -14,32 +14,37 @@
 package dict
 
 import (
-	"bufio"
 	"encoding/json"
-	"os"
+	"io"
 )
 
-func NewSwissProtReader() Reader {
-	return swissProtReader{}
+func NewSwissProtReader(maxLineSize int) Reader {
+	return swissProtReader{maxLineSize: maxLineSize}
 }
 
-type swissProtReader struct{}
+type swissProtReader struct {
+	maxLineSize int
+}
 
-func (p swissProtReader) Read(file *os.File) (chan Entry, chan error) {
+func (p swissProtReader) Read(file io.Reader) (chan Entry, chan error) {
 	entries := make(chan Entry)
 	errors := make(chan error)
 	go p.read(file, entries, errors)
 	return entries, errors
 }
 
-func (p swissProtReader) read(dict *os.File, entries chan Entry, errors chan error) {
-	scn := bufio.NewScanner(dict)
-	for scn.Scan() {
+func (p swissProtReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	scanner := newLineScanner(dict, p.maxLineSize, errors)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
 		var e SwissProtEntry
-		if err := json.Unmarshal(scn.Bytes(), &e); err != nil {
-			errors <- err
-			return
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			scanner.rowError(err)
+			continue
 		}
 		entries <- &e
 	}
+	errors <- scanner.Err()
 }
@@ -0,0 +1,606 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dict
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NewTurtleReader returns a reader for OWL and SKOS vocabularies in Turtle, or in N-Triples, which is a subset of
+// Turtle. The file is parsed as a stream of statements, so the whole graph is never held in memory.
+func NewTurtleReader(options RDFOptions) Reader {
+	return turtleReader{options: options}
+}
+
+type turtleReader struct {
+	options RDFOptions
+}
+
+func (t turtleReader) Read(file io.Reader) (chan Entry, chan error) {
+	entries := make(chan Entry)
+	errors := make(chan error)
+	go t.read(file, entries, errors)
+	return entries, errors
+}
+
+func (t turtleReader) read(dict io.Reader, entries chan Entry, errors chan error) {
+	rdf := newRDFEntries(t.options)
+	parser := newTurtleParser(bufio.NewReader(dict), func(subject, predicate string, object rdfTerm) {
+		if entry := rdf.add(subject, predicate, object); entry != nil {
+			entries <- entry
+		}
+	})
+	if err := parser.parse(); err != nil {
+		errors <- fileError(dict, err)
+		return
+	}
+	if entry := rdf.flush(); entry != nil {
+		entries <- entry
+	}
+	errors <- nil
+}
+
+type turtleTokenKind int
+
+const (
+	turtleEOF         turtleTokenKind = iota
+	turtleIRI                         // an IRI in angle brackets, resolved against the base IRI
+	turtleName                        // a prefixed name, blank node label, keyword, number or boolean
+	turtleLiteral                     // a quoted string
+	turtlePunctuation                 // one of . ; , [ ] ( ) ^^
+)
+
+type turtleToken struct {
+	kind  turtleTokenKind
+	value string
+	lang  string // the language tag of a literal
+}
+
+func (t turtleToken) is(punctuation string) bool {
+	return t.kind == turtlePunctuation && t.value == punctuation
+}
+
+// turtleParser is a streaming parser for Turtle. It calls onStatement with each statement as soon as it has been
+// parsed.
+type turtleParser struct {
+	r           *bufio.Reader
+	line        int
+	onStatement func(subject, predicate string, object rdfTerm)
+	prefixes    map[string]string
+	base        *url.URL
+	peeked      *turtleToken
+	blankNodes  int
+}
+
+func newTurtleParser(r *bufio.Reader, onStatement func(subject, predicate string, object rdfTerm)) *turtleParser {
+	return &turtleParser{r: r, line: 1, onStatement: onStatement, prefixes: make(map[string]string)}
+}
+
+func (p *turtleParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *turtleParser) parse() error {
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case tok.kind == turtleEOF:
+			return nil
+		case tok.kind == turtleName && (tok.value == "@prefix" || strings.EqualFold(tok.value, "PREFIX")):
+			name, err := p.next()
+			if err != nil {
+				return err
+			}
+			if name.kind != turtleName || !strings.HasSuffix(name.value, ":") {
+				return p.errorf("expected a prefix, got %q", name.value)
+			}
+			iri, err := p.next()
+			if err != nil {
+				return err
+			}
+			if iri.kind != turtleIRI {
+				return p.errorf("expected an IRI, got %q", iri.value)
+			}
+			p.prefixes[strings.TrimSuffix(name.value, ":")] = iri.value
+			if tok.value == "@prefix" {
+				if err := p.expect("."); err != nil {
+					return err
+				}
+			}
+		case tok.kind == turtleName && (tok.value == "@base" || strings.EqualFold(tok.value, "BASE")):
+			iri, err := p.next()
+			if err != nil {
+				return err
+			}
+			if iri.kind != turtleIRI {
+				return p.errorf("expected an IRI, got %q", iri.value)
+			}
+			if p.base, err = url.Parse(iri.value); err != nil {
+				return p.errorf("%v", err)
+			}
+			if tok.value == "@base" {
+				if err := p.expect("."); err != nil {
+					return err
+				}
+			}
+		default:
+			subject, err := p.subject(tok)
+			if err != nil {
+				return err
+			}
+			// a blank node property list can be a statement on its own
+			if next, err := p.next(); err != nil {
+				return err
+			} else if tok.is("[") && next.is(".") {
+				continue
+			} else {
+				p.unread(next)
+			}
+			if err := p.predicateObjectList(subject); err != nil {
+				return err
+			}
+			if err := p.expect("."); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *turtleParser) subject(tok turtleToken) (string, error) {
+	switch {
+	case tok.is("["):
+		return p.blankNodePropertyList()
+	case tok.is("("):
+		return p.collection()
+	default:
+		return p.iri(tok)
+	}
+}
+
+func (p *turtleParser) predicateObjectList(subject string) error {
+	for {
+		verb, err := p.next()
+		if err != nil {
+			return err
+		}
+		predicate := rdfNamespace + "type"
+		if verb.kind != turtleName || verb.value != "a" {
+			if predicate, err = p.iri(verb); err != nil {
+				return err
+			}
+		}
+		if err := p.objectList(subject, predicate); err != nil {
+			return err
+		}
+
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if !tok.is(";") {
+			p.unread(tok)
+			return nil
+		}
+		// semicolons can be repeated, and can end the list
+		for tok.is(";") {
+			if tok, err = p.next(); err != nil {
+				return err
+			}
+		}
+		p.unread(tok)
+		if tok.is(".") || tok.is("]") || tok.kind == turtleEOF {
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) objectList(subject, predicate string) error {
+	for {
+		object, err := p.object()
+		if err != nil {
+			return err
+		}
+		p.onStatement(subject, predicate, object)
+
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if !tok.is(",") {
+			p.unread(tok)
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) object() (rdfTerm, error) {
+	tok, err := p.next()
+	if err != nil {
+		return rdfTerm{}, err
+	}
+
+	switch {
+	case tok.kind == turtleLiteral:
+		// the datatype doesn't matter to us, but must be parsed
+		next, err := p.next()
+		if err != nil {
+			return rdfTerm{}, err
+		}
+		if next.is("^^") {
+			datatype, err := p.next()
+			if err != nil {
+				return rdfTerm{}, err
+			}
+			if _, err := p.iri(datatype); err != nil {
+				return rdfTerm{}, err
+			}
+		} else {
+			p.unread(next)
+		}
+		return rdfTerm{value: tok.value, literal: true, lang: tok.lang}, nil
+	case tok.kind == turtleName && (tok.value == "true" || tok.value == "false" || isTurtleNumber(tok.value)):
+		return rdfTerm{value: tok.value, literal: true}, nil
+	case tok.is("["), tok.is("("):
+		blankNode, err := p.subject(tok)
+		return rdfTerm{value: blankNode}, err
+	default:
+		iri, err := p.iri(tok)
+		return rdfTerm{value: iri}, err
+	}
+}
+
+// blankNodePropertyList parses the statements about a blank node, after its opening bracket.
+func (p *turtleParser) blankNodePropertyList() (string, error) {
+	blankNode := p.newBlankNode()
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.is("]") {
+		return blankNode, nil
+	}
+	p.unread(tok)
+	if err := p.predicateObjectList(blankNode); err != nil {
+		return "", err
+	}
+	return blankNode, p.expect("]")
+}
+
+// collection parses the members of a collection, after its opening parenthesis. The members are discarded.
+func (p *turtleParser) collection() (string, error) {
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return "", err
+		}
+		if tok.is(")") {
+			return p.newBlankNode(), nil
+		}
+		if tok.kind == turtleEOF {
+			return "", p.errorf("unterminated collection")
+		}
+		p.unread(tok)
+		if _, err := p.object(); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *turtleParser) newBlankNode() string {
+	p.blankNodes++
+	return "_:b" + strconv.Itoa(p.blankNodes)
+}
+
+// iri returns the IRI, or blank node label, which tok stands for.
+func (p *turtleParser) iri(tok turtleToken) (string, error) {
+	switch {
+	case tok.kind == turtleIRI:
+		return tok.value, nil
+	case tok.kind == turtleName && strings.HasPrefix(tok.value, "_:"):
+		return tok.value, nil
+	case tok.kind == turtleName:
+		colon := strings.IndexByte(tok.value, ':')
+		if colon < 0 {
+			return "", p.errorf("expected an IRI, got %q", tok.value)
+		}
+		namespace, ok := p.prefixes[tok.value[:colon]]
+		if !ok {
+			return "", p.errorf("undefined prefix %q", tok.value[:colon])
+		}
+		return namespace + tok.value[colon+1:], nil
+	default:
+		return "", p.errorf("expected an IRI, got %q", tok.value)
+	}
+}
+
+func (p *turtleParser) expect(punctuation string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !tok.is(punctuation) {
+		return p.errorf("expected %q, got %q", punctuation, tok.value)
+	}
+	return nil
+}
+
+func (p *turtleParser) unread(tok turtleToken) {
+	p.peeked = &tok
+}
+
+func (p *turtleParser) next() (turtleToken, error) {
+	if p.peeked != nil {
+		tok := *p.peeked
+		p.peeked = nil
+		return tok, nil
+	}
+
+	if err := p.skipSpace(); err == io.EOF {
+		return turtleToken{kind: turtleEOF}, nil
+	} else if err != nil {
+		return turtleToken{}, err
+	}
+
+	c, _, err := p.r.ReadRune()
+	if err != nil {
+		return turtleToken{}, err
+	}
+	switch c {
+	case '<':
+		iri, err := p.readIRI()
+		return turtleToken{kind: turtleIRI, value: iri}, err
+	case '"', '\'':
+		return p.readLiteral(c)
+	case '.', ';', ',', '[', ']', '(', ')':
+		return turtleToken{kind: turtlePunctuation, value: string(c)}, nil
+	case '^':
+		if c, _, err := p.r.ReadRune(); err != nil || c != '^' {
+			return turtleToken{}, p.errorf("expected ^^")
+		}
+		return turtleToken{kind: turtlePunctuation, value: "^^"}, nil
+	default:
+		if err := p.r.UnreadRune(); err != nil {
+			return turtleToken{}, err
+		}
+		word, err := p.readWord()
+		return turtleToken{kind: turtleName, value: word}, err
+	}
+}
+
+// skipSpace skips whitespace and comments.
+func (p *turtleParser) skipSpace() error {
+	for {
+		c, _, err := p.r.ReadRune()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '\n':
+			p.line++
+		case unicode.IsSpace(c):
+		case c == '#':
+			if _, err := p.r.ReadString('\n'); err != nil {
+				return err
+			}
+			p.line++
+		default:
+			return p.r.UnreadRune()
+		}
+	}
+}
+
+// readIRI reads an IRI, after its opening angle bracket, and resolves it against the base IRI.
+func (p *turtleParser) readIRI() (string, error) {
+	var iri strings.Builder
+	for {
+		c, _, err := p.r.ReadRune()
+		if err != nil {
+			return "", p.errorf("unterminated IRI")
+		}
+		switch c {
+		case '>':
+			return p.resolve(iri.String()), nil
+		case '\\':
+			r, err := p.readEscape()
+			if err != nil {
+				return "", err
+			}
+			iri.WriteString(r)
+		case '\n':
+			return "", p.errorf("unterminated IRI")
+		default:
+			iri.WriteRune(c)
+		}
+	}
+}
+
+func (p *turtleParser) resolve(iri string) string {
+	if p.base == nil {
+		return iri
+	}
+	ref, err := url.Parse(iri)
+	if err != nil || ref.IsAbs() {
+		return iri
+	}
+	return p.base.ResolveReference(ref).String()
+}
+
+// readLiteral reads a string, after its opening quote, and its language tag.
+func (p *turtleParser) readLiteral(quote rune) (turtleToken, error) {
+	long := false
+	if next, err := p.r.Peek(2); err == nil && rune(next[0]) == quote && rune(next[1]) == quote {
+		long = true
+		_, _ = p.r.Discard(2)
+	} else if err == nil && rune(next[0]) == quote {
+		// an empty string
+		_, _ = p.r.Discard(1)
+		return p.readLanguage("")
+	}
+
+	var text strings.Builder
+	quotes := 0
+	for {
+		c, _, err := p.r.ReadRune()
+		if err != nil {
+			return turtleToken{}, p.errorf("unterminated string")
+		}
+		if c == quote {
+			quotes++
+			if !long || quotes == 3 {
+				break
+			}
+			continue
+		}
+		// quotes in a long string which didn't end it
+		for ; quotes > 0; quotes-- {
+			text.WriteRune(quote)
+		}
+
+		switch {
+		case c == '\\':
+			r, err := p.readEscape()
+			if err != nil {
+				return turtleToken{}, err
+			}
+			text.WriteString(r)
+		case c == '\n' && !long:
+			return turtleToken{}, p.errorf("unterminated string")
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			text.WriteRune(c)
+		}
+	}
+	return p.readLanguage(text.String())
+}
+
+// readLanguage reads the language tag, if there is one, after a string.
+func (p *turtleParser) readLanguage(text string) (turtleToken, error) {
+	tok := turtleToken{kind: turtleLiteral, value: text}
+	if next, err := p.r.Peek(1); err != nil || next[0] != '@' {
+		return tok, nil
+	}
+	_, _ = p.r.Discard(1)
+
+	var lang strings.Builder
+	for {
+		next, err := p.r.Peek(1)
+		if err != nil || !(next[0] == '-' || next[0] < 128 && (unicode.IsLetter(rune(next[0])) || unicode.IsDigit(rune(next[0])))) {
+			break
+		}
+		lang.WriteByte(next[0])
+		_, _ = p.r.Discard(1)
+	}
+	tok.lang = lang.String()
+	return tok, nil
+}
+
+// readEscape reads an escape sequence, after its backslash.
+func (p *turtleParser) readEscape() (string, error) {
+	c, _, err := p.r.ReadRune()
+	if err != nil {
+		return "", p.errorf("unterminated escape sequence")
+	}
+	switch c {
+	case 't':
+		return "\t", nil
+	case 'b':
+		return "\b", nil
+	case 'n':
+		return "\n", nil
+	case 'r':
+		return "\r", nil
+	case 'f':
+		return "\f", nil
+	case 'u', 'U':
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		hex := make([]byte, digits)
+		if _, err := io.ReadFull(p.r, hex); err != nil {
+			return "", p.errorf("unterminated escape sequence")
+		}
+		code, err := strconv.ParseUint(string(hex), 16, 32)
+		if err != nil {
+			return "", p.errorf("invalid escape sequence \\%c%s", c, hex)
+		}
+		return string(rune(code)), nil
+	default:
+		// quotes, backslashes and the characters which can be escaped in local names
+		return string(c), nil
+	}
+}
+
+// readWord reads a prefixed name, blank node label, keyword, number or boolean. A full stop ends the word unless it
+// is followed by more of it, e.g. in "skos:Concept." but not in "ex:a.b".
+func (p *turtleParser) readWord() (string, error) {
+	var word strings.Builder
+	for {
+		c, _, err := p.r.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		if c == '\\' {
+			escaped, err := p.readEscape()
+			if err != nil {
+				return "", err
+			}
+			word.WriteString(escaped)
+			continue
+		}
+		if c == '.' {
+			if next, err := p.r.Peek(1); err != nil || isTurtleDelimiter(rune(next[0])) || next[0] == '.' {
+				if err := p.r.UnreadRune(); err != nil {
+					return "", err
+				}
+				break
+			}
+		}
+		if isTurtleDelimiter(c) || c == '^' {
+			if err := p.r.UnreadRune(); err != nil {
+				return "", err
+			}
+			break
+		}
+		word.WriteRune(c)
+	}
+	if word.Len() == 0 {
+		return "", p.errorf("unexpected character")
+	}
+	return word.String(), nil
+}
+
+func isTurtleDelimiter(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune(`<>"';,()[]#`, c)
+}
+
+func isTurtleNumber(word string) bool {
+	_, err := strconv.ParseFloat(word, 64)
+	return err == nil
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+)
+
+// OverlapStrategy decides which entities to keep when the spans of entities found in the same element overlap.
+type OverlapStrategy string
+
+const (
+	// KeepAll keeps every entity.
+	KeepAll OverlapStrategy = "keep-all"
+	// LongestWins drops any entity which overlaps a longer one. Overlapping entities of the same length are all kept.
+	LongestWins OverlapStrategy = "longest"
+	// RecogniserPriority keeps entities from higher priority recognisers over those from lower priority recognisers,
+	// then longer entities over shorter ones. No kept entities overlap, except those with the same span from the same
+	// recogniser, e.g. the entities for each lookup of a homonym, which are kept or dropped together.
+	RecogniserPriority OverlapStrategy = "priority"
+	// LeftmostLongest keeps the entity which starts first, then the longest of those which start at the same place,
+	// then carries on from where it ends. As for RecogniserPriority, only entities with the same span from the same
+	// recogniser overlap.
+	LeftmostLongest OverlapStrategy = "leftmost-longest"
+)
+
+// ParseOverlapStrategy returns the OverlapStrategy called name, or an error if there isn't one.
+func ParseOverlapStrategy(name string) (OverlapStrategy, error) {
+	switch strategy := OverlapStrategy(name); strategy {
+	case KeepAll, LongestWins, RecogniserPriority, LeftmostLongest:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unsupported overlap strategy '%s' - must be one of %s, %s, %s or %s", name, KeepAll, LongestWins, RecogniserPriority, LeftmostLongest)
+	}
+}
+
+// EntitySpan returns the character offsets of the start and end of entity within its element. Entities from recognisers
+// which don't set an end position are assumed to be as long as their name.
+func EntitySpan(entity *pb.Entity) (start, end uint32) {
+	if entity.EndPosition > entity.Position {
+		return entity.Position, entity.EndPosition
+	}
+	return entity.Position, entity.Position + uint32(utf8.RuneCountInString(entity.Name))
+}
+
+// ResolveOverlaps returns the entities which strategy keeps, in the order they were given.
+// priority lists recogniser names from highest to lowest priority for RecogniserPriority, and breaks ties between
+// identical spans for the other strategies. Recognisers which aren't listed come last.
+func ResolveOverlaps(entities []*pb.Entity, strategy OverlapStrategy, priority []string) []*pb.Entity {
+	if strategy == KeepAll || strategy == "" || len(entities) < 2 {
+		return entities
+	}
+
+	ranks := make(map[string]int, len(priority))
+	for i, name := range priority {
+		if _, ok := ranks[name]; !ok {
+			ranks[name] = i
+		}
+	}
+
+	spans := make([]span, len(entities))
+	for i, entity := range entities {
+		start, end := EntitySpan(entity)
+		rank, ok := ranks[entity.Recogniser]
+		if !ok {
+			rank = len(priority)
+		}
+		spans[i] = span{index: i, xpath: entity.Xpath, start: start, end: end, recogniser: entity.Recogniser, rank: rank}
+	}
+
+	keep := make([]bool, len(entities))
+	for _, group := range groupByXpath(spans) {
+		switch strategy {
+		case LongestWins:
+			keepLongest(group, keep)
+		case RecogniserPriority:
+			keepGreedily(group, keep, func(a, b span) bool {
+				if a.rank != b.rank {
+					return a.rank < b.rank
+				}
+				if a.length() != b.length() {
+					return a.length() > b.length()
+				}
+				return a.start < b.start
+			})
+		case LeftmostLongest:
+			keepGreedily(group, keep, func(a, b span) bool {
+				if a.start != b.start {
+					return a.start < b.start
+				}
+				if a.length() != b.length() {
+					return a.length() > b.length()
+				}
+				return a.rank < b.rank
+			})
+		default:
+			return entities
+		}
+	}
+
+	kept := make([]*pb.Entity, 0, len(entities))
+	for i, entity := range entities {
+		if keep[i] {
+			kept = append(kept, entity)
+		}
+	}
+	return kept
+}
+
+type span struct {
+	index      int // the index of the entity in the input
+	xpath      string
+	start, end uint32
+	recogniser string
+	rank       int // the priority of the entity's recogniser, lower is higher priority
+}
+
+func (s span) length() uint32 {
+	return s.end - s.start
+}
+
+func (s span) overlaps(other span) bool {
+	return s.start < other.end && other.start < s.end
+}
+
+// sameUnit returns whether s and other are the same text found by the same recogniser, e.g. the entities a dictionary
+// sends for each of the lookups of a homonym. They are all kept or all dropped.
+func (s span) sameUnit(other span) bool {
+	return s.start == other.start && s.end == other.end && s.recogniser == other.recogniser
+}
+
+// groupByXpath groups spans by element, as only entities in the same element can overlap.
+// Each group is sorted by start offset.
+func groupByXpath(spans []span) [][]span {
+	indexes := make(map[string]int)
+	var groups [][]span
+	for _, s := range spans {
+		i, ok := indexes[s.xpath]
+		if !ok {
+			i = len(groups)
+			indexes[s.xpath] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], s)
+	}
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].start < group[j].start
+		})
+	}
+	return groups
+}
+
+// keepLongest keeps every span in group, which must be sorted by start, unless it overlaps a longer span.
+func keepLongest(group []span, keep []bool) {
+	dropped := make([]bool, len(group))
+	for i := range group {
+		// group is sorted by start, so only the spans which follow can overlap this one's end.
+		for j := i + 1; j < len(group) && group[j].start < group[i].end; j++ {
+			switch {
+			case group[i].length() > group[j].length():
+				dropped[j] = true
+			case group[j].length() > group[i].length():
+				dropped[i] = true
+			}
+		}
+	}
+	for i, s := range group {
+		keep[s.index] = !dropped[i]
+	}
+}
+
+// keepGreedily considers the spans in group in the order given by less, keeping each one which doesn't overlap a
+// span that has already been kept. Spans which are the same unit as a kept span are kept too, so every candidate
+// identifier of a homonym survives.
+func keepGreedily(group []span, keep []bool, less func(a, b span) bool) {
+	candidates := make([]span, len(group))
+	copy(candidates, group)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+
+	// kept is sorted by start and contains no overlaps, so only the neighbours of a candidate's position can overlap it.
+	var kept []span
+	for _, candidate := range candidates {
+		i := sort.Search(len(kept), func(i int) bool {
+			return kept[i].start >= candidate.start
+		})
+		if i < len(kept) && kept[i].sameUnit(candidate) {
+			keep[candidate.index] = true
+			continue
+		}
+		if i < len(kept) && kept[i].overlaps(candidate) || i > 0 && kept[i-1].overlaps(candidate) {
+			continue
+		}
+		kept = append(kept, span{})
+		copy(kept[i+1:], kept[i:])
+		kept[i] = candidate
+		keep[candidate.index] = true
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
+)
+
+func TestResolveOverlaps(t *testing.T) {
+	// "sodium chloride solution" in /p, "chloride" in /h1
+	sodium := &pb.Entity{Name: "sodium", Position: 0, Xpath: "/p", Recogniser: "dictionary"}
+	sodiumChloride := &pb.Entity{Name: "sodium chloride", Position: 0, Xpath: "/p", Recogniser: "dictionary"}
+	chloride := &pb.Entity{Name: "chloride", Position: 7, Xpath: "/p", Recogniser: "dictionary"}
+	chlorideSolution := &pb.Entity{Name: "chloride solution", Position: 7, Xpath: "/p", Recogniser: "leadmine"}
+	leadmineSodium := &pb.Entity{Name: "sodium", Position: 0, Xpath: "/p", Recogniser: "leadmine"}
+	otherChloride := &pb.Entity{Name: "chloride", Position: 7, Xpath: "/h1", Recogniser: "dictionary"}
+
+	entities := []*pb.Entity{sodium, sodiumChloride, chloride, chlorideSolution, leadmineSodium, otherChloride}
+
+	tests := []struct {
+		name     string
+		strategy OverlapStrategy
+		priority []string
+		want     []*pb.Entity
+	}{
+		{
+			name:     "keep all",
+			strategy: KeepAll,
+			want:     entities,
+		},
+		{
+			name:     "longest wins",
+			strategy: LongestWins,
+			// "sodium chloride" overlaps the longer "chloride solution"
+			want: []*pb.Entity{chlorideSolution, otherChloride},
+		},
+		{
+			name:     "leftmost longest",
+			strategy: LeftmostLongest,
+			want:     []*pb.Entity{sodiumChloride, otherChloride},
+		},
+		{
+			name:     "recogniser priority",
+			strategy: RecogniserPriority,
+			priority: []string{"leadmine", "dictionary"},
+			want:     []*pb.Entity{chlorideSolution, leadmineSodium, otherChloride},
+		},
+		{
+			name:     "recogniser priority, other way round",
+			strategy: RecogniserPriority,
+			priority: []string{"dictionary", "leadmine"},
+			want:     []*pb.Entity{sodiumChloride, otherChloride},
+		},
+		{
+			name:     "leftmost longest, identical spans are decided by priority",
+			strategy: LeftmostLongest,
+			priority: []string{"leadmine"},
+			want:     []*pb.Entity{sodiumChloride, otherChloride},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ResolveOverlaps(entities, tt.strategy, tt.priority))
+		})
+	}
+}
+
+func TestResolveOverlaps_IdenticalSpans(t *testing.T) {
+	dictionary := &pb.Entity{Name: "calcium", Position: 3, Xpath: "/p", Recogniser: "dictionary"}
+	leadmine := &pb.Entity{Name: "calcium", Position: 3, Xpath: "/p", Recogniser: "leadmine"}
+	entities := []*pb.Entity{dictionary, leadmine}
+
+	// Neither is longer, so both are kept.
+	assert.Equal(t, entities, ResolveOverlaps(entities, LongestWins, nil))
+	assert.Equal(t, []*pb.Entity{leadmine}, ResolveOverlaps(entities, LeftmostLongest, []string{"leadmine", "dictionary"}))
+	assert.Equal(t, []*pb.Entity{dictionary}, ResolveOverlaps(entities, RecogniserPriority, []string{"dictionary", "leadmine"}))
+}
+
+func TestResolveOverlaps_Homonyms(t *testing.T) {
+	// "cold" is both the common cold and chronic obstructive lung disease, so the dictionary sends an entity for each.
+	commonCold := &pb.Entity{Name: "cold", Position: 4, Xpath: "/p", Recogniser: "dictionary", Identifiers: map[string]string{"mesh": "D003139"}}
+	copd := &pb.Entity{Name: "cold", Position: 4, Xpath: "/p", Recogniser: "dictionary", Identifiers: map[string]string{"mesh": "D029424"}}
+	// "a cold" overlaps both of them.
+	aCold := &pb.Entity{Name: "a cold", Position: 2, Xpath: "/p", Recogniser: "leadmine"}
+	entities := []*pb.Entity{commonCold, copd}
+
+	for _, strategy := range []OverlapStrategy{KeepAll, LongestWins, RecogniserPriority, LeftmostLongest} {
+		t.Run(string(strategy), func(t *testing.T) {
+			// every candidate is kept.
+			assert.Equal(t, entities, ResolveOverlaps(entities, strategy, []string{"dictionary"}))
+
+			// and every candidate is dropped together.
+			withOverlap := []*pb.Entity{commonCold, aCold, copd}
+			want := []*pb.Entity{aCold}
+			if strategy == KeepAll {
+				want = withOverlap
+			}
+			assert.Equal(t, want, ResolveOverlaps(withOverlap, strategy, []string{"leadmine", "dictionary"}))
+		})
+	}
+}
+
+func TestEntitySpan(t *testing.T) {
+	start, end := EntitySpan(&pb.Entity{Name: "α-tocopherol", Position: 4})
+	assert.Equal(t, uint32(4), start)
+	assert.Equal(t, uint32(16), end)
+}
+
+func TestParseOverlapStrategy(t *testing.T) {
+	strategy, err := ParseOverlapStrategy("leftmost-longest")
+	assert.Nil(t, err)
+	assert.Equal(t, LeftmostLongest, strategy)
+
+	_, err = ParseOverlapStrategy("shortest")
+	assert.NotNil(t, err)
+}
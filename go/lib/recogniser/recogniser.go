@@ -14,25 +14,66 @@
 package recogniser
 
 import (
-	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+	"context"
 	"sync"
 
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
+
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
+	"google.golang.org/grpc/metadata"
 )
 
 // Client
-// represents a recogniser client, i.e. a struct which implements functions to
+// represents a session with a recogniser for a single request, i.e. a struct which implements functions to
 // use a recogniser via HTTP or gRPC. Recognise() must receive snippet_reader.Values, tokenise them, and send them to a configured recogniser.
 // It must then either populate result or err depending on what happened.
+// A Client holds the state of one request, so it must not be shared between concurrent requests: use a Factory
+// to create one for each request.
+// When ctx is done, any in-flight call to the recogniser must be abandoned so that the wait group completes. The
+// channel of snippet_reader.Values may be closed by the caller before an io.EOF is sent if ctx is done.
 //
 // swagger:model RecogniserClient
 type Client interface {
 
 	// ALTERNATIVE: instead of passing httpOptions here (they are only used on http implementation, not gRPC), add httpOptions to leadmine recogniser struct.
 	// This means exporting the struct and performing a type check on values of this interface which comes with its own issues
-	Recognise(<-chan snippet_reader.Value, *sync.WaitGroup, lib.HttpOptions) error
+	Recognise(context.Context, <-chan snippet_reader.Value, *sync.WaitGroup, lib.HttpOptions) error
 	Err() error
 	Result() []*pb.Entity
 	SetExactMatch(bool)
+
+	// SetEntityCallback registers a callback which is executed for every entity as soon as the recogniser
+	// finds it, rather than waiting for Result(). A nil callback disables this.
+	SetEntityCallback(func(entity *pb.Entity) error)
+}
+
+// Factory creates a new Client for each recognition request, so that concurrent requests don't share state.
+// Implementations must be safe for concurrent use.
+type Factory interface {
+	NewClient() Client
+}
+
+// FactoryFunc adapts an ordinary function to a Factory.
+type FactoryFunc func() Client
+
+func (f FactoryFunc) NewClient() Client {
+	return f()
+}
+
+// wholeSnippetsKey is the gRPC metadata key which tells a gRPC recogniser that the snippets it is sent on a stream are
+// whole snippets rather than tokens. The sender decides, so a recogniser can't disagree with it about what it is sent.
+const wholeSnippetsKey = "x-whole-snippets"
+
+// WithWholeSnippets returns a copy of ctx which tells the gRPC recogniser a stream is opened with that the snippets sent
+// on it are whole snippets rather than tokens.
+func WithWholeSnippets(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, wholeSnippetsKey, "true")
+}
+
+// WholeSnippets returns whether ctx, the context of a gRPC recogniser's stream, was opened with WithWholeSnippets.
+func WholeSnippets(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(wholeSnippetsKey)
+	return len(values) > 0 && values[len(values)-1] == "true"
 }
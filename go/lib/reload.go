@@ -0,0 +1,38 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReloadOnSignal calls reload, in a new goroutine, every time the process receives SIGHUP, e.g. from
+// `kill -HUP <pid>`, logging whether it succeeded. reload is never called again before it has returned.
+func ReloadOnSignal(reload func() error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := reload(); err != nil {
+				log.Error().Err(err).Msg("reload failed, the previous configuration is still in use")
+				continue
+			}
+			log.Info().Msg("reloaded")
+		}
+	}()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snippet_reader
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// Document records the snippets read from a document, so that a position within a snippet can be located in the
+// document as a whole. It is safe to locate positions while snippets are still being added.
+//
+// The document's text is the text of all its snippets, one after another in the order they were read. For HTML this is
+// what the /text endpoint returns, and for plain text it is the document itself.
+type Document struct {
+	mut      sync.RWMutex
+	snippets map[string][]documentSnippet // keyed by xpath, in the order they were read
+	length   uint32                       // the length of the document's text so far, in characters
+}
+
+type documentSnippet struct {
+	text   string
+	offset uint32 // the snippet's offset, which positions within the snippet are relative to
+	start  uint32 // the offset of the snippet's text in the document's text, in characters
+	source SourceMap
+}
+
+// Location is where an entity is in a document.
+type Location struct {
+	DocumentStart uint32 // the offset of the entity in the document's text, in characters
+	DocumentEnd   uint32
+	SourceStart   uint32 // the offset of the entity in the document it was read from, in bytes
+	SourceEnd     uint32
+}
+
+func NewDocument() *Document {
+	return &Document{snippets: make(map[string][]documentSnippet)}
+}
+
+// Add records the snippet in value, if it has one.
+func (d *Document) Add(value Value) {
+	if value.Snippet == nil {
+		return
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	snippet := value.Snippet
+	d.snippets[snippet.GetXpath()] = append(d.snippets[snippet.GetXpath()], documentSnippet{
+		text:   snippet.GetText(),
+		offset: snippet.GetOffset(),
+		start:  d.length,
+		source: value.Source,
+	})
+	d.length += uint32(utf8.RuneCountInString(snippet.GetText()))
+}
+
+// Locate returns the location of the text from start to end in the element at xpath, where start and end are positions
+// of the kind given to entities, i.e. offsets in characters relative to the snippets read from that element.
+// It returns false if nothing has been read from xpath.
+func (d *Document) Locate(xpath string, start, end uint32) (Location, bool) {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
+
+	snippets := d.snippets[xpath]
+	if len(snippets) == 0 {
+		return Location{}, false
+	}
+
+	var location Location
+	location.DocumentStart, location.SourceStart = locate(snippets, start, false)
+	location.DocumentEnd, location.SourceEnd = locate(snippets, end, true)
+	return location, true
+}
+
+// locate returns the offsets in the document's text and source of position, which is in the snippet it is at or after
+// the start of. If isEnd is true, a position at the start of a snippet is at the end of the snippet before.
+func locate(snippets []documentSnippet, position uint32, isEnd bool) (documentOffset, sourceOffset uint32) {
+	i := sort.Search(len(snippets), func(i int) bool {
+		if isEnd {
+			return snippets[i].offset >= position
+		}
+		return snippets[i].offset > position
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	snippet := snippets[i]
+	if position < snippet.offset {
+		position = snippet.offset
+	}
+	relativePosition := position - snippet.offset
+	if length := uint32(utf8.RuneCountInString(snippet.text)); relativePosition > length {
+		relativePosition = length
+	}
+	if isEnd {
+		return snippet.start + relativePosition, snippet.source.SourceEndOffset(snippet.text, relativePosition)
+	}
+	return snippet.start + relativePosition, snippet.source.SourceOffset(snippet.text, relativePosition)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Medicines Discovery Catapult
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snippet_reader_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/html"
+	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader/text"
+)
+
+func TestDocument_Locate(t *testing.T) {
+	type args struct {
+		xpath      string
+		start, end uint32
+	}
+	tests := []struct {
+		name   string
+		reader snippet_reader.Client
+		source string
+		args   args
+		want   snippet_reader.Location
+		wantOk bool
+	}{
+		{
+			name:   "html element",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div/*[1]", start: 2, end: 5},
+			want:   snippet_reader.Location{DocumentStart: 2, DocumentEnd: 5, SourceStart: 16, SourceEnd: 20},
+			wantOk: true,
+		},
+		{
+			name:   "html character reference",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div/*[1]", start: 0, end: 3},
+			want:   snippet_reader.Location{DocumentStart: 0, DocumentEnd: 3, SourceStart: 10, SourceEnd: 17},
+			wantOk: true,
+		},
+		{
+			name:   "html text either side of a child element",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div", start: 1, end: 3},
+			want:   snippet_reader.Location{DocumentStart: 7, DocumentEnd: 9, SourceStart: 6, SourceEnd: 25},
+			wantOk: true,
+		},
+		{
+			name:   "html ending with a character reference",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div/*[1]", start: 0, end: 2},
+			want:   snippet_reader.Location{DocumentStart: 0, DocumentEnd: 2, SourceStart: 10, SourceEnd: 16},
+			wantOk: true,
+		},
+		{
+			name:   "html ending before a child element",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div", start: 0, end: 2},
+			want:   snippet_reader.Location{DocumentStart: 6, DocumentEnd: 8, SourceStart: 5, SourceEnd: 7},
+			wantOk: true,
+		},
+		{
+			name:   "html unknown xpath",
+			reader: html.SnippetReader{},
+			source: "<div>ab<p>c&amp;d é</p>ef</div>",
+			args:   args{xpath: "/div/*[2]", start: 0, end: 1},
+			wantOk: false,
+		},
+		{
+			name:   "text line",
+			reader: text.SnippetReader{},
+			source: "é one\ntwo\n",
+			args:   args{start: 2, end: 5},
+			want:   snippet_reader.Location{DocumentStart: 2, DocumentEnd: 5, SourceStart: 3, SourceEnd: 6},
+			wantOk: true,
+		},
+		{
+			name:   "text line after a multibyte character",
+			reader: text.SnippetReader{},
+			source: "é one\ntwo\n",
+			args:   args{start: 6, end: 9},
+			want:   snippet_reader.Location{DocumentStart: 6, DocumentEnd: 9, SourceStart: 7, SourceEnd: 10},
+			wantOk: true,
+		},
+		{
+			name:   "text across lines",
+			reader: text.SnippetReader{},
+			source: "é one\ntwo\n",
+			args:   args{start: 2, end: 9},
+			want:   snippet_reader.Location{DocumentStart: 2, DocumentEnd: 9, SourceStart: 3, SourceEnd: 10},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := snippet_reader.NewDocument()
+			for value := range tt.reader.ReadSnippets(strings.NewReader(tt.source)) {
+				if value.Err != nil {
+					break
+				}
+				document.Add(value)
+			}
+
+			got, ok := document.Locate(tt.args.xpath, tt.args.start, tt.args.end)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -14,6 +14,7 @@
 package html
 
 import (
+	"bytes"
 	"io"
 
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
@@ -107,15 +108,19 @@ func htmlToText(r io.Reader, snips chan snippet_reader.Value) {
 	var position uint32
 	var stack htmlStack
 
+	// Each snippet is the text of a single element, so positions within it are relative to the element and its
+	// offset is 0. The source map locates the text in the document.
 	stackPopCallback := func(tag *htmlTag) error {
 		if len(tag.innerText) > 0 {
+			// the newline stands in for the end tag, but has no length so that it isn't part of any entity
+			tag.source = append(tag.source, snippet_reader.SourceSegment{Start: tag.length, Source: position})
 			tag.innerText = append(tag.innerText, '\n')
 			snips <- snippet_reader.Value{
 				Snippet: &pb.Snippet{
-					Text:   string(tag.innerText),
-					Offset: tag.start,
-					Xpath:  tag.xpath,
+					Text:  string(tag.innerText),
+					Xpath: tag.xpath,
 				},
+				Source: tag.source,
 			}
 		}
 		return nil
@@ -127,15 +132,20 @@ func htmlToText(r io.Reader, snips chan snippet_reader.Value) {
 		case html.ErrorToken:
 			// The html tokenizer returns an io.EOF when finished.
 			snips <- snippet_reader.Value{Err: htmlTokenizer.Err()}
+			return
 		case html.TextToken:
+			// Must read this first. Other read methods mutate the current token.
+			htmlTokenRawBytes := append([]byte(nil), htmlTokenizer.Raw()...)
 			htmlTokenBytes := htmlTokenizer.Text()
 
 			// Only write to the buffer if we are not under any disallowed nodes.
 			if !stack.disallowed {
-				stack.collectText(htmlTokenBytes)
+				for _, segment := range textSegments(htmlTokenRawBytes, htmlTokenBytes, position) {
+					stack.collectText(segment.text, segment.source, segment.length)
+				}
 			}
 
-			position += uint32(len(htmlTokenBytes))
+			position += uint32(len(htmlTokenRawBytes))
 		case html.StartTagToken:
 			// Must read this first. Other read methods mutate the current token.
 			htmlTokenBytes := htmlTokenizer.Raw()
@@ -144,10 +154,11 @@ func htmlToText(r io.Reader, snips chan snippet_reader.Value) {
 			tn, _ := htmlTokenizer.TagName()
 			if _, isVoid := voidElements[string(tn)]; isVoid {
 				if string(tn) == "br" {
-					stack.collectText([]byte{'\n'})
+					stack.collectText([]byte{'\n'}, position, uint32(len(htmlTokenBytes)))
 				}
 				stack.push(&htmlTag{name: string(tn), start: position})
 				_ = stack.pop(func(tag *htmlTag) error { return nil })
+				position += uint32(len(htmlTokenBytes))
 			} else {
 				position += uint32(len(htmlTokenBytes))
 				stack.push(&htmlTag{name: string(tn), start: position})
@@ -172,7 +183,7 @@ func htmlToText(r io.Reader, snips chan snippet_reader.Value) {
 			// write a newline to the snippet and send it.
 			tn, _ := htmlTokenizer.TagName()
 			if string(tn) == "br" {
-				stack.collectText([]byte{'\n'})
+				stack.collectText([]byte{'\n'}, position, uint32(len(htmlTokenBytes)))
 			}
 			stack.push(&htmlTag{name: string(tn), start: position})
 			_ = stack.pop(func(tag *htmlTag) error { return nil })
@@ -183,3 +194,46 @@ func htmlToText(r io.Reader, snips chan snippet_reader.Value) {
 		}
 	}
 }
+
+// textSegment is part of the text of an HTML text token, and where it is in the document.
+type textSegment struct {
+	text   []byte
+	source uint32
+	length uint32
+}
+
+// textSegments splits text, the unescaped text of an HTML text token whose raw bytes start at the byte offset source
+// in the document, into segments which can each be located in the document. Character references (e.g. "&amp;") are
+// unescaped into segments of their own, so the text after them is still located exactly.
+func textSegments(raw, text []byte, source uint32) []textSegment {
+	var segments []textSegment
+	var unescaped []byte
+	for start := 0; start < len(raw); {
+		end := len(raw)
+		if next := bytes.IndexByte(raw[start+1:], '&'); next >= 0 {
+			end = start + 1 + next
+		}
+
+		chunk := raw[start:end]
+		if semicolon := bytes.IndexByte(chunk, ';'); chunk[0] == '&' && semicolon > 0 {
+			reference := string(chunk[:semicolon+1])
+			if unescapedReference := html.UnescapeString(reference); unescapedReference != reference {
+				segments = append(segments, textSegment{text: []byte(unescapedReference), source: source + uint32(start), length: uint32(semicolon + 1)})
+				unescaped = append(unescaped, unescapedReference...)
+				start += semicolon + 1
+				continue
+			}
+		}
+
+		segments = append(segments, textSegment{text: chunk, source: source + uint32(start), length: uint32(len(chunk))})
+		unescaped = append(unescaped, chunk...)
+		start = end
+	}
+
+	// The tokenizer does more than unescape character references, e.g. it replaces "\r\n" with "\n". If it has, all we
+	// know is where the whole token is.
+	if !bytes.Equal(unescaped, text) {
+		return []textSegment{{text: text, source: source, length: uint32(len(raw))}}
+	}
+	return segments
+}
@@ -15,10 +15,13 @@ package html
 
 import (
 	"bytes"
+	"html"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
 )
@@ -48,12 +51,16 @@ func TestHtmlToText(t *testing.T) {
 			args: args{
 				r: bytes.NewBufferString("  <body>  x<sup>2</sup> <strike>hello</strike><br/>dave</body>"),
 			},
-			want: wrapSnips([]*pb.Snippet{
+			want: []snippet_reader.Value{
 				{
-					Text:   "  x2 hello\ndave\n",
-					Offset: 8,
-					Xpath:  "/body",
-				}}...),
+					Snippet: &pb.Snippet{
+						Text:  "  x2 hello\ndave\n",
+						Xpath: "/body",
+					},
+					Source: sourceMap(0, 8, 3, 3, 16, 1, 4, 23, 1, 5, 32, 5, 10, 46, 5, 11, 51, 4, 15, 55, 0),
+				},
+				{Err: io.EOF},
+			},
 			wantErr: nil,
 		},
 		{
@@ -61,13 +68,33 @@ func TestHtmlToText(t *testing.T) {
 			args: args{
 				r: bytes.NewBufferString("<p>acetyl<emph>car</emph>nitine</p>"),
 			},
-			want: wrapSnips([]*pb.Snippet{
+			want: []snippet_reader.Value{
 				{
-					Text:   "acetylcarnitine\n",
-					Offset: 3,
-					Xpath:  "/p",
+					Snippet: &pb.Snippet{
+						Text:  "acetylcarnitine\n",
+						Xpath: "/p",
+					},
+					Source: sourceMap(0, 3, 6, 6, 15, 3, 9, 25, 6, 15, 31, 0),
 				},
-			}...),
+				{Err: io.EOF},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "character references",
+			args: args{
+				r: bytes.NewBufferString("<p>a &amp; b&#160;c</p>"),
+			},
+			want: []snippet_reader.Value{
+				{
+					Snippet: &pb.Snippet{
+						Text:  "a & b\u00a0c\n",
+						Xpath: "/p",
+					},
+					Source: sourceMap(0, 3, 2, 2, 5, 5, 3, 10, 2, 5, 12, 6, 6, 18, 1, 7, 19, 0),
+				},
+				{Err: io.EOF},
+			},
 			wantErr: nil,
 		},
 	}
@@ -129,11 +156,40 @@ func Test_htmlStack_xpath(t *testing.T) {
 	}
 }
 
-func wrapSnips(snips ...*pb.Snippet) []snippet_reader.Value {
-	var values []snippet_reader.Value
-	for _, snip := range snips {
-		values = append(values, snippet_reader.Value{Snippet: snip})
+func TestSourceMapsMatchDocument(t *testing.T) {
+	source, err := ioutil.ReadFile("../../../resources/acetylcarnitine.html")
+	require.Nil(t, err)
+
+	for val := range ReadSnippets(bytes.NewReader(source)) {
+		if val.Err != nil {
+			require.Equal(t, io.EOF, val.Err)
+			break
+		}
+
+		characters := []rune(val.Snippet.GetText())
+		for i, segment := range val.Source {
+			end := uint32(len(characters))
+			if i+1 < len(val.Source) {
+				end = val.Source[i+1].Start
+			}
+			text := string(characters[segment.Start:end])
+			require.LessOrEqual(t, int(segment.Source+segment.Length), len(source))
+			segmentSource := string(source[segment.Source : segment.Source+segment.Length])
+
+			if text == "\n" && source[segment.Source] == '<' {
+				// The newline added at the end of a block element or for a <br>.
+				continue
+			}
+			assert.Equal(t, text, html.UnescapeString(segmentSource), "segment %d of %s", i, val.Snippet.GetXpath())
+		}
+	}
+}
+
+// sourceMap returns a SourceMap made from the start, source and length of each segment.
+func sourceMap(segments ...uint32) snippet_reader.SourceMap {
+	var sourceMap snippet_reader.SourceMap
+	for i := 0; i < len(segments); i += 3 {
+		sourceMap = append(sourceMap, snippet_reader.SourceSegment{Start: segments[i], Source: segments[i+1], Length: segments[i+2]})
 	}
-	values = append(values, snippet_reader.Value{Err: io.EOF})
-	return values
+	return sourceMap
 }
@@ -16,6 +16,9 @@ package html
 import (
 	"container/list"
 	"fmt"
+	"unicode/utf8"
+
+	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
 )
 
 type htmlStack struct {
@@ -32,6 +35,8 @@ type htmlTag struct {
 	start     uint32
 	children  int
 	innerText []byte
+	length    uint32                   // the length of innerText in characters
+	source    snippet_reader.SourceMap // where innerText is in the document
 	xpath     string
 }
 
@@ -63,7 +68,9 @@ func (s *htmlStack) push(tag *htmlTag) {
 	}
 }
 
-func (s *htmlStack) collectText(text []byte) {
+// collectText appends text, which is the length bytes at the byte offset source in the document, to the inner text of
+// the tag currently collecting text.
+func (s *htmlStack) collectText(text []byte, source, length uint32) {
 	if s.List == nil {
 		s.List = list.New()
 	}
@@ -75,7 +82,9 @@ func (s *htmlStack) collectText(text []byte) {
 		} else {
 			tag = s.Front().Value.(*htmlTag)
 		}
+		tag.source = append(tag.source, snippet_reader.SourceSegment{Start: tag.length, Source: source, Length: length})
 		tag.innerText = append(tag.innerText, text...)
+		tag.length += uint32(utf8.RuneCount(text))
 	}
 }
 
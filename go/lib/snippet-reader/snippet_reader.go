@@ -15,6 +15,8 @@ package snippet_reader
 
 import (
 	"io"
+	"sort"
+	"unicode/utf8"
 
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 )
@@ -27,6 +29,63 @@ type Client interface {
 type Value struct {
 	Snippet *pb.Snippet
 	Err     error
+	Source  SourceMap // where the snippet's text is in the document it was read from
+}
+
+// SourceMap locates the characters of a snippet's text in the document the snippet was read from. The text is made up
+// of segments, each of which is a run of characters which appear one after another in the document, so only the start
+// and length of each segment is recorded.
+type SourceMap []SourceSegment
+
+// SourceSegment is a run of characters in a snippet's text which are next to each other in the document.
+type SourceSegment struct {
+	Start  uint32 // the offset, in characters, of the segment's first character in the snippet's text
+	Source uint32 // the offset, in bytes, of the segment's first character in the document
+	Length uint32 // the length, in bytes, of the segment in the document, which may differ from its text, e.g. "&amp;"
+}
+
+// SourceOffset returns the offset in bytes in the document of the character at position in text, which must be the
+// text of the snippet m belongs to. position may be the length of text, to find the end of the last character.
+func (m SourceMap) SourceOffset(text string, position uint32) uint32 {
+	// find the last segment which starts at or before position
+	i := sort.Search(len(m), func(i int) bool { return m[i].Start > position }) - 1
+	if i < 0 {
+		return 0
+	}
+	segment := m[i]
+	return segment.Source + uint32(byteOffsetOf(text, position)-byteOffsetOf(text, segment.Start))
+}
+
+// SourceEndOffset returns the offset in bytes in the document of the end of the character before position in text.
+// Unlike SourceOffset, this doesn't include anything in the document between that character and the next, such as tags.
+func (m SourceMap) SourceEndOffset(text string, position uint32) uint32 {
+	if position == 0 {
+		return m.SourceOffset(text, position)
+	}
+
+	// find the segment of the character before position
+	i := sort.Search(len(m), func(i int) bool { return m[i].Start >= position }) - 1
+	if i < 0 {
+		return 0
+	}
+	isLastSegment := i+1 == len(m)
+	if (isLastSegment && int(position) >= utf8.RuneCountInString(text)) || (!isLastSegment && m[i+1].Start == position) {
+		// the character is the last in its segment
+		return m[i].Source + m[i].Length
+	}
+	return m.SourceOffset(text, position)
+}
+
+// byteOffsetOf returns the offset in bytes of the character at position in text.
+func byteOffsetOf(text string, position uint32) int {
+	var characters uint32
+	for byteOffset := range text {
+		if characters == position {
+			return byteOffset
+		}
+		characters++
+	}
+	return len(text)
 }
 
 func ReadChannelWithCallback(snipReaderValues <-chan Value, callback func(snippet *pb.Snippet) error) error {
@@ -42,3 +101,13 @@ func ReadChannelWithCallback(snipReaderValues <-chan Value, callback func(snippe
 	}
 	return nil
 }
+
+// Drain discards values from snipReaderValues until the reader sends an error (including io.EOF) or the channel is
+// closed. Use it to stop reading part way through without blocking the goroutine which is sending the values.
+func Drain(snipReaderValues <-chan Value) {
+	for readerValue := range snipReaderValues {
+		if readerValue.Err != nil {
+			return
+		}
+	}
+}
@@ -16,6 +16,7 @@ package text
 import (
 	"bufio"
 	"io"
+	"unicode/utf8"
 
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/gen/pb"
 	snippet_reader "gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib/snippet-reader"
@@ -40,21 +41,30 @@ func ReadSnippets(r io.Reader) <-chan snippet_reader.Value {
 	return snips
 }
 
+// readLines sends each line of r as a snippet, including the newline which ends it so that the snippets' text is the
+// whole of r. Each snippet's offset is the offset of the line in r, in characters.
 func readLines(r io.Reader, values chan snippet_reader.Value) {
-	scanner := bufio.NewScanner(r)
-	offset := 0
-	for scanner.Scan() {
-		values <- snippet_reader.Value{
-			Snippet: &pb.Snippet{
-				Text:   scanner.Text(),
-				Offset: uint32(offset),
-			},
-			Err: nil,
+	reader := bufio.NewReader(r)
+	var offset, source uint32
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			values <- snippet_reader.Value{
+				Snippet: &pb.Snippet{
+					Text:   line,
+					Offset: offset,
+				},
+				Source: snippet_reader.SourceMap{{Start: 0, Source: source, Length: uint32(len(line))}},
+			}
+			offset += uint32(utf8.RuneCountInString(line))
+			source += uint32(len(line))
+		}
+		if err != nil {
+			values <- snippet_reader.Value{
+				Snippet: nil,
+				Err:     err,
+			}
+			return
 		}
-		offset += len(scanner.Text()) + 1 // +1 for newline character
-	}
-	values <- snippet_reader.Value{
-		Snippet: nil,
-		Err:     io.EOF,
 	}
 }
@@ -14,6 +14,7 @@
 package testhelpers
 
 import (
+	"context"
 	"gitlab.mdcatapult.io/informatics/software-engineering/entity-recognition/go/lib"
 	"io"
 
@@ -39,7 +40,14 @@ func CreateSnippet(originalText, normalisedText string, offset uint32, xpath str
 }
 
 func NewMockRecognizeServerStream(snippets ...*pb.Snippet) *mocks.Recognizer_GetStreamServer {
+	return NewMockRecognizeServerStreamWithContext(context.Background(), snippets...)
+}
+
+// NewMockRecognizeServerStreamWithContext returns a mock stream which receives snippets, and whose context is ctx, e.g.
+// with the incoming metadata of the stream.
+func NewMockRecognizeServerStreamWithContext(ctx context.Context, snippets ...*pb.Snippet) *mocks.Recognizer_GetStreamServer {
 	stream := &mocks.Recognizer_GetStreamServer{}
+	stream.On("Context").Return(ctx).Maybe()
 	for _, snippet := range snippets {
 		stream.On("Recv").Return(snippet, nil).Once()
 	}
@@ -64,7 +72,9 @@ func APIEntityFromEntity(entity *pb.Entity) lib.APIEntity {
 		Metadata:    entity.Metadata,
 		Positions: []lib.Position{
 			{Xpath: entity.Xpath,
-				Position: entity.Position},
+				Position:    entity.Position,
+				EndPosition: entity.EndPosition,
+				Text:        entity.Text},
 		},
 	}
 }
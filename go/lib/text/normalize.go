@@ -93,6 +93,21 @@ func NormalizeAndLowercaseString(inputString string) (normalizedToken string, co
 	return normalizedToken, compoundTokenEnd
 }
 
+// NormalizeAndLowercaseTokens splits a dictionary synonym on whitespace and normalizes and lowercases each token,
+// dropping any which are empty once normalized. This is how synonyms are stored, so that they match tokens which have
+// been through NormalizeAndLowercaseSnippet.
+func NormalizeAndLowercaseTokens(synonym string) []string {
+	tokens := strings.Fields(synonym)
+	normalizedTokens := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		normalizedToken, _ := NormalizeAndLowercaseString(token)
+		if len(normalizedToken) > 0 {
+			normalizedTokens = append(normalizedTokens, normalizedToken)
+		}
+	}
+	return normalizedTokens
+}
+
 //NormalizeString
 /* NormalizeString normalizes the argument and returns the result, along with whether this is the end of
 * a compound token based on TokenDelimiters, and whether the first char was removed (useful for adjusting offsets on snippets).
@@ -106,12 +121,29 @@ func NormalizeAndLowercaseString(inputString string) (normalizedToken string, co
 * This should not be required for leadmine, which has its own settings to normalize input tokens.
  */
 func NormalizeString(token string) (normalizedToken string, compoundTokenEnd, removedFirstChar bool) {
+	start, end, compoundTokenEnd := TrimEnclosingCharacters(token)
+	if start == end {
+		return "", compoundTokenEnd, false
+	}
+
+	// normalise the bytes to NFKC
+	normalizedToken = norm.NFKC.String(token[start:end])
+
+	return normalizedToken, compoundTokenEnd, start > 0
+}
+
+// TrimEnclosingCharacters returns the byte offsets in token of the text which NormalizeString keeps, i.e. token without
+// the enclosing characters NormalizeString removes from its start and end, and whether this is the end of a compound
+// token. Unlike NormalizeString it doesn't normalize the text, so token[start:end] is exactly as it appears in the source.
+func TrimEnclosingCharacters(token string) (start, end int, compoundTokenEnd bool) {
+	end = len(token)
+
 	// Check length so we dont get a seg fault
 	if len(token) == 0 {
-		return "", false, false
+		return 0, 0, false
 	} else if _, ok := EnclosingCharacters[token[0]]; ok && len(token) == 1 {
 		_, ok := TokenDelimiters[token[0]]
-		return "", ok, false
+		return 0, 0, ok
 	}
 
 	// remove quotes, brackets etc. from start
@@ -134,36 +166,33 @@ func NormalizeString(token string) (normalizedToken string, compoundTokenEnd, re
 			}
 		}
 		if removeFirstChar {
-			token = RemoveFirstChar(token)
+			start++
 		}
-		if removeLastChar && len(token) > 0 {
-			token = RemoveLastChar(token)
+		if removeLastChar && end > start {
+			end--
 		}
 	}
 
-	if len(token) == 0 {
-		return "", false, false
+	if start == end {
+		return start, end, false
 	}
 
 	// remove quotes, brackets etc. from end
-	if counterpart, ok := EnclosingCharacters[LastChar(token)]; ok {
+	if counterpart, ok := EnclosingCharacters[token[end-1]]; ok {
 		removeLastChar := true
 		if counterpart != 0 {
-			for _, b := range token {
+			for _, b := range token[start:end] {
 				if byte(b) == counterpart {
 					removeLastChar = false
 					break
 				}
 			}
 		}
-		if removeLastChar && len(token) > 0 {
-			_, compoundTokenEnd = TokenDelimiters[LastChar(token)]
-			token = RemoveLastChar(token)
+		if removeLastChar {
+			_, compoundTokenEnd = TokenDelimiters[token[end-1]]
+			end--
 		}
 	}
 
-	// normalise the bytes to NFKC
-	normalizedToken = norm.NFKC.String(token)
-
-	return normalizedToken, compoundTokenEnd, removedFirstChar
+	return start, end, compoundTokenEnd
 }
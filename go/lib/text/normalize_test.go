@@ -106,3 +106,36 @@ func TestNormalizeAndLowercaseString(t *testing.T) {
 		assert.Equal(t, tt.expectedSentenceEnd, actualSentenceEnd)
 	}
 }
+
+func TestNormalizeAndLowercaseTokens(t *testing.T) {
+	assert.Equal(t, []string{"acetyl", "l-carnitine"}, NormalizeAndLowercaseTokens("  Acetyl (L-Carnitine) "))
+	assert.Equal(t, []string{"calcium"}, NormalizeAndLowercaseTokens("calcium ."))
+	assert.Equal(t, []string{}, NormalizeAndLowercaseTokens(""))
+}
+
+func TestTrimEnclosingCharacters(t *testing.T) {
+	tests := []struct {
+		name                 string
+		token                string
+		wantText             string
+		wantStart            int
+		wantCompoundTokenEnd bool
+	}{
+		{name: "nothing to trim", token: "x²", wantText: "x²", wantStart: 0},
+		{name: "enclosing characters", token: "(hello)", wantText: "hello", wantStart: 1},
+		{name: "end of sentence", token: "hello.", wantText: "hello", wantStart: 0, wantCompoundTokenEnd: true},
+		{name: "contains counterpart", token: "(a)-hydroxycarbamide", wantText: "(a)-hydroxycarbamide", wantStart: 0},
+		{name: "only enclosing characters", token: "()", wantText: "", wantStart: 1},
+	}
+	for _, tt := range tests {
+		start, end, compoundTokenEnd := TrimEnclosingCharacters(tt.token)
+		assert.Equal(t, tt.wantText, tt.token[start:end], tt.name)
+		assert.Equal(t, tt.wantStart, start, tt.name)
+		assert.Equal(t, tt.wantCompoundTokenEnd, compoundTokenEnd, tt.name)
+
+		// NormalizeString removes the same characters.
+		normalized, _, removedFirstChar := NormalizeString(tt.token)
+		assert.Equal(t, tt.wantText != "" && start > 0, removedFirstChar, tt.name)
+		assert.Equal(t, len(tt.wantText) == 0, len(normalized) == 0, tt.name)
+	}
+}
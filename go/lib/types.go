@@ -22,6 +22,17 @@ type APIEntity struct {
 }
 
 type Position struct {
-	Xpath    string `json:"xpath"`
-	Position uint32 `json:"position"`
+	Xpath       string `json:"xpath"`
+	Position    uint32 `json:"position"`
+	EndPosition uint32 `json:"endPosition"` // the position of the character after the entity
+	Text        string `json:"text"`        // the entity's text exactly as it appears in the document
+
+	// DocumentPosition and DocumentEndPosition are offsets in characters in the document's text, i.e. the output
+	// of /text for HTML, or the document itself for plain text.
+	DocumentPosition    uint32 `json:"documentPosition"`
+	DocumentEndPosition uint32 `json:"documentEndPosition"`
+
+	// SourcePosition and SourceEndPosition are offsets in bytes in the document as it was sent.
+	SourcePosition    uint32 `json:"sourcePosition"`
+	SourceEndPosition uint32 `json:"sourceEndPosition"`
 }
@@ -61,8 +61,10 @@ var _ = Describe("Swissprot", func() {
 		expectedEntity := lib.APIEntity{
 			Name: "Q540X7",
 			Positions: []lib.Position{{
-				Position: 6,
-				Xpath:    "/html",
+				Position:    6,
+				EndPosition: 12,
+				Text:        "Q540X7",
+				Xpath:       "/html",
 			}},
 			Recogniser: "dictionary",
 			Identifiers: map[string]string{